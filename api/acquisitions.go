@@ -0,0 +1,575 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Комплектование: заказы поставщикам со строками по фондам финансирования,
+// частичная приёмка с заведением книг и экземпляров, расход по фондам.
+// Заказ: draft → ordered → partially_received → received; до полной приёмки
+// его можно отменить.
+
+type OrderLine struct {
+	ID        string  `json:"id"`
+	Title     string  `json:"title"`
+	ISBN      *string `json:"isbn,omitempty"`
+	BookID    *string `json:"book_id,omitempty"`
+	FundID    string  `json:"fund_id"`
+	FundName  string  `json:"fund_name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Received  int     `json:"received"`
+}
+
+type OrderRow struct {
+	ID           string      `json:"id"`
+	SupplierID   string      `json:"supplier_id"`
+	SupplierName string      `json:"supplier_name"`
+	Number       string      `json:"number"`
+	OrderDate    string      `json:"order_date"`
+	Status       string      `json:"status"`
+	Note         *string     `json:"note,omitempty"`
+	Total        float64     `json:"total"`
+	Lines        []OrderLine `json:"lines"`
+}
+
+type orderUpsert struct {
+	SupplierID string  `json:"supplier_id"`
+	Number     string  `json:"number"`
+	OrderDate  string  `json:"order_date"`
+	Note       *string `json:"note"`
+	Lines      []struct {
+		Title     string  `json:"title"`
+		ISBN      string  `json:"isbn"`
+		BookID    string  `json:"book_id"`
+		FundID    string  `json:"fund_id"`
+		Quantity  int     `json:"quantity"`
+		UnitPrice float64 `json:"unit_price"`
+	} `json:"lines"`
+}
+
+const orderSelect = `
+SELECT o.id, s.id, s.name, o.number, to_char(o.order_date,'DD/MM/YYYY'), o.status, o.note,
+       coalesce((SELECT sum(l.quantity * l.unit_price) FROM purchase_order_lines l WHERE l.order_id = o.id), 0)::float8,
+       coalesce((SELECT json_agg(json_build_object(
+                   'id', l.id, 'title', l.title, 'isbn', l.isbn, 'book_id', l.book_id,
+                   'fund_id', f.id, 'fund_name', f.name, 'quantity', l.quantity,
+                   'unit_price', l.unit_price, 'received', l.received) ORDER BY l.title)
+                 FROM purchase_order_lines l JOIN acquisition_funds f ON f.id = l.fund_id
+                 WHERE l.order_id = o.id), '[]')
+FROM purchase_orders o
+JOIN suppliers s ON s.id = o.supplier_id
+`
+
+func scanOrder(row interface{ Scan(...any) error }) (OrderRow, error) {
+	var o OrderRow
+	err := row.Scan(&o.ID, &o.SupplierID, &o.SupplierName, &o.Number, &o.OrderDate, &o.Status, &o.Note, &o.Total, &o.Lines)
+	return o, err
+}
+
+func (a *API) orderByID(w http.ResponseWriter, id string) {
+	o, err := scanOrder(a.db.QueryRow(context.Background(), orderSelect+" WHERE o.id=$1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, o)
+}
+
+// listOrders: ?status=, ?supplier_id=.
+func (a *API) listOrders(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := qs.Get("status"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("o.status = $%d", len(args)))
+	}
+	if v := qs.Get("supplier_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("o.supplier_id = $%d", len(args)))
+	}
+	q := orderSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY o.order_date DESC, o.number DESC", args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []OrderRow{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, o)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) getOrder(w http.ResponseWriter, r *http.Request) {
+	a.orderByID(w, chi.URLParam(r, "id"))
+}
+
+func (in *orderUpsert) validate() (time.Time, error) {
+	in.Number = strings.TrimSpace(in.Number)
+	if in.SupplierID == "" || in.Number == "" {
+		return time.Time{}, fmt.Errorf("supplier_id and number required")
+	}
+	d := today()
+	if strings.TrimSpace(in.OrderDate) != "" {
+		var err error
+		if d, err = parseDDMMYYYY(in.OrderDate); err != nil {
+			return d, fmt.Errorf("order_date must be DD/MM/YYYY")
+		}
+	}
+	if len(in.Lines) == 0 {
+		return d, fmt.Errorf("lines required")
+	}
+	for i := range in.Lines {
+		l := &in.Lines[i]
+		l.Title = strings.TrimSpace(l.Title)
+		if l.Title == "" || l.FundID == "" {
+			return d, fmt.Errorf("line %d: title and fund_id required", i+1)
+		}
+		if l.Quantity <= 0 {
+			return d, fmt.Errorf("line %d: quantity must be positive", i+1)
+		}
+		if l.UnitPrice < 0 {
+			return d, fmt.Errorf("line %d: unit_price must not be negative", i+1)
+		}
+		if l.ISBN != "" {
+			n, err := NormalizeISBN(l.ISBN)
+			if err != nil {
+				return d, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			l.ISBN = n
+		}
+	}
+	return d, nil
+}
+
+func insertOrderLines(ctx context.Context, tx pgx.Tx, orderID string, in orderUpsert) error {
+	for _, l := range in.Lines {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO purchase_order_lines(order_id, title, isbn, book_id, fund_id, quantity, unit_price)
+VALUES($1,$2,nullif($3,''),nullif($4,'')::uuid,$5,$6,$7)`,
+			orderID, l.Title, l.ISBN, l.BookID, l.FundID, l.Quantity, l.UnitPrice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func badOrderWrite(w http.ResponseWriter, err error) {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) && pe.Code == "23505" {
+		bad(w, fmt.Errorf("заказ с таким номером уже есть"), 409)
+		return
+	}
+	bad(w, err, 400)
+}
+
+func (a *API) createOrder(w http.ResponseWriter, r *http.Request) {
+	var in orderUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	d, err := in.validate()
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	var id string
+	if err := tx.QueryRow(ctx, `
+INSERT INTO purchase_orders(supplier_id, number, order_date, note) VALUES($1,$2,$3,$4) RETURNING id`,
+		in.SupplierID, in.Number, d, in.Note).Scan(&id); err != nil {
+		badOrderWrite(w, err)
+		return
+	}
+	if err := insertOrderLines(ctx, tx, id, in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.orderByID(w, id)
+}
+
+// updateOrder заменяет шапку и строки черновика.
+func (a *API) updateOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in orderUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	d, err := in.validate()
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM purchase_orders WHERE id=$1 FOR UPDATE`, id).Scan(&status); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if status != "draft" {
+		bad(w, fmt.Errorf("изменять можно только черновик заказа"), 409)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE purchase_orders SET supplier_id=$2, number=$3, order_date=$4, note=$5 WHERE id=$1`,
+		id, in.SupplierID, in.Number, d, in.Note); err != nil {
+		badOrderWrite(w, err)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM purchase_order_lines WHERE order_id=$1`, id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := insertOrderLines(ctx, tx, id, in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.orderByID(w, id)
+}
+
+func (a *API) deleteOrder(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(), `DELETE FROM purchase_orders WHERE id=$1 AND status='draft'`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("черновик заказа не найден"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) setOrderStatus(w http.ResponseWriter, r *http.Request, from []string, to string) {
+	id := chi.URLParam(r, "id")
+	var status string
+	err := a.db.QueryRow(context.Background(), `
+UPDATE purchase_orders SET status=$2 WHERE id=$1 AND status = ANY($3)
+RETURNING status`, id, to, from).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("заказ не найден или его нельзя перевести в %s", to), 409)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.orderByID(w, id)
+}
+
+func (a *API) placeOrder(w http.ResponseWriter, r *http.Request) {
+	a.setOrderStatus(w, r, []string{"draft"}, "ordered")
+}
+
+func (a *API) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	a.setOrderStatus(w, r, []string{"draft", "ordered", "partially_received"}, "cancelled")
+}
+
+// receiveOrder: {"room_id", "lines": [{"line_id", "quantity", "room_id"?, "book"?}]}.
+// Строка со ссылкой на книгу (или с ISBN из каталога) увеличивает её экземпляры;
+// иначе книга создаётся из "book" (поля как в POST /books, copies игнорируется).
+func (a *API) receiveOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		RoomID string `json:"room_id"`
+		Lines  []struct {
+			LineID   string      `json:"line_id"`
+			Quantity int         `json:"quantity"`
+			RoomID   string      `json:"room_id"`
+			Book     *BookUpsert `json:"book"`
+		} `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if len(in.Lines) == 0 {
+		bad(w, fmt.Errorf("lines required"), 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM purchase_orders WHERE id=$1 FOR UPDATE`, id).Scan(&status); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if status != "ordered" && status != "partially_received" {
+		bad(w, fmt.Errorf("заказ в статусе %s не принимается", status), 409)
+		return
+	}
+
+	for i, rl := range in.Lines {
+		var title string
+		var isbn, bookID *string
+		var quantity, received int
+		err := tx.QueryRow(ctx, `
+SELECT title, isbn, book_id, quantity, received FROM purchase_order_lines
+WHERE id=$1 AND order_id=$2 FOR UPDATE`, rl.LineID, id).Scan(&title, &isbn, &bookID, &quantity, &received)
+		if err != nil {
+			bad(w, fmt.Errorf("line %d: not found in this order", i+1), 400)
+			return
+		}
+		if rl.Quantity <= 0 || received+rl.Quantity > quantity {
+			bad(w, fmt.Errorf("line %d: можно принять от 1 до %d экз.", i+1, quantity-received), 400)
+			return
+		}
+		room := rl.RoomID
+		if room == "" {
+			room = in.RoomID
+		}
+		if bookID == nil && isbn != nil {
+			var found string
+			if err := tx.QueryRow(ctx, `SELECT id FROM books WHERE isbn=$1`, *isbn).Scan(&found); err == nil {
+				bookID = &found
+			}
+		}
+
+		var receiptID string
+		if bookID != nil {
+			if room == "" {
+				if err := tx.QueryRow(ctx, `SELECT reading_room_id FROM books WHERE id=$1`, *bookID).Scan(&room); err != nil {
+					bad(w, fmt.Errorf("line %d: book not found", i+1), 400)
+					return
+				}
+			}
+			if err := tx.QueryRow(ctx, `
+INSERT INTO acquisition_receipts(line_id, book_id, room_id, quantity) VALUES($1,$2,$3,$4) RETURNING id`,
+				rl.LineID, *bookID, room, rl.Quantity).Scan(&receiptID); err != nil {
+				bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+				return
+			}
+			if _, err := tx.Exec(ctx, `
+INSERT INTO book_copies(book_id, room_id, receipt_id) SELECT $1, $2, $3 FROM generate_series(1, $4::int)`,
+				*bookID, room, receiptID, rl.Quantity); err != nil {
+				bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+				return
+			}
+			if _, err := tx.Exec(ctx, `UPDATE books SET number_copies = number_copies + $2 WHERE id=$1`, *bookID, rl.Quantity); err != nil {
+				bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+				return
+			}
+		} else {
+			if rl.Book == nil {
+				bad(w, fmt.Errorf("line %d: книги нет в каталоге, передайте book", i+1), 400)
+				return
+			}
+			b := *rl.Book
+			if b.Title == "" {
+				b.Title = title
+			}
+			if b.ISBN == "" && isbn != nil {
+				b.ISBN = *isbn
+			}
+			if room != "" {
+				b.RoomID = room
+			}
+			b.Copies = rl.Quantity
+			if err := prepareBook(&b); err != nil {
+				bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+				return
+			}
+			newID, err := insertBook(ctx, tx, b)
+			if err != nil {
+				badBookWrite(w, fmt.Errorf("line %d: %w", i+1, err))
+				return
+			}
+			bookID, room = &newID, b.RoomID
+			if err := tx.QueryRow(ctx, `
+INSERT INTO acquisition_receipts(line_id, book_id, room_id, quantity) VALUES($1,$2,$3,$4) RETURNING id`,
+				rl.LineID, newID, room, rl.Quantity).Scan(&receiptID); err != nil {
+				bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+				return
+			}
+			// экземпляры новой книги создал триггер
+			if _, err := tx.Exec(ctx, `UPDATE book_copies SET receipt_id=$2 WHERE book_id=$1`, newID, receiptID); err != nil {
+				bad(w, err, 400)
+				return
+			}
+		}
+		if _, err := tx.Exec(ctx, `UPDATE purchase_order_lines SET received = received + $2, book_id = $3 WHERE id=$1`,
+			rl.LineID, rl.Quantity, *bookID); err != nil {
+			bad(w, fmt.Errorf("line %d: %w", i+1, err), 400)
+			return
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+UPDATE purchase_orders o SET status = CASE
+    WHEN NOT EXISTS (SELECT 1 FROM purchase_order_lines l WHERE l.order_id = o.id AND l.received < l.quantity) THEN 'received'
+    ELSE 'partially_received' END
+WHERE o.id=$1`, id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.orderByID(w, id)
+}
+
+type ReceiptRow struct {
+	ID         string  `json:"id"`
+	LineID     string  `json:"line_id"`
+	Title      string  `json:"title"`
+	BookID     *string `json:"book_id,omitempty"`
+	RoomID     string  `json:"room_id"`
+	Quantity   int     `json:"quantity"`
+	ReceivedAt string  `json:"received_at"`
+}
+
+func (a *API) orderReceipts(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT rc.id, l.id, l.title, rc.book_id, rc.room_id, rc.quantity, to_char(rc.received_at,'DD/MM/YYYY HH24:MI')
+FROM acquisition_receipts rc
+JOIN purchase_order_lines l ON l.id = rc.line_id
+WHERE l.order_id=$1
+ORDER BY rc.received_at, l.title`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []ReceiptRow{}
+	for rows.Next() {
+		var x ReceiptRow
+		if err := rows.Scan(&x.ID, &x.LineID, &x.Title, &x.BookID, &x.RoomID, &x.Quantity, &x.ReceivedAt); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, x)
+	}
+	writeJSON(w, out)
+}
+
+// supplierForPublisher возвращает поставщика, связанного с издательством,
+// и создаёт его при первом обращении.
+func (a *API) supplierForPublisher(w http.ResponseWriter, r *http.Request) {
+	pub := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var id string
+	err := a.db.QueryRow(ctx, `
+INSERT INTO suppliers(name, publisher_id)
+SELECT p.name, p.id FROM publishing_houses p WHERE p.id=$1
+ON CONFLICT (publisher_id) WHERE publisher_id IS NOT NULL DO UPDATE SET publisher_id = EXCLUDED.publisher_id
+RETURNING id`, pub).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("publisher not found"), 404)
+		return
+	}
+	if err != nil {
+		dictConflict(w, err)
+		return
+	}
+	v, err := a.loadDict(ctx, dictByName("suppliers"), id)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, v)
+}
+
+type FundSpend struct {
+	FundID    string   `json:"fund_id"`
+	FundName  string   `json:"fund_name"`
+	Year      *int     `json:"year,omitempty"`
+	Budget    *float64 `json:"budget,omitempty"`
+	Ordered   float64  `json:"ordered"`   // сумма по незаотменённым заказам
+	Spent     float64  `json:"spent"`     // сумма принятого
+	Remaining *float64 `json:"remaining"` // бюджет минус принятое
+}
+
+// fundSpend: ?year= — расход по фондам; заказы учитываются по году даты заказа.
+func (a *API) fundSpend(w http.ResponseWriter, r *http.Request) {
+	q := `
+SELECT f.id, f.name, f.year, f.budget::float8,
+       coalesce(sum(l.quantity * l.unit_price) FILTER (WHERE o.status NOT IN ('draft', 'cancelled')), 0)::float8,
+       coalesce(sum(l.received * l.unit_price) FILTER (WHERE o.id IS NOT NULL), 0)::float8
+FROM acquisition_funds f
+LEFT JOIN purchase_order_lines l ON l.fund_id = f.id
+LEFT JOIN purchase_orders o ON o.id = l.order_id AND ($1::int IS NULL OR extract(year FROM o.order_date) = $1)
+GROUP BY f.id, f.name, f.year, f.budget
+ORDER BY f.year DESC NULLS LAST, f.name`
+	var year *int
+	if v := r.URL.Query().Get("year"); v != "" {
+		var y int
+		if _, err := fmt.Sscanf(v, "%d", &y); err != nil {
+			bad(w, fmt.Errorf("year must be a number"), 400)
+			return
+		}
+		year = &y
+	}
+	rows, err := a.db.Query(context.Background(), q, year)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []FundSpend{}
+	for rows.Next() {
+		var f FundSpend
+		if err := rows.Scan(&f.FundID, &f.FundName, &f.Year, &f.Budget, &f.Ordered, &f.Spent); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if f.Budget != nil {
+			rem := *f.Budget - f.Spent
+			f.Remaining = &rem
+		}
+		out = append(out, f)
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Аналитика фонда: использование книг, невостребованная литература для
+// отбора на списание и книги, которых не хватает. Ответы — как у /reports
+// (JSON или ?format=csv).
+
+const (
+	// при какой доле дней «всё на руках» спрос считается превышающим фонд
+	demandSaturation = 0.2
+	// целевая загрузка экземпляров при расчёте докупки
+	demandTargetUtil = 0.8
+	deadStockYears   = 3
+)
+
+// bookUsageSQL — использование каждой книги за период [$1, $2]: дни на руках
+// по всем экземплярам, доля от доступных экземпляро-дней, дни, когда были
+// выданы все экземпляры, и пик одновременных выдач. Выдача в зале в тот же
+// день считается за один день. %s — дополнительные условия на books b.
+const bookUsageSQL = `
+WITH spans AS (
+    SELECT ab.book_id, greatest(ab.date_issue, $1::date) AS s,
+           least(greatest(coalesce(ab.date_return - 1, $2::date), ab.date_issue), $2::date) AS e
+    FROM accounting_books ab
+    WHERE ab.book_id IS NOT NULL AND ab.date_issue <= $2 AND coalesce(ab.date_return, $2) >= $1
+),
+daily AS (
+    SELECT sp.book_id, d::date AS day, count(*) AS out
+    FROM spans sp, generate_series(sp.s, sp.e, interval '1 day') d
+    WHERE sp.e >= sp.s
+    GROUP BY 1, 2
+)
+SELECT b.id::text AS book_id, b.name AS title, au.name AS author, b.number_copies AS copies,
+       (SELECT count(*) FROM accounting_books ab WHERE ab.book_id = b.id AND ab.date_issue BETWEEN $1 AND $2) AS loans,
+       coalesce(sum(dl.out), 0)::bigint AS days_on_loan,
+       round(coalesce(sum(dl.out), 0)::numeric / nullif(($2::date - $1::date + 1) * b.number_copies, 0), 3)::float8 AS utilisation,
+       count(dl.day) FILTER (WHERE dl.out >= b.number_copies) AS saturated_days,
+       coalesce(max(dl.out), 0) AS peak
+FROM books b
+JOIN book_authors au ON au.id = b.author_id
+LEFT JOIN daily dl ON dl.book_id = b.id
+WHERE true %s
+GROUP BY b.id, au.name
+`
+
+// analyticsFilter: ?room_id=, ?group_id= — условия на books b, начиная с $first.
+func analyticsFilter(r *http.Request, first int) (string, []any) {
+	var where []string
+	var args []any
+	for _, f := range []struct{ param, col string }{{"room_id", "b.reading_room_id"}, {"group_id", "b.book_group_id"}} {
+		if v := r.URL.Query().Get(f.param); v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf(" AND %s = $%d", f.col, first+len(args)-1))
+		}
+	}
+	return strings.Join(where, ""), args
+}
+
+// analyticsRange — как у отчётов, но по умолчанию последние 365 дней.
+func analyticsRange(r *http.Request) (time.Time, time.Time, error) {
+	from, to, err := reportRange(r)
+	if err == nil && r.URL.Query().Get("from") == "" {
+		from = to.AddDate(-1, 0, 1)
+	}
+	return from, to, err
+}
+
+// bookUtilisation: ?from=&to=, ?room_id=, ?group_id=, ?order=asc|desc
+// (по умолчанию desc), ?limit= — использование книг за период.
+func (a *API) bookUtilisation(w http.ResponseWriter, r *http.Request) {
+	from, to, err := analyticsRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dir := "DESC"
+	switch r.URL.Query().Get("order") {
+	case "", "desc":
+	case "asc":
+		dir = "ASC"
+	default:
+		bad(w, fmt.Errorf("order must be asc or desc"), 400)
+		return
+	}
+	limit := 100
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > 5000 {
+			bad(w, fmt.Errorf("limit must be 1..5000"), 400)
+			return
+		}
+	}
+	cond, args := analyticsFilter(r, 4)
+	rows, err := a.db.Query(context.Background(),
+		fmt.Sprintf(bookUsageSQL, cond)+" ORDER BY utilisation "+dir+" NULLS LAST, title LIMIT $3",
+		append([]any{from, to, limit}, args...)...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("utilisation", from, to), rows)
+}
+
+// deadStock: ?years= (по умолчанию 3), ?room_id=, ?group_id= — книги без единой
+// выдачи за N лет, поступившие в фонд раньше этого срока. Экземпляры без даты
+// поступления (были в фонде до поэкземплярного учёта) считаются старыми.
+func (a *API) deadStock(w http.ResponseWriter, r *http.Request) {
+	years := deadStockYears
+	if s := r.URL.Query().Get("years"); s != "" {
+		var err error
+		if years, err = strconv.Atoi(s); err != nil || years < 1 || years > 50 {
+			bad(w, fmt.Errorf("years must be 1..50"), 400)
+			return
+		}
+	}
+	since := today().AddDate(-years, 0, 0)
+	cond, args := analyticsFilter(r, 2)
+	rows, err := a.db.Query(context.Background(), `
+SELECT b.id::text AS book_id, b.name AS title, au.name AS author, b.year_publication AS year,
+       g.name AS "group", rr.name AS room, b.number_copies AS copies,
+       to_char(min(bc.acquired_on), 'DD/MM/YYYY') AS acquired,
+       to_char((SELECT max(ab.date_issue) FROM accounting_books ab WHERE ab.book_id = b.id), 'DD/MM/YYYY') AS last_loan
+FROM books b
+JOIN book_authors au ON au.id = b.author_id
+JOIN book_groups g ON g.id = b.book_group_id
+JOIN reading_rooms rr ON rr.id = b.reading_room_id
+JOIN book_copies bc ON bc.book_id = b.id
+WHERE b.number_copies > 0
+  AND NOT EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.book_id = b.id AND ab.date_issue >= $1)`+cond+`
+GROUP BY b.id, au.name, g.name, rr.name
+HAVING min(coalesce(bc.acquired_on, '-infinity')) < $1
+ORDER BY min(coalesce(bc.acquired_on, '-infinity')), title`, append([]any{since}, args...)...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, fmt.Sprintf("dead_stock_%dy", years), rows)
+}
+
+// bookDemand: ?from=&to=, ?room_id=, ?group_id= — книги, у которых все
+// экземпляры были на руках не меньше demandSaturation дней периода, и сколько
+// экземпляров докупить, чтобы средняя загрузка была около demandTargetUtil.
+// Очереди на книги (брони) не ведутся, поэтому спрос оценивается только по
+// истории выдач.
+func (a *API) bookDemand(w http.ResponseWriter, r *http.Request) {
+	from, to, err := analyticsRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	cond, args := analyticsFilter(r, 5)
+	rows, err := a.db.Query(context.Background(), `
+SELECT u.*,
+       round(u.days_on_loan::numeric / ($2::date - $1::date + 1), 2)::float8 AS avg_out,
+       greatest(ceil(u.days_on_loan::numeric / ($2::date - $1::date + 1) / $4::numeric) - u.copies, 1)::int AS recommended_extra
+FROM (`+fmt.Sprintf(bookUsageSQL, cond)+`) u
+WHERE u.saturated_days >= $3::numeric * ($2::date - $1::date + 1)
+ORDER BY recommended_extra DESC, u.saturated_days DESC, u.title`,
+		append([]any{from, to, demandSaturation, demandTargetUtil}, args...)...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("demand", from, to), rows)
+}
@@ -2,34 +2,94 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type API struct {
-	db *pgxpool.Pool
+	db    *pgxpool.Pool
+	meta  MetadataProvider
+	blobs BlobStore
+	// TrueType-шрифт для печатных форм (PDF)
+	pdfFont string
+	// каналы уведомлений читателей: "email", "sms"
+	notifiers map[string]Notifier
+	// сколько дней хранить историю выдач после возврата, если у читателя не задано своё
+	historyDays int
 }
 
-func NewAPI(db *pgxpool.Pool) *API { return &API{db: db} }
+type Option func(*API)
+
+func WithMetadata(p MetadataProvider) Option { return func(a *API) { a.meta = p } }
+
+func WithBlobStore(s BlobStore) Option { return func(a *API) { a.blobs = s } }
+
+func WithPDFFont(path string) Option { return func(a *API) { a.pdfFont = path } }
+
+func WithHistoryRetention(days int) Option { return func(a *API) { a.historyDays = days } }
+
+func WithNotifier(channel string, n Notifier) Option {
+	return func(a *API) {
+		if a.notifiers == nil {
+			a.notifiers = map[string]Notifier{}
+		}
+		a.notifiers[channel] = n
+	}
+}
+
+func NewAPI(db *pgxpool.Pool, opts ...Option) *API {
+	a := &API{db: db, historyDays: defaultHistoryDays}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
 
 func (a *API) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Post("/auth/login", a.login)
+	r.Get("/books/{id}/cover", a.getCover)
+	r.Get("/books/{id}/cover/thumb", a.getCoverThumb)
+	r.Route("/portal", a.portalRoutes)
 	r.Group(func(r chi.Router) {
 		r.Use(a.auth)
+		r.Post("/auth/logout", a.logout)
 
 		// BOOKS
 		r.Get("/books", a.listBooks)
 		r.Post("/books", a.createBook)
+		r.Get("/books/by-isbn/{isbn}", a.bookByISBN)
+		r.Get("/books/lookup", a.lookupBook)
+		r.Post("/books/import/marc", a.importMarc)
+		r.Post("/books/import/csv", a.importBooksCSV)
+		r.Get("/books/marcxml", a.exportMarc)
+		r.Get("/books/{id}/marcxml", a.exportBookMarc)
+		r.Post("/books/{id}/cover", a.uploadCover)
+		r.Get("/books/{id}/attachments", a.listBookAttachments)
+		r.Post("/books/{id}/attachments", a.uploadBookAttachment)
+		r.Get("/attachments/{id}", a.getAttachment)
+		r.Get("/attachments/{id}/thumb", a.getAttachmentThumb)
+		r.Delete("/attachments/{id}", a.deleteAttachment)
+		r.Get("/books/{id}/copies", a.listBookCopies)
+		r.Post("/books/{id}/copies", a.addCopy)
+		r.Get("/copies/by-inventory/{no}", a.copyByInventory)
+		r.Get("/copies/{id}", a.getCopy)
+		r.Put("/copies/{id}", a.updateCopy)
+		r.Get("/copies/{id}/transfers", a.copyTransfers)
 		r.Put("/books/{id}", a.updateBook)
 		r.Delete("/books/{id}", a.deleteBook)
 
@@ -38,41 +98,138 @@ func (a *API) Routes() chi.Router {
 		r.Post("/users", a.createUser)
 		r.Put("/users/{id}", a.updateUser)
 		r.Delete("/users/{id}", a.deleteUser)
+		r.Post("/users/{id}/pin", a.setReaderPIN)
+		r.Delete("/users/{id}/pin", a.clearReaderPIN)
+		r.Get("/users/{id}/loans", a.userLoans)
+		r.Get("/users/{id}/profile", a.userProfile)
+		r.Post("/users/{id}/anonymise", a.anonymiseUser)
+
+		// CLASSIFICATIONS (УДК/ББК)
+		r.Get("/classes", a.listClasses)
+		r.Get("/classes/tree", a.classTree)
+		r.Post("/classes", a.createClass)
+		r.Put("/classes/{id}", a.updateClass)
+		r.Delete("/classes/{id}", a.deleteClass)
+		r.Get("/classes/{id}/books", a.classBooks)
+		r.Get("/books/{id}/classes", a.bookClasses)
+		r.Put("/books/{id}/classes", a.setBookClasses)
 
-		// AUTHORS
-		r.Get("/authors", a.listAuthors)
-		r.Post("/authors", a.createAuthor)
-		r.Put("/authors/{id}", a.updateAuthor)
-		r.Delete("/authors/{id}", a.deleteAuthor)
-
-		// PLACES
-		r.Get("/places", a.listPlaces)
-		r.Post("/places", a.createPlace)
-		r.Put("/places/{id}", a.updatePlace)
-		r.Delete("/places/{id}", a.deletePlace)
-
-		// PUBLISHERS
-		r.Get("/publishers", a.listPublishers)
-		r.Post("/publishers", a.createPublisher)
-		r.Put("/publishers/{id}", a.updatePublisher)
-		r.Delete("/publishers/{id}", a.deletePublisher)
-
-		// GROUPS
-		r.Get("/groups", a.listGroups)
-		r.Post("/groups", a.createGroup)
-		r.Put("/groups/{id}", a.updateGroup)
-		r.Delete("/groups/{id}", a.deleteGroup)
-
-		// ROOMS
-		r.Get("/rooms", a.listRooms)
-		r.Post("/rooms", a.createRoom)
-		r.Put("/rooms/{id}", a.updateRoom)
-		r.Delete("/rooms/{id}", a.deleteRoom)
+		// СПРАВОЧНИКИ: authors, places, publishers, groups, rooms, suppliers, funds
+		for _, d := range dictionaries {
+			a.mountDict(r, d)
+		}
+		r.Get("/authors/duplicates", a.authorDuplicates)
+		r.Post("/authors/{id}/merge", a.mergeAuthors)
+
+		// READING ROOMS: расписание, закрытия, брони мест, посещения, полки
+		r.Get("/rooms/{id}/hours", a.roomHours)
+		r.Put("/rooms/{id}/hours", a.setRoomHours)
+		r.Get("/rooms/{id}/schedule", a.roomSchedule)
+		r.Get("/rooms/{id}/bookings", a.listBookings)
+		r.Post("/rooms/{id}/bookings", a.createBooking)
+		r.Delete("/bookings/{id}", a.cancelBooking)
+		r.Get("/rooms/{id}/visitors", a.roomVisitors)
+		r.Post("/rooms/{id}/checkin", a.checkIn)
+		r.Post("/rooms/{id}/checkout", a.checkOut)
+		r.Get("/rooms/{id}/shelves", a.listShelves)
+		r.Post("/rooms/{id}/shelves", a.createShelf)
+		r.Put("/shelves/{id}", a.updateShelf)
+		r.Delete("/shelves/{id}", a.deleteShelf)
+		r.Get("/rooms/{id}/inventory", a.roomInventory)
+		r.Get("/closures", a.listClosures)
+		r.Post("/closures", a.createClosure)
+		r.Delete("/closures/{id}", a.deleteClosure)
+
+		// TRANSFERS: перемещения экземпляров между залами
+		r.Get("/transfers", a.listTransfers)
+		r.Post("/transfers", a.createTransfer)
+		r.Post("/transfers/{id}/ship", a.shipTransfer)
+		r.Post("/transfers/{id}/receive", a.receiveTransfer)
+		r.Post("/transfers/{id}/cancel", a.cancelTransfer)
+
+		// ACQUISITIONS: заказы поставщикам и приёмка
+		r.Post("/publishers/{id}/supplier", a.supplierForPublisher)
+		r.Get("/funds/spend", a.fundSpend)
+		r.Get("/orders", a.listOrders)
+		r.Post("/orders", a.createOrder)
+		r.Get("/orders/{id}", a.getOrder)
+		r.Put("/orders/{id}", a.updateOrder)
+		r.Delete("/orders/{id}", a.deleteOrder)
+		r.Post("/orders/{id}/place", a.placeOrder)
+		r.Post("/orders/{id}/cancel", a.cancelOrder)
+		r.Post("/orders/{id}/receive", a.receiveOrder)
+		r.Get("/orders/{id}/receipts", a.orderReceipts)
+
+		// INVENTORY: инвентаризация фонда по залам
+		r.Get("/inventory/sessions", a.listInventorySessions)
+		r.Post("/inventory/sessions", a.openInventorySession)
+		r.Get("/inventory/sessions/{id}", a.getInventorySession)
+		r.Post("/inventory/sessions/{id}/scans", a.addInventoryScans)
+		r.Delete("/inventory/sessions/{id}/scans/{no}", a.deleteInventoryScan)
+		r.Get("/inventory/sessions/{id}/report", a.getInventoryReport)
+		r.Post("/inventory/sessions/{id}/close", a.closeInventorySession)
+		r.Post("/inventory/sessions/{id}/mark-lost", a.markInventoryLost)
+
+		r.Get("/works", a.listWorks)
+		r.Post("/works", a.createWork)
+		r.Get("/works/{id}", a.getWork)
+		r.Put("/works/{id}", a.updateWork)
+		r.Delete("/works/{id}", a.deleteWork)
+		r.Post("/works/{id}/merge", a.mergeWorks)
+
+		r.Get("/serials", a.listSerials)
+		r.Post("/serials", a.createSerial)
+		r.Get("/serials/claims", a.serialClaims)
+		r.Get("/serials/{id}", a.getSerial)
+		r.Put("/serials/{id}", a.updateSerial)
+		r.Delete("/serials/{id}", a.deleteSerial)
+		r.Get("/serials/{id}/issues", a.listSerialIssues)
+		r.Post("/serials/{id}/issues", a.checkInIssue)
+		r.Put("/serial-issues/{id}", a.updateIssue)
+		r.Delete("/serial-issues/{id}", a.deleteIssue)
+
+		r.Get("/writeoffs", a.listWriteOffs)
+		r.Post("/writeoffs", a.createWriteOff)
+		r.Get("/writeoffs/{id}", a.getWriteOff)
+		r.Get("/writeoffs/{id}/act.pdf", a.writeOffActPDF)
+		r.With(adminOnly).Post("/writeoffs/{id}/approve", a.approveWriteOff)
+		r.With(adminOnly).Post("/writeoffs/{id}/reject", a.rejectWriteOff)
 
 		// LOANS
 		r.Get("/loans", a.listLoans)
+		r.Get("/loans/usage", a.loanUsage)
 		r.Post("/loans/issue", a.issueBook)
 		r.Post("/loans/return", a.returnBook)
+		r.Post("/loans/{id}/renew", a.renewLoanHandler)
+
+		// NOTIFICATIONS
+		r.Get("/notifications", a.listNotifications)
+		r.Post("/notifications/{id}/retry", a.retryNotification)
+		r.With(adminOnly).Post("/notifications/run", a.runNotificationsHandler)
+
+		// REPORTS
+		r.Get("/reports/loans", a.reportLoans)
+		r.Get("/reports/titles", a.reportTopTitles)
+		r.Get("/reports/readers", a.reportReaders)
+		r.Get("/reports/loan-duration", a.reportLoanDuration)
+		r.Get("/reports/turnover", a.reportTurnover)
+		r.Get("/reports/6nk", a.statFormHandler)
+
+		// ANALYTICS
+		r.Get("/analytics/utilisation", a.bookUtilisation)
+		r.Get("/analytics/dead-stock", a.deadStock)
+		r.Get("/analytics/demand", a.bookDemand)
+
+		// JOBS
+		r.Route("/jobs", func(r chi.Router) {
+			r.Use(adminOnly)
+			r.Get("/", a.listJobs)
+			r.Put("/{name}", a.updateJob)
+			r.Get("/{name}/runs", a.listJobRuns)
+			r.Post("/{name}/run", a.triggerJob)
+			r.Post("/{name}/pause", a.pauseJob)
+			r.Post("/{name}/resume", a.resumeJob)
+		})
 		r.Delete("/loans/{id}", a.deleteLoan)
 	})
 
@@ -83,24 +240,37 @@ type Employee struct {
 	ID           string
 	Login        string
 	PasswordHash string
+	Role         string
 }
 
 type BookRow struct {
-	ID            string `json:"id"`
-	Title         string `json:"title"`
-	PubYear       int    `json:"pub_year"`
-	Pages         int    `json:"pages"`
-	Copies        int    `json:"copies"`
-	AuthorID      string `json:"author_id"`
-	AuthorName    string `json:"author_name"`
-	GroupID       string `json:"group_id"`
-	GroupName     string `json:"group_name,omitempty"`
-	PlaceID       string `json:"place_id"`
-	PlaceName     string `json:"place_name"`
-	PublisherID   string `json:"publisher_id"`
-	PublisherName string `json:"publisher_name"`
-	RoomID        string `json:"room_id"`
-	RoomName      string `json:"room_name,omitempty"`
+	ID            string     `json:"id"`
+	Title         string     `json:"title"`
+	PubYear       int        `json:"pub_year"`
+	Pages         int        `json:"pages"`
+	Copies        int        `json:"copies"`
+	AuthorID      string     `json:"author_id"`
+	AuthorName    string     `json:"author_name"`
+	GroupID       string     `json:"group_id"`
+	GroupName     string     `json:"group_name,omitempty"`
+	PlaceID       string     `json:"place_id"`
+	PlaceName     string     `json:"place_name"`
+	PublisherID   string     `json:"publisher_id"`
+	PublisherName string     `json:"publisher_name"`
+	RoomID        string     `json:"room_id"`
+	RoomName      string     `json:"room_name,omitempty"`
+	ISBN          *string    `json:"isbn,omitempty"`
+	CoverURL      *string    `json:"cover_url,omitempty"`
+	LendingMode   string     `json:"lending_mode"`
+	WorkID        *string    `json:"work_id,omitempty"`
+	SeriesID      *string    `json:"series_id,omitempty"`
+	SeriesName    *string    `json:"series_name,omitempty"`
+	SeriesNumber  *int       `json:"series_number,omitempty"`
+	Languages     []LangRef  `json:"languages"`
+	TitleTranslit *string    `json:"title_translit,omitempty"`
+	Edition       *string    `json:"edition,omitempty"`
+	Available     int        `json:"available"`
+	Classes       []ClassRef `json:"classes"`
 }
 
 type BookUpsert struct {
@@ -113,6 +283,19 @@ type BookUpsert struct {
 	Pages       int    `json:"pages"`
 	Copies      int    `json:"copies"`
 	RoomID      string `json:"room_id"`
+	ISBN        string `json:"isbn"`
+	LendingMode string `json:"lending_mode"`
+	// при обновлении пустой work_id и отсутствующие поля ниже не меняются;
+	// при создании без work_id книга попадает в произведение с тем же
+	// названием и автором (или в новое)
+	WorkID       string  `json:"work_id"`
+	SeriesID     *string `json:"series_id"`
+	SeriesNumber *int    `json:"series_number"`
+	// коды ISO 639, первый — основной язык
+	Languages *[]string `json:"languages"`
+	// пусто — транслитерация по ГОСТ 7.79 заполняется из названия
+	TitleTranslit *string `json:"title_translit"`
+	Edition       *string `json:"edition"`
 }
 
 type UserRow struct {
@@ -121,21 +304,29 @@ type UserRow struct {
 	DateBirth    string  `json:"date_birth"`
 	Phone        *string `json:"phone,omitempty"`
 	TicketNumber int     `json:"ticket_number"`
-}
-
-type DictRow struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	Email        *string `json:"email,omitempty"`
+	CardExpires  *string `json:"card_expires,omitempty"`
+	NotifyLang   string  `json:"notify_lang"`
+	NotifyOptOut bool    `json:"notify_opt_out"`
+	// выдан ли PIN для личного кабинета
+	HasPIN bool `json:"has_pin"`
 }
 
 type LoanRow struct {
 	ID         string  `json:"id"`
-	UserID     string  `json:"user_id"`
+	UserID     *string `json:"user_id,omitempty"`
 	UserName   string  `json:"user_name"`
-	BookID     string  `json:"book_id"`
+	BookID     *string `json:"book_id,omitempty"`
+	IssueID    *string `json:"issue_id,omitempty"`
 	BookTitle  string  `json:"book_title"`
 	DateIssue  string  `json:"date_issue"`
+	DateDue    string  `json:"date_due"`
 	DateReturn *string `json:"date_return,omitempty"`
+	LoanType   string  `json:"loan_type"`
+	CopyID     *string `json:"copy_id,omitempty"`
+	Inventory  *string `json:"inventory_no,omitempty"`
+	// по состоянию на последний пересчёт (задание overdue)
+	OverdueDays int `json:"overdue_days"`
 }
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -162,58 +353,165 @@ func parseDDMMYYYY(s string) (time.Time, error) {
 }
 func dmy(t time.Time) string { return t.Format("02/01/2006") }
 
-func (a *API) listBooks(w http.ResponseWriter, r *http.Request) {
-	q := `
+const bookSelect = `
 SELECT
   b.id, b.name, b.year_publication, b.pages, b.number_copies,
   a.id, a.name,
   g.id, g.name,
   p.id, p.name,
   ph.id, ph.name,
-  rr.id, rr.name
+  rr.id, rr.name,
+  b.isbn,
+  CASE WHEN EXISTS (SELECT 1 FROM book_attachments ba WHERE ba.book_id = b.id AND ba.kind = 'cover')
+       THEN '/api/books/' || b.id || '/cover' END,
+  b.lending_mode,
+  b.work_id, sr.id, sr.name, b.series_number, b.edition, b.name_translit,
+  coalesce((SELECT json_agg(json_build_object('id', l.id, 'code', l.code, 'name', l.name) ORDER BY bl.position, l.code)
+            FROM book_languages bl JOIN languages l ON l.id = bl.language_id
+            WHERE bl.book_id = b.id), '[]'),
+  (SELECT count(*) FROM book_copies c WHERE c.book_id = b.id AND ` + copyFree + `),
+  coalesce((SELECT json_agg(json_build_object('id', c.id, 'scheme', c.scheme, 'code', c.code, 'name', c.name)
+                            ORDER BY c.scheme, c.code NULLS LAST, c.name)
+            FROM book_classifications bc
+            JOIN classifications c ON c.id = bc.classification_id
+            WHERE bc.book_id = b.id), '[]')
 FROM books b
 JOIN book_authors a        ON a.id = b.author_id
 JOIN book_groups  g        ON g.id = b.book_group_id
 JOIN place_publications p  ON p.id = b.place_publication_id
 JOIN publishing_houses ph  ON ph.id = b.published_house_id
 JOIN reading_rooms rr      ON rr.id = b.reading_room_id
-ORDER BY b.name, a.name, b.year_publication;
+LEFT JOIN series sr        ON sr.id = b.series_id
 `
-	rows, err := a.db.Query(context.Background(), q)
+
+func scanBook(row interface{ Scan(...any) error }) (BookRow, error) {
+	var br BookRow
+	err := row.Scan(
+		&br.ID, &br.Title, &br.PubYear, &br.Pages, &br.Copies,
+		&br.AuthorID, &br.AuthorName,
+		&br.GroupID, &br.GroupName,
+		&br.PlaceID, &br.PlaceName,
+		&br.PublisherID, &br.PublisherName,
+		&br.RoomID, &br.RoomName,
+		&br.ISBN, &br.CoverURL, &br.LendingMode,
+		&br.WorkID, &br.SeriesID, &br.SeriesName, &br.SeriesNumber, &br.Edition, &br.TitleTranslit,
+		&br.Languages,
+		&br.Available,
+		&br.Classes,
+	)
+	return br, err
+}
+
+// bookFilter собирает WHERE по query-параметрам каталога.
+func bookFilter(r *http.Request) (string, []any) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if v := qs.Get("author_id"); v != "" {
+		add("b.author_id = $%d", v)
+	}
+	if v := qs.Get("group_id"); v != "" {
+		add("b.book_group_id = $%d", v)
+	}
+	if v := qs.Get("place_id"); v != "" {
+		add("b.place_publication_id = $%d", v)
+	}
+	if v := qs.Get("publisher_id"); v != "" {
+		add("b.published_house_id = $%d", v)
+	}
+	if v := qs.Get("room_id"); v != "" {
+		add("b.reading_room_id = $%d", v)
+	}
+	if v, err := strconv.Atoi(qs.Get("year_from")); err == nil {
+		add("b.year_publication >= $%d", v)
+	}
+	if v, err := strconv.Atoi(qs.Get("year_to")); err == nil {
+		add("b.year_publication <= $%d", v)
+	}
+	// class_id / class_code (+class_scheme) — книги узла классификации вместе с подклассами
+	if v := qs.Get("class_id"); v != "" {
+		args = append(args, v)
+		where = append(where, "b.id IN ("+classSubtree(fmt.Sprintf("id = $%d", len(args)))+
+			" SELECT bc.book_id FROM book_classifications bc JOIN sub ON sub.id = bc.classification_id)")
+	}
+	if v := qs.Get("class_code"); v != "" {
+		scheme := qs.Get("class_scheme")
+		if scheme == "" {
+			scheme = "udc"
+		}
+		args = append(args, v, scheme)
+		where = append(where, "b.id IN ("+classSubtree(fmt.Sprintf("code = $%d AND scheme = $%d", len(args)-1, len(args)))+
+			" SELECT bc.book_id FROM book_classifications bc JOIN sub ON sub.id = bc.classification_id)")
+	}
+	if v := qs.Get("lending_mode"); v != "" {
+		add("b.lending_mode = $%d", v)
+	}
+	if v := qs.Get("work_id"); v != "" {
+		add("b.work_id = $%d", v)
+	}
+	if v := qs.Get("series_id"); v != "" {
+		add("b.series_id = $%d", v)
+	}
+	if v := qs.Get("language"); v != "" {
+		add("b.id IN (SELECT bl.book_id FROM book_languages bl JOIN languages l ON l.id = bl.language_id WHERE l.code = lower($%d))", v)
+	}
+	if v := qs.Get("isbn"); v != "" {
+		n, err := NormalizeISBN(v)
+		if err != nil {
+			n = v
+		}
+		add("b.isbn = $%d", n)
+	}
+	if v := strings.TrimSpace(qs.Get("q")); v != "" {
+		if n, err := NormalizeISBN(v); err == nil {
+			add("b.isbn = $%d", n)
+		} else {
+			// название ищется и в исходной записи, и в транслитерации
+			add("(b.name ILIKE '%%' || $%[1]d || '%%' OR b.name_translit ILIKE '%%' || $%[1]d || '%%')", v)
+		}
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+func (a *API) queryBooks(where string, args ...any) ([]BookRow, error) {
+	rows, err := a.db.Query(context.Background(), bookSelect+where+" ORDER BY b.name, a.name, b.year_publication", args...)
 	if err != nil {
-		bad(w, err, 500)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var out []BookRow
 	for rows.Next() {
-		var br BookRow
-		if err := rows.Scan(
-			&br.ID, &br.Title, &br.PubYear, &br.Pages, &br.Copies,
-			&br.AuthorID, &br.AuthorName,
-			&br.GroupID, &br.GroupName,
-			&br.PlaceID, &br.PlaceName,
-			&br.PublisherID, &br.PublisherName,
-			&br.RoomID, &br.RoomName,
-		); err != nil {
-			bad(w, err, 500)
-			return
+		br, err := scanBook(rows)
+		if err != nil {
+			return nil, err
 		}
 		out = append(out, br)
 	}
-	writeJSON(w, out)
+	return out, rows.Err()
 }
 
-func (a *API) createBook(w http.ResponseWriter, r *http.Request) {
-	var in BookUpsert
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		bad(w, err, 400)
+func (a *API) listBooks(w http.ResponseWriter, r *http.Request) {
+	where, args := bookFilter(r)
+	out, err := a.queryBooks(where, args...)
+	if err != nil {
+		bad(w, err, 500)
 		return
 	}
+	writeJSON(w, out)
+}
+
+// prepareBook проверяет обязательные поля и подставляет значения по умолчанию.
+func prepareBook(in *BookUpsert) error {
 	if in.Title == "" || in.AuthorID == "" || in.GroupID == "" || in.PlaceID == "" || in.PublisherID == "" || in.RoomID == "" || in.PubYear == 0 {
-		bad(w, fmt.Errorf("missing required fields"), 400)
-		return
+		return fmt.Errorf("missing required fields")
 	}
 	if in.Copies <= 0 {
 		in.Copies = 1
@@ -221,56 +519,103 @@ func (a *API) createBook(w http.ResponseWriter, r *http.Request) {
 	if in.Pages <= 0 {
 		in.Pages = 1
 	}
+	if in.LendingMode == "" {
+		in.LendingMode = lendTakeHome
+	}
+	if !lendingModes[in.LendingMode] {
+		return fmt.Errorf("lending_mode must be one of take_home, reading_room, not_for_loan")
+	}
+	return prepareEdition(in)
+}
 
-	q := `
-INSERT INTO books(name, reading_room_id, author_id, place_publication_id, published_house_id,
-                  year_publication, book_group_id, pages, number_copies)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-RETURNING id;
-`
+// prepareEdition проверяет поля издания: серию, номер в ней, языки.
+func prepareEdition(in *BookUpsert) error {
+	if in.SeriesNumber != nil && *in.SeriesNumber <= 0 {
+		return fmt.Errorf("series_number must be positive")
+	}
+	if in.Languages != nil {
+		codes := make([]string, 0, len(*in.Languages))
+		for _, c := range *in.Languages {
+			l, err := normLanguage(c)
+			if err != nil {
+				return err
+			}
+			if l != nil {
+				codes = append(codes, *l)
+			}
+		}
+		in.Languages = &codes
+	}
+	if in.TitleTranslit != nil {
+		in.TitleTranslit = nullStr(strings.TrimSpace(*in.TitleTranslit))
+	}
+	if in.Edition != nil {
+		in.Edition = nullStr(strings.TrimSpace(*in.Edition))
+	}
+	return nil
+}
+
+// insertBook добавляет книгу; экземпляры заводит триггер trg_book_copies_sync.
+func insertBook(ctx context.Context, q dbQuerier, in BookUpsert) (string, error) {
+	isbn, err := isbnArg(in.ISBN)
+	if err != nil {
+		return "", err
+	}
+	workID := in.WorkID
+	if workID == "" {
+		if workID, err = ensureWork(ctx, q, in.Title, in.AuthorID); err != nil {
+			return "", err
+		}
+	}
+	var seriesID *string
+	if in.SeriesID != nil {
+		seriesID = nullStr(*in.SeriesID)
+	}
+	var langs []string
+	if in.Languages != nil {
+		if langs, err = resolveLanguages(ctx, q, *in.Languages); err != nil {
+			return "", err
+		}
+	}
 	var id string
-	if err := a.db.QueryRow(context.Background(), q,
+	err = q.QueryRow(ctx, `
+INSERT INTO books(name, reading_room_id, author_id, place_publication_id, published_house_id,
+                  year_publication, book_group_id, pages, number_copies, isbn, lending_mode,
+                  work_id, series_id, series_number, edition, name_translit)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
+RETURNING id`,
 		in.Title, in.RoomID, in.AuthorID, in.PlaceID, in.PublisherID,
-		in.PubYear, in.GroupID, in.Pages, in.Copies,
-	).Scan(&id); err != nil {
+		in.PubYear, in.GroupID, in.Pages, in.Copies, isbn, in.LendingMode,
+		workID, seriesID, in.SeriesNumber, in.Edition, in.TitleTranslit,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return id, setBookLanguages(ctx, q, id, langs)
+}
+
+func (a *API) createBook(w http.ResponseWriter, r *http.Request) {
+	var in BookUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := prepareBook(&in); err != nil {
 		bad(w, err, 400)
 		return
 	}
+	id, err := insertBook(context.Background(), a.db, in)
+	if err != nil {
+		badBookWrite(w, err)
+		return
+	}
 
-	r2, _ := a.db.Query(context.Background(), `
-SELECT
-  b.id, b.name, b.year_publication, b.pages, b.number_copies,
-  a.id, a.name,
-  g.id, g.name,
-  p.id, p.name,
-  ph.id, ph.name,
-  rr.id, rr.name
-FROM books b
-JOIN book_authors a        ON a.id = b.author_id
-JOIN book_groups  g        ON g.id = b.book_group_id
-JOIN place_publications p  ON p.id = b.place_publication_id
-JOIN publishing_houses ph  ON ph.id = b.published_house_id
-JOIN reading_rooms rr      ON rr.id = b.reading_room_id
-WHERE b.id=$1`, id)
-	defer func() {
-		if r2 != nil {
-			r2.Close()
-		}
-	}()
-	if r2 != nil && r2.Next() {
-		var br BookRow
-		_ = r2.Scan(
-			&br.ID, &br.Title, &br.PubYear, &br.Pages, &br.Copies,
-			&br.AuthorID, &br.AuthorName,
-			&br.GroupID, &br.GroupName,
-			&br.PlaceID, &br.PlaceName,
-			&br.PublisherID, &br.PublisherName,
-			&br.RoomID, &br.RoomName,
-		)
-		writeJSON(w, br)
+	br, err := scanBook(a.db.QueryRow(context.Background(), bookSelect+"WHERE b.id=$1", id))
+	if err != nil {
+		writeJSON(w, map[string]string{"id": id})
 		return
 	}
-	writeJSON(w, map[string]string{"id": id})
+	writeJSON(w, br)
 }
 
 func (a *API) updateBook(w http.ResponseWriter, r *http.Request) {
@@ -284,31 +629,149 @@ func (a *API) updateBook(w http.ResponseWriter, r *http.Request) {
 		bad(w, fmt.Errorf("missing required fields"), 400)
 		return
 	}
-	if in.Copies <= 0 {
-		in.Copies = 1
+	if in.Copies < 0 {
+		bad(w, fmt.Errorf("copies must not be negative"), 400)
+		return
 	}
 	if in.Pages <= 0 {
 		in.Pages = 1
 	}
+	isbn, err := isbnArg(in.ISBN)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	// пустой lending_mode при обновлении оставляет режим как есть
+	if in.LendingMode != "" && !lendingModes[in.LendingMode] {
+		bad(w, fmt.Errorf("lending_mode must be one of take_home, reading_room, not_for_loan"), 400)
+		return
+	}
+	if err := prepareEdition(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	args := []any{in.Title, in.RoomID, in.AuthorID, in.PlaceID, in.PublisherID, in.PubYear, in.GroupID, in.Pages, in.Copies, isbn, in.LendingMode, id, in.WorkID}
+	var sets []string
+	set := func(col string, v any) {
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf(", %s=$%d", col, len(args)))
+	}
+	if in.SeriesID != nil {
+		set("series_id", nullStr(*in.SeriesID))
+	}
+	if in.SeriesNumber != nil {
+		set("series_number", in.SeriesNumber)
+	}
+	if in.TitleTranslit != nil {
+		set("name_translit", in.TitleTranslit)
+	}
+	ctx := context.Background()
+	// number_copies считается по экземплярам: здесь его можно только
+	// увеличить (недостающие экземпляры заведёт триггер), а убыль
+	// оформляется списанием. 0 — оставить как есть.
+	var have int
+	if err := a.db.QueryRow(ctx, `SELECT number_copies FROM books WHERE id=$1`, id).Scan(&have); errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	} else if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.Copies != 0 && in.Copies < have {
+		bad(w, fmt.Errorf("book has %d copies in stock; retire copies through a write-off act", have), 409)
+		return
+	}
+	var langs []string
+	if in.Languages != nil {
+		if langs, err = resolveLanguages(ctx, a.db, *in.Languages); err != nil {
+			bad(w, err, 400)
+			return
+		}
+	}
+	if in.Edition != nil {
+		set("edition", in.Edition)
+	}
 
-	cmd, err := a.db.Exec(context.Background(), `
+	cmd, err := a.db.Exec(ctx, `
 UPDATE books
 SET name=$1, reading_room_id=$2, author_id=$3, place_publication_id=$4, published_house_id=$5,
-    year_publication=$6, book_group_id=$7, pages=$8, number_copies=$9
-WHERE id=$10`, in.Title, in.RoomID, in.AuthorID, in.PlaceID, in.PublisherID, in.PubYear, in.GroupID, in.Pages, in.Copies, id)
+    year_publication=$6, book_group_id=$7, pages=$8, number_copies=greatest(number_copies, $9), isbn=$10, lending_mode=coalesce(nullif($11, ''), lending_mode),
+    work_id=coalesce(nullif($13, '')::uuid, work_id)`+strings.Join(sets, "")+`
+WHERE id=$12`, args...)
 	if err != nil {
-		bad(w, err, 400)
+		badBookWrite(w, err)
 		return
 	}
 	if cmd.RowsAffected() == 0 {
 		bad(w, fmt.Errorf("not found"), 404)
 		return
 	}
+	if in.Languages != nil {
+		if err := setBookLanguages(ctx, a.db, id, langs); err != nil {
+			bad(w, err, 500)
+			return
+		}
+	}
 	a.listBooks(w, r)
 }
 
+func badBookWrite(w http.ResponseWriter, err error) {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) && pe.Code == "23505" && pe.ConstraintName == "uniq_books_isbn" {
+		bad(w, fmt.Errorf("книга с таким ISBN уже есть в каталоге"), 409)
+		return
+	}
+	if errors.As(err, &pe) && pe.Code == "23505" && pe.ConstraintName == "unique_book" {
+		bad(w, fmt.Errorf("такое издание уже есть в каталоге"), 409)
+		return
+	}
+	bad(w, err, 400)
+}
+
+func (a *API) bookByISBN(w http.ResponseWriter, r *http.Request) {
+	isbn, err := NormalizeISBN(chi.URLParam(r, "isbn"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	br, err := scanBook(a.db.QueryRow(context.Background(), bookSelect+"WHERE b.isbn=$1", isbn))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, br)
+}
+
 func (a *API) deleteBook(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	var keys []string
+	_ = a.db.QueryRow(context.Background(),
+		`SELECT coalesce(array_agg(k), '{}') FROM book_attachments, unnest(array[storage_key, thumb_key]) k WHERE book_id=$1 AND k IS NOT NULL`, id).
+		Scan(&keys)
+	// экземпляры из актов списания удалять нельзя: акт — учётный документ
+	var acts []int
+	if err := a.db.QueryRow(context.Background(), `
+SELECT coalesce(array_agg(DISTINCT wa.act_no ORDER BY wa.act_no), '{}')
+FROM write_off_items wi
+JOIN write_off_acts wa ON wa.id = wi.act_id
+JOIN book_copies bc ON bc.id = wi.copy_id
+WHERE bc.book_id=$1`, id).Scan(&acts); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if len(acts) > 0 {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(409)
+		writeJSON(w, map[string]any{
+			"error":          "экземпляры книги включены в акты списания",
+			"write_off_acts": acts,
+		})
+		return
+	}
 	cmd, err := a.db.Exec(context.Background(), `DELETE FROM books WHERE id=$1`, id)
 	if err != nil {
 		bad(w, err, 400)
@@ -318,12 +781,27 @@ func (a *API) deleteBook(w http.ResponseWriter, r *http.Request) {
 		bad(w, fmt.Errorf("not found"), 404)
 		return
 	}
+	if a.blobs != nil {
+		for _, k := range keys {
+			_ = a.blobs.Delete(context.Background(), k)
+		}
+	}
 	w.WriteHeader(204)
 }
 
+const userSelect = `SELECT id, name, to_char(date_birth,'DD/MM/YYYY'), phone, ticket_number,
+       email, to_char(card_expires,'DD/MM/YYYY'), notify_lang, notify_opt_out, pin_hash IS NOT NULL
+FROM users`
+
+func scanUser(row interface{ Scan(...any) error }) (UserRow, error) {
+	var u UserRow
+	err := row.Scan(&u.ID, &u.Name, &u.DateBirth, &u.Phone, &u.TicketNumber,
+		&u.Email, &u.CardExpires, &u.NotifyLang, &u.NotifyOptOut, &u.HasPIN)
+	return u, err
+}
+
 func (a *API) listUsers(w http.ResponseWriter, r *http.Request) {
-	q := `SELECT id, name, to_char(date_birth,'DD/MM/YYYY'), phone, ticket_number FROM users ORDER BY ticket_number`
-	rows, err := a.db.Query(context.Background(), q)
+	rows, err := a.db.Query(context.Background(), userSelect+` ORDER BY ticket_number`)
 	if err != nil {
 		bad(w, err, 500)
 		return
@@ -332,8 +810,8 @@ func (a *API) listUsers(w http.ResponseWriter, r *http.Request) {
 
 	var out []UserRow
 	for rows.Next() {
-		var u UserRow
-		if err := rows.Scan(&u.ID, &u.Name, &u.DateBirth, &u.Phone, &u.TicketNumber); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			bad(w, err, 500)
 			return
 		}
@@ -342,40 +820,83 @@ func (a *API) listUsers(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, out)
 }
 
-func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
-	var in struct {
-		Name      string  `json:"name"`
-		DateBirth string  `json:"date_birth"`
-		Phone     *string `json:"phone"`
+// userUpsert: поля-указатели, не переданные в запросе, при изменении не трогаются.
+type userUpsert struct {
+	Name         string  `json:"name"`
+	DateBirth    string  `json:"date_birth"`
+	Phone        *string `json:"phone"`
+	Email        *string `json:"email"`
+	CardExpires  *string `json:"card_expires"`
+	NotifyLang   *string `json:"notify_lang"`
+	NotifyOptOut *bool   `json:"notify_opt_out"`
+
+	birth   time.Time
+	expires *time.Time
+}
+
+func (in *userUpsert) validate() error {
+	if in.Name == "" || in.DateBirth == "" {
+		return fmt.Errorf("name and date_birth are required")
+	}
+	d, err := parseDDMMYYYY(in.DateBirth)
+	if err != nil {
+		return fmt.Errorf("date_birth must be DD/MM/YYYY")
+	}
+	in.birth = d
+	if in.Email != nil {
+		e := strings.TrimSpace(*in.Email)
+		if e != "" && !strings.Contains(e, "@") {
+			return fmt.Errorf("invalid email")
+		}
+		in.Email = &e
+	}
+	if in.CardExpires != nil && strings.TrimSpace(*in.CardExpires) != "" {
+		t, err := parseDDMMYYYY(*in.CardExpires)
+		if err != nil {
+			return fmt.Errorf("card_expires must be DD/MM/YYYY")
+		}
+		in.expires = &t
+	}
+	if in.NotifyLang != nil && *in.NotifyLang != "ru" && *in.NotifyLang != "en" {
+		return fmt.Errorf("notify_lang must be ru or en")
 	}
+	return nil
+}
+
+func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
+	var in userUpsert
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if in.Name == "" || in.DateBirth == "" {
-		bad(w, fmt.Errorf("name and date_birth are required"), 400)
+	if err := in.validate(); err != nil {
+		bad(w, err, 400)
 		return
 	}
-	d, err := parseDDMMYYYY(in.DateBirth)
-	if err != nil {
-		bad(w, fmt.Errorf("date_birth must be DD/MM/YYYY"), 400)
-		return
+	lang, optOut := "ru", false
+	if in.NotifyLang != nil {
+		lang = *in.NotifyLang
+	}
+	if in.NotifyOptOut != nil {
+		optOut = *in.NotifyOptOut
+	}
+	var email *string
+	if in.Email != nil {
+		email = nullStr(*in.Email)
 	}
 
 	var id string
-	err = a.db.QueryRow(context.Background(),
-		`INSERT INTO users(name, date_birth, phone) VALUES($1,$2,$3) RETURNING id`,
-		in.Name, d, in.Phone,
+	err := a.db.QueryRow(context.Background(), `
+INSERT INTO users(name, date_birth, phone, email, card_expires, notify_lang, notify_opt_out)
+VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`,
+		in.Name, in.birth, in.Phone, email, in.expires, lang, optOut,
 	).Scan(&id)
 	if err != nil {
 		bad(w, err, 400)
 		return
 	}
 
-	var u UserRow
-	err = a.db.QueryRow(context.Background(),
-		`SELECT id, name, to_char(date_birth,'DD/MM/YYYY'), phone, ticket_number FROM users WHERE id=$1`, id).
-		Scan(&u.ID, &u.Name, &u.DateBirth, &u.Phone, &u.TicketNumber)
+	u, err := scanUser(a.db.QueryRow(context.Background(), userSelect+` WHERE id=$1`, id))
 	if err != nil {
 		bad(w, err, 500)
 		return
@@ -385,28 +906,36 @@ func (a *API) createUser(w http.ResponseWriter, r *http.Request) {
 
 func (a *API) updateUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	var in struct {
-		Name      string  `json:"name"`
-		DateBirth string  `json:"date_birth"`
-		Phone     *string `json:"phone"`
-	}
+	var in userUpsert
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if in.Name == "" || in.DateBirth == "" {
-		bad(w, fmt.Errorf("name and date_birth are required"), 400)
-		return
-	}
-	d, err := parseDDMMYYYY(in.DateBirth)
-	if err != nil {
-		bad(w, fmt.Errorf("date_birth must be DD/MM/YYYY"), 400)
+	if err := in.validate(); err != nil {
+		bad(w, err, 400)
 		return
 	}
 
+	args := []any{id, in.Name, in.birth, in.Phone}
+	var sets []string
+	set := func(col string, v any) {
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf(", %s=$%d", col, len(args)))
+	}
+	if in.Email != nil {
+		set("email", nullStr(*in.Email))
+	}
+	if in.CardExpires != nil {
+		set("card_expires", in.expires)
+	}
+	if in.NotifyLang != nil {
+		set("notify_lang", *in.NotifyLang)
+	}
+	if in.NotifyOptOut != nil {
+		set("notify_opt_out", *in.NotifyOptOut)
+	}
 	cmd, err := a.db.Exec(context.Background(),
-		`UPDATE users SET name=$1, date_birth=$2, phone=$3 WHERE id=$4`,
-		in.Name, d, in.Phone, id)
+		`UPDATE users SET name=$2, date_birth=$3, phone=$4`+strings.Join(sets, "")+` WHERE id=$1`, args...)
 	if err != nil {
 		bad(w, err, 400)
 		return
@@ -432,237 +961,281 @@ func (a *API) deleteUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 }
 
-func scanDict(rows pgxRows) ([]DictRow, error) {
+// loanSelect — выдачи с читателем и названием; у обезличенных выдач
+// (история старше срока хранения) читателя нет.
+const loanSelect = `
+SELECT
+  ab.id,
+  u.id, coalesce(u.name, ''),
+  ab.book_id, ab.issue_id,
+  ` + loanTitle + `,
+  to_char(ab.date_issue,'DD/MM/YYYY'),
+  to_char(ab.date_due,'DD/MM/YYYY'),
+  CASE WHEN ab.date_return IS NULL THEN NULL ELSE to_char(ab.date_return,'DD/MM/YYYY') END,
+  ab.loan_type,
+  ab.copy_id, bc.inventory_no, ab.overdue_days
+` + loanFrom
+
+const loanFrom = `
+FROM accounting_books ab
+LEFT JOIN users u ON u.id = ab.user_id
+LEFT JOIN books b ON b.id = ab.book_id
+LEFT JOIN serial_issues si ON si.id = ab.issue_id
+LEFT JOIN serials s ON s.id = si.serial_id
+LEFT JOIN book_copies bc ON bc.id = ab.copy_id
+`
+
+func scanLoans(rows pgx.Rows) ([]LoanRow, error) {
 	defer rows.Close()
-	var out []DictRow
+	out := []LoanRow{}
 	for rows.Next() {
-		var d DictRow
-		if err := rows.Scan(&d.ID, &d.Name); err != nil {
+		var lr LoanRow
+		if err := rows.Scan(&lr.ID, &lr.UserID, &lr.UserName, &lr.BookID, &lr.IssueID, &lr.BookTitle, &lr.DateIssue, &lr.DateDue, &lr.DateReturn, &lr.LoanType, &lr.CopyID, &lr.Inventory, &lr.OverdueDays); err != nil {
 			return nil, err
 		}
-		out = append(out, d)
+		out = append(out, lr)
 	}
-	return out, nil
+	return out, rows.Err()
 }
 
-type pgxRows interface {
-	Next() bool
-	Scan(...any) error
-	Close()
+// размер страницы списков выдач
+const (
+	pageLimit    = 50
+	maxPageLimit = 500
+)
+
+// loanSort — порядок списка выдач: выражение, его тип для сравнения с
+// курсором и значение ключа у строки (для next_cursor).
+type loanSort struct {
+	expr, typ string
+	key       func(LoanRow) string
 }
 
-func (a *API) listAuthors(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.Query(context.Background(), `SELECT id, name FROM book_authors ORDER BY name`)
-	if err != nil {
-		bad(w, err, 500)
-		return
-	}
-	out, err := scanDict(rows)
-	if err != nil {
-		bad(w, err, 500)
-		return
-	}
-	writeJSON(w, out)
+func isoDate(dmy string) string {
+	t, _ := parseDDMMYYYY(dmy)
+	return t.Format("2006-01-02")
 }
-func (a *API) createAuthor(w http.ResponseWriter, r *http.Request) {
-	a.createDict(w, r, "book_authors")
+
+var loanSorts = map[string]loanSort{
+	"issued": {"ab.date_issue", "date", func(l LoanRow) string { return isoDate(l.DateIssue) }},
+	"due":    {"ab.date_due", "date", func(l LoanRow) string { return isoDate(l.DateDue) }},
+	// невозвращённые — как возвращённые «в бесконечности»
+	"returned": {"coalesce(ab.date_return, 'infinity')", "date", func(l LoanRow) string {
+		if l.DateReturn == nil {
+			return "infinity"
+		}
+		return isoDate(*l.DateReturn)
+	}},
+	"reader": {"coalesce(u.name, '')", "text", func(l LoanRow) string { return l.UserName }},
+	"title":  {loanTitle, "text", func(l LoanRow) string { return l.BookTitle }},
 }
-func (a *API) updateAuthor(w http.ResponseWriter, r *http.Request) {
-	a.updateDict(w, r, "book_authors")
+
+// loanCursor — позиция в списке выдач: значение ключа сортировки и id
+// последней строки страницы.
+type loanCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
 }
-func (a *API) deleteAuthor(w http.ResponseWriter, r *http.Request) {
-	a.deleteDict(w, r, "book_authors")
+
+func (c loanCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
 }
 
-func (a *API) listPlaces(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.Query(context.Background(), `SELECT id, name FROM place_publications ORDER BY name`)
-	if err != nil {
-		bad(w, err, 500)
-		return
+func parseLoanCursor(s, sort string) (*loanCursor, error) {
+	if s == "" {
+		return nil, nil
 	}
-	out, err := scanDict(rows)
-	if err != nil {
-		bad(w, err, 500)
-		return
+	var c loanCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
 	}
-	writeJSON(w, out)
-}
-func (a *API) createPlace(w http.ResponseWriter, r *http.Request) {
-	a.createDict(w, r, "place_publications")
-}
-func (a *API) updatePlace(w http.ResponseWriter, r *http.Request) {
-	a.updateDict(w, r, "place_publications")
-}
-func (a *API) deletePlace(w http.ResponseWriter, r *http.Request) {
-	a.deleteDict(w, r, "place_publications")
-}
-
-func (a *API) listPublishers(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.Query(context.Background(), `SELECT id, name FROM publishing_houses ORDER BY name`)
-	if err != nil {
-		bad(w, err, 500)
-		return
+	if err != nil || c.ID == "" {
+		return nil, fmt.Errorf("bad cursor")
 	}
-	out, err := scanDict(rows)
-	if err != nil {
-		bad(w, err, 500)
-		return
+	if c.Sort != sort {
+		return nil, fmt.Errorf("cursor was issued for sort=%s", c.Sort)
 	}
-	writeJSON(w, out)
-}
-func (a *API) createPublisher(w http.ResponseWriter, r *http.Request) {
-	a.createDict(w, r, "publishing_houses")
-}
-func (a *API) updatePublisher(w http.ResponseWriter, r *http.Request) {
-	a.updateDict(w, r, "publishing_houses")
-}
-func (a *API) deletePublisher(w http.ResponseWriter, r *http.Request) {
-	a.deleteDict(w, r, "publishing_houses")
+	return &c, nil
 }
 
-func (a *API) listGroups(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.Query(context.Background(), `SELECT id, name FROM book_groups ORDER BY name`)
-	if err != nil {
-		bad(w, err, 500)
-		return
+func pageSize(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return pageLimit, nil
 	}
-	out, err := scanDict(rows)
-	if err != nil {
-		bad(w, err, 500)
-		return
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxPageLimit {
+		return 0, fmt.Errorf("limit must be 1..%d", maxPageLimit)
 	}
-	writeJSON(w, out)
+	return n, nil
 }
-func (a *API) createGroup(w http.ResponseWriter, r *http.Request) { a.createDict(w, r, "book_groups") }
-func (a *API) updateGroup(w http.ResponseWriter, r *http.Request) { a.updateDict(w, r, "book_groups") }
-func (a *API) deleteGroup(w http.ResponseWriter, r *http.Request) { a.deleteDict(w, r, "book_groups") }
 
-func (a *API) listRooms(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.db.Query(context.Background(), `SELECT id, name FROM reading_rooms ORDER BY name`)
-	if err != nil {
-		bad(w, err, 500)
-		return
+type LoanPage struct {
+	Items []LoanRow `json:"items"`
+	// итоги по всем выдачам, подходящим под фильтр, а не только по странице
+	Total      int     `json:"total"`
+	Active     int     `json:"active"`
+	Overdue    int     `json:"overdue"`
+	NextCursor *string `json:"next_cursor,omitempty"`
+}
+
+// loanFilters: ?active=true, ?overdue=true, ?type=, ?user_id=, ?book_id=,
+// ?room_id=, ?issued_from=&issued_to=, ?returned_from=&returned_to=
+// (ДД/ММ/ГГГГ, включительно). Условия дописываются к where/args.
+func loanFilters(r *http.Request, where []string, args []any) ([]string, []any, error) {
+	qs := r.URL.Query()
+	if qs.Get("active") == "true" {
+		where = append(where, "ab.date_return IS NULL")
+	}
+	if qs.Get("overdue") == "true" {
+		args = append(args, today())
+		where = append(where, fmt.Sprintf("ab.date_return IS NULL AND ab.date_due < $%d", len(args)))
+	}
+	for _, f := range []struct{ param, cond string }{
+		{"type", "ab.loan_type = $%d"},
+		{"user_id", "ab.user_id = $%d::uuid"},
+		{"book_id", "ab.book_id = $%d::uuid"},
+		{"room_id", "coalesce(b.reading_room_id, s.reading_room_id) = $%d::uuid"},
+	} {
+		if v := qs.Get(f.param); v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf(f.cond, len(args)))
+		}
 	}
-	out, err := scanDict(rows)
-	if err != nil {
-		bad(w, err, 500)
-		return
+	for _, f := range []struct{ param, cond string }{
+		{"issued_from", "ab.date_issue >= $%d"},
+		{"issued_to", "ab.date_issue <= $%d"},
+		{"returned_from", "ab.date_return >= $%d"},
+		{"returned_to", "ab.date_return <= $%d"},
+	} {
+		if v := qs.Get(f.param); v != "" {
+			d, err := parseDDMMYYYY(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", f.param, err)
+			}
+			args = append(args, d)
+			where = append(where, fmt.Sprintf(f.cond, len(args)))
+		}
 	}
-	writeJSON(w, out)
+	return where, args, nil
 }
-func (a *API) createRoom(w http.ResponseWriter, r *http.Request) { a.createDict(w, r, "reading_rooms") }
-func (a *API) updateRoom(w http.ResponseWriter, r *http.Request) { a.updateDict(w, r, "reading_rooms") }
-func (a *API) deleteRoom(w http.ResponseWriter, r *http.Request) { a.deleteDict(w, r, "reading_rooms") }
 
-func (a *API) createDict(w http.ResponseWriter, r *http.Request, table string) {
-	var in DictRow
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		bad(w, err, 400)
+// loanPage отдаёт страницу выдач по условиям where: ?sort=issued|due|returned|reader|title
+// (по умолчанию issued), ?order=asc|desc (по умолчанию desc), ?limit= (по
+// умолчанию 50), ?cursor= — next_cursor прошлой страницы.
+func (a *API) loanPage(w http.ResponseWriter, r *http.Request, where []string, args []any) {
+	qs := r.URL.Query()
+	sortName := qs.Get("sort")
+	if sortName == "" {
+		sortName = "issued"
+	}
+	sort, ok := loanSorts[sortName]
+	if !ok {
+		bad(w, fmt.Errorf("sort must be issued, due, returned, reader or title"), 400)
 		return
 	}
-	if in.Name == "" {
-		bad(w, fmt.Errorf("name required"), 400)
+	dir, cmp := "DESC", "<"
+	switch qs.Get("order") {
+	case "", "desc":
+	case "asc":
+		dir, cmp = "ASC", ">"
+	default:
+		bad(w, fmt.Errorf("order must be asc or desc"), 400)
 		return
 	}
-	var id string
-	err := a.db.QueryRow(context.Background(), fmt.Sprintf(`INSERT INTO %s(name) VALUES($1) RETURNING id`, table), in.Name).Scan(&id)
+	limit, err := pageSize(r)
 	if err != nil {
 		bad(w, err, 400)
 		return
 	}
-	writeJSON(w, DictRow{ID: id, Name: in.Name})
-}
-func (a *API) updateDict(w http.ResponseWriter, r *http.Request, table string) {
-	id := chi.URLParam(r, "id")
-	var in DictRow
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+	cur, err := parseLoanCursor(qs.Get("cursor"), sortName)
+	if err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if in.Name == "" {
-		bad(w, fmt.Errorf("name required"), 400)
-		return
+	ctx := context.Background()
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
 	}
-	cmd, err := a.db.Exec(context.Background(), fmt.Sprintf(`UPDATE %s SET name=$1 WHERE id=$2`, table), in.Name, id)
-	if err != nil {
+	page := LoanPage{}
+	if err := a.db.QueryRow(ctx, `
+SELECT count(*), count(*) FILTER (WHERE ab.date_return IS NULL),
+       count(*) FILTER (WHERE ab.date_return IS NULL AND ab.date_due < $`+strconv.Itoa(len(args)+1)+`)`+
+		loanFrom+cond, append(args, today())...).Scan(&page.Total, &page.Active, &page.Overdue); err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if cmd.RowsAffected() == 0 {
-		bad(w, fmt.Errorf("not found"), 404)
-		return
+	if cur != nil {
+		args = append(args, cur.Value, cur.ID)
+		where = append(where, fmt.Sprintf("(%s, ab.id) %s ($%d::%s, $%d::uuid)", sort.expr, cmp, len(args)-1, sort.typ, len(args)))
+		cond = " WHERE " + strings.Join(where, " AND ")
 	}
-	writeJSON(w, DictRow{ID: id, Name: in.Name})
-}
-func (a *API) deleteDict(w http.ResponseWriter, r *http.Request, table string) {
-	id := chi.URLParam(r, "id")
-	cmd, err := a.db.Exec(context.Background(), fmt.Sprintf(`DELETE FROM %s WHERE id=$1`, table), id)
+	args = append(args, limit+1)
+	rows, err := a.db.Query(ctx, loanSelect+cond+
+		fmt.Sprintf(" ORDER BY %s %s, ab.id %s LIMIT $%d", sort.expr, dir, dir, len(args)), args...)
 	if err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if cmd.RowsAffected() == 0 {
-		bad(w, fmt.Errorf("not found"), 404)
+	if page.Items, err = scanLoans(rows); err != nil {
+		bad(w, err, 500)
 		return
 	}
-	w.WriteHeader(204)
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		next := loanCursor{Sort: sortName, Value: sort.key(last), ID: last.ID}.String()
+		page.NextCursor = &next
+	}
+	writeJSON(w, page)
 }
 
 func (a *API) listLoans(w http.ResponseWriter, r *http.Request) {
-	active := r.URL.Query().Get("active") == "true"
-	q := `
-SELECT
-  ab.id,
-  u.id, u.name,
-  b.id, b.name,
-  to_char(ab.date_issue,'DD/MM/YYYY'),
-  CASE WHEN ab.date_return IS NULL THEN NULL ELSE to_char(ab.date_return,'DD/MM/YYYY') END
-FROM accounting_books ab
-JOIN users u ON u.id = ab.user_id
-JOIN books b ON b.id = ab.book_id
-`
-	if active {
-		q += " WHERE ab.date_return IS NULL"
-	}
-	q += " ORDER BY ab.date_issue DESC, ab.id DESC LIMIT 300"
-
-	rows, err := a.db.Query(context.Background(), q)
+	where, args, err := loanFilters(r, nil, nil)
 	if err != nil {
-		bad(w, err, 500)
+		bad(w, err, 400)
 		return
 	}
-	defer rows.Close()
-
-	var out []LoanRow
-	for rows.Next() {
-		var lr LoanRow
-		if err := rows.Scan(&lr.ID, &lr.UserID, &lr.UserName, &lr.BookID, &lr.BookTitle, &lr.DateIssue, &lr.DateReturn); err != nil {
-			bad(w, err, 500)
-			return
-		}
-		out = append(out, lr)
-	}
-	writeJSON(w, out)
+	a.loanPage(w, r, where, args)
 }
 
+// issueBook: loan_type take_home (по умолчанию) или reading_room. Срок возврата
+// на дом — due_date из запроса или loanDays от выдачи, сдвинутый на ближайший
+// день, когда зал книги открыт; чтение в зале — возврат в тот же день.
 func (a *API) issueBook(w http.ResponseWriter, r *http.Request) {
 	var in struct {
 		UserID    string `json:"user_id"`
 		BookID    string `json:"book_id"`
+		IssueID   string `json:"issue_id"`
 		IssueDate string `json:"issue_date"`
+		DueDate   string `json:"due_date"`
+		LoanType  string `json:"loan_type"`
+		CopyID    string `json:"copy_id"`
+		Inventory string `json:"inventory_no"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		bad(w, err, 400)
 		return
 	}
-	if in.UserID == "" || in.BookID == "" {
-		bad(w, fmt.Errorf("user_id and book_id required"), 400)
+	if in.UserID == "" || (in.BookID == "") == (in.IssueID == "") {
+		bad(w, fmt.Errorf("user_id and one of book_id, issue_id required"), 400)
+		return
+	}
+	if in.LoanType == "" {
+		in.LoanType = lendTakeHome
+	}
+	if in.LoanType != lendTakeHome && in.LoanType != lendReadingRoom {
+		bad(w, fmt.Errorf("loan_type must be take_home or reading_room"), 400)
 		return
 	}
 	var d time.Time
 	var err error
 	if strings.TrimSpace(in.IssueDate) == "" {
-		d = time.Now()
+		d = today()
 	} else {
 		d, err = parseDDMMYYYY(in.IssueDate)
 		if err != nil {
@@ -670,14 +1243,92 @@ func (a *API) issueBook(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	ctx := context.Background()
+	var roomID, mode string
+	if in.IssueID != "" {
+		// номер журнала: зал и режим выдачи — от издания
+		err = a.db.QueryRow(ctx, `
+SELECT s.reading_room_id, s.lending_mode FROM serial_issues si JOIN serials s ON s.id = si.serial_id
+WHERE si.id=$1 AND si.status='received'`, in.IssueID).Scan(&roomID, &mode)
+	} else {
+		err = a.db.QueryRow(ctx, `SELECT reading_room_id, lending_mode FROM books WHERE id=$1`, in.BookID).Scan(&roomID, &mode)
+	}
+	if err != nil {
+		bad(w, fmt.Errorf("book not found"), 404)
+		return
+	}
+	if err := checkLendingMode(mode, in.LoanType); err != nil {
+		bad(w, err, 409)
+		return
+	}
+	var due time.Time
+	switch {
+	case in.LoanType == lendReadingRoom:
+		if strings.TrimSpace(in.DueDate) != "" {
+			bad(w, fmt.Errorf("due_date is not allowed for reading_room loans"), 400)
+			return
+		}
+		s, err := loadSchedule(ctx, a.db, roomID, d, d)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if !s.day(d).Open {
+			bad(w, fmt.Errorf("зал закрыт %s", dmy(d)), 409)
+			return
+		}
+		due = d
+	case strings.TrimSpace(in.DueDate) == "":
+		if due, err = dueDate(ctx, a.db, roomID, d); err != nil {
+			bad(w, err, 409)
+			return
+		}
+	default:
+		if due, err = parseDDMMYYYY(in.DueDate); err != nil {
+			bad(w, fmt.Errorf("due_date must be DD/MM/YYYY"), 400)
+			return
+		}
+		if due.Before(d) {
+			bad(w, fmt.Errorf("Срок возврата %s раньше даты выдачи %s", dmy(due), dmy(d)), 400)
+			return
+		}
+		s, err := loadSchedule(ctx, a.db, roomID, due, due)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if !s.day(due).Open {
+			bad(w, fmt.Errorf("зал закрыт %s", dmy(due)), 400)
+			return
+		}
+	}
+	var copyID, inv *string
+	if in.BookID != "" {
+		c, n, err := a.pickCopy(ctx, in.BookID, in.CopyID, in.Inventory)
+		if err != nil {
+			bad(w, err, 409)
+			return
+		}
+		copyID, inv = &c, &n
+	}
 	var id string
-	if err := a.db.QueryRow(context.Background(),
-		`INSERT INTO accounting_books(user_id, book_id, date_issue) VALUES($1,$2,$3) RETURNING id`,
-		in.UserID, in.BookID, d).Scan(&id); err != nil {
+	if err := a.db.QueryRow(ctx, `
+INSERT INTO accounting_books(user_id, book_id, issue_id, date_issue, date_due, loan_type, copy_id)
+VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`,
+		in.UserID, nullStr(in.BookID), nullStr(in.IssueID), d, due, in.LoanType, copyID).Scan(&id); err != nil {
+		var pe *pgconn.PgError
+		if errors.As(err, &pe) && pe.ConstraintName == "uniq_copy_active_loan" {
+			bad(w, fmt.Errorf("экземпляр %s уже выдан", *inv), 409)
+			return
+		}
+		if errors.As(err, &pe) && pe.ConstraintName == "uniq_user_active_issue" {
+			bad(w, fmt.Errorf("номер уже выдан этому читателю"), 409)
+			return
+		}
 		bad(w, err, 400)
 		return
 	}
-	writeJSON(w, map[string]string{"loan_id": id})
+	writeJSON(w, map[string]any{"loan_id": id, "date_due": dmy(due), "loan_type": in.LoanType, "copy_id": copyID, "inventory_no": inv})
 }
 
 func (a *API) returnBook(w http.ResponseWriter, r *http.Request) {
@@ -709,7 +1360,7 @@ func (a *API) returnBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd, err := a.db.Exec(context.Background(), `UPDATE accounting_books SET date_return=$2 WHERE id=$1`, in.LoanID, d)
+	cmd, err := a.db.Exec(context.Background(), `UPDATE accounting_books SET date_return=$2, overdue_days=greatest($2::date - date_due, 0) WHERE id=$1`, in.LoanID, d)
 	if err != nil {
 		bad(w, err, 400)
 		return
@@ -735,6 +1386,9 @@ func (a *API) deleteLoan(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 }
 
+// sessionTTL — срок жизни токена сотрудника.
+const sessionTTL = 12 * time.Hour
+
 func (a *API) login(w http.ResponseWriter, r *http.Request) {
 	var in struct {
 		Login    string `json:"login"`
@@ -747,9 +1401,9 @@ func (a *API) login(w http.ResponseWriter, r *http.Request) {
 
 	var e Employee
 	err := a.db.QueryRow(context.Background(),
-		`SELECT id, login, password_hash FROM employees WHERE login=$1`,
+		`SELECT id, login, password_hash, role FROM employees WHERE login=$1`,
 		in.Login,
-	).Scan(&e.ID, &e.Login, &e.PasswordHash)
+	).Scan(&e.ID, &e.Login, &e.PasswordHash, &e.Role)
 
 	if err != nil {
 		bad(w, fmt.Errorf("invalid credentials"), 401)
@@ -762,19 +1416,78 @@ func (a *API) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := context.Background()
 	token := uuid.NewString()
+	if _, err := a.db.Exec(ctx, `DELETE FROM employee_sessions WHERE expires_at < now()`); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := a.db.Exec(ctx,
+		`INSERT INTO employee_sessions(token, employee_id, expires_at) VALUES($1,$2,$3)`,
+		token, e.ID, time.Now().Add(sessionTTL)); err != nil {
+		bad(w, err, 500)
+		return
+	}
 	writeJSON(w, map[string]string{
 		"token": token,
+		"login": e.Login,
+		"role":  e.Role,
 	})
 }
 
+func (a *API) logout(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.db.Exec(context.Background(), `DELETE FROM employee_sessions WHERE token=$1`, authToken(r)); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+type ctxKey int
+
+const (
+	ctxEmployee ctxKey = iota
+	ctxReader
+)
+
+// currentEmployee — сотрудник, от имени которого выполняется запрос (после auth).
+func currentEmployee(r *http.Request) *Employee {
+	e, _ := r.Context().Value(ctxEmployee).(*Employee)
+	return e
+}
+
+func authToken(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	return strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+}
+
 func (a *API) auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := strings.TrimSpace(r.Header.Get("Authorization"))
+		token := authToken(r)
 		if token == "" {
 			http.Error(w, "unauthorized", 401)
 			return
 		}
+		var e Employee
+		err := a.db.QueryRow(r.Context(), `
+SELECT e.id, e.login, e.role FROM employee_sessions s
+JOIN employees e ON e.id = s.employee_id
+WHERE s.token=$1 AND s.expires_at > now()`, token).Scan(&e.ID, &e.Login, &e.Role)
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxEmployee, &e)))
+	})
+}
+
+// adminOnly пропускает только сотрудников с ролью admin.
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e := currentEmployee(r); e == nil || e.Role != "admin" {
+			http.Error(w, "forbidden", 403)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
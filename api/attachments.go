@@ -0,0 +1,392 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxUploadSize = 10 << 20
+	thumbSize     = 300
+	// предел размера изображения до декодирования: маленький файл может
+	// заявить огромные размеры и съесть память
+	maxImagePixels = 50_000_000
+)
+
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+type AttachmentRow struct {
+	ID        string  `json:"id"`
+	BookID    string  `json:"book_id"`
+	Kind      string  `json:"kind"`
+	Filename  string  `json:"filename"`
+	Mime      string  `json:"mime"`
+	Size      int     `json:"size"`
+	URL       string  `json:"url"`
+	ThumbURL  *string `json:"thumb_url,omitempty"`
+	CreatedAt string  `json:"created_at"`
+}
+
+const attachmentSelect = `
+SELECT id, book_id, kind, filename, mime, size, thumb_key IS NOT NULL, to_char(created_at,'DD/MM/YYYY HH24:MI')
+FROM book_attachments
+`
+
+func scanAttachment(row interface{ Scan(...any) error }) (AttachmentRow, error) {
+	var at AttachmentRow
+	var hasThumb bool
+	if err := row.Scan(&at.ID, &at.BookID, &at.Kind, &at.Filename, &at.Mime, &at.Size, &hasThumb, &at.CreatedAt); err != nil {
+		return at, err
+	}
+	at.URL = "/api/attachments/" + at.ID
+	if hasThumb {
+		t := at.URL + "/thumb"
+		at.ThumbURL = &t
+	}
+	return at, nil
+}
+
+// readUpload принимает multipart-поле "file" либо сырое тело с ?filename=.
+func readUpload(w http.ResponseWriter, r *http.Request) (string, []byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+1<<20)
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "multipart/form-data" {
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			return "", nil, err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, maxUploadSize+1))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(data) > maxUploadSize {
+			return "", nil, fmt.Errorf("file is larger than %d MB", maxUploadSize>>20)
+		}
+		return path.Base(hdr.Filename), data, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxUploadSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) > maxUploadSize {
+		return "", nil, fmt.Errorf("file is larger than %d MB", maxUploadSize>>20)
+	}
+	name := r.URL.Query().Get("filename")
+	if name == "" {
+		name = "upload"
+	}
+	return path.Base(name), data, nil
+}
+
+// makeThumbnail уменьшает изображение усреднением по площади и кодирует в JPEG.
+// Прозрачные области заливаются белым.
+func makeThumbnail(data []byte, max int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxImagePixels/cfg.Height {
+		return nil, fmt.Errorf("image %dx%d is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, errors.New("empty image")
+	}
+	tw, th := w, h
+	if w > max || h > max {
+		if w >= h {
+			tw, th = max, h*max/w
+		} else {
+			tw, th = w*max/h, max
+		}
+		tw, th = maxInt(tw, 1), maxInt(th, 1)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			if x1 == x0 {
+				x1++
+			}
+			var sr, sg, sb, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, a := src.At(sx, sy).RGBA()
+					sr += uint64(r + 0xffff - a)
+					sg += uint64(g + 0xffff - a)
+					sb += uint64(bl + 0xffff - a)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(sr / n), G: uint16(sg / n), B: uint16(sb / n), A: 0xffff})
+		}
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (a *API) uploadCover(w http.ResponseWriter, r *http.Request) {
+	a.uploadAttachment(w, r, "cover")
+}
+
+func (a *API) uploadBookAttachment(w http.ResponseWriter, r *http.Request) {
+	a.uploadAttachment(w, r, "attachment")
+}
+
+func (a *API) uploadAttachment(w http.ResponseWriter, r *http.Request, kind string) {
+	if a.blobs == nil {
+		bad(w, fmt.Errorf("file storage is not configured"), 501)
+		return
+	}
+	bookID := chi.URLParam(r, "id")
+	name, data, err := readUpload(w, r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctype := http.DetectContentType(data)
+	if i := strings.IndexByte(ctype, ';'); i >= 0 {
+		ctype = ctype[:i]
+	}
+	allowed := attachmentTypes
+	if kind == "cover" {
+		allowed = imageTypes
+	}
+	ext, ok := allowed[ctype]
+	if !ok {
+		bad(w, fmt.Errorf("unsupported file type %s", ctype), 415)
+		return
+	}
+
+	ctx := context.Background()
+	var exists bool
+	if err := a.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM books WHERE id=$1)`, bookID).Scan(&exists); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if !exists {
+		bad(w, fmt.Errorf("book not found"), 404)
+		return
+	}
+
+	var thumb []byte
+	if _, isImage := imageTypes[ctype]; isImage {
+		if thumb, err = makeThumbnail(data, thumbSize); err != nil {
+			bad(w, fmt.Errorf("cannot decode image: %w", err), 400)
+			return
+		}
+	}
+
+	base := "books/" + bookID + "/" + uuid.NewString()
+	key := base + ext
+	var thumbKey *string
+	if err := a.blobs.Put(ctx, key, data, ctype); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if thumb != nil {
+		tk := base + "_thumb.jpg"
+		if err := a.blobs.Put(ctx, tk, thumb, "image/jpeg"); err != nil {
+			_ = a.blobs.Delete(ctx, key)
+			bad(w, err, 500)
+			return
+		}
+		thumbKey = &tk
+	}
+	cleanup := func() {
+		_ = a.blobs.Delete(ctx, key)
+		if thumbKey != nil {
+			_ = a.blobs.Delete(ctx, *thumbKey)
+		}
+	}
+
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		cleanup()
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var oldKeys []string
+	if kind == "cover" {
+		var oldKey string
+		var oldThumb *string
+		err := tx.QueryRow(ctx, `DELETE FROM book_attachments WHERE book_id=$1 AND kind='cover' RETURNING storage_key, thumb_key`, bookID).
+			Scan(&oldKey, &oldThumb)
+		if err == nil {
+			oldKeys = append(oldKeys, oldKey)
+			if oldThumb != nil {
+				oldKeys = append(oldKeys, *oldThumb)
+			}
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			cleanup()
+			bad(w, err, 500)
+			return
+		}
+	}
+	at, err := scanAttachment(tx.QueryRow(ctx, `
+INSERT INTO book_attachments(book_id, kind, filename, mime, size, storage_key, thumb_key)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+RETURNING id, book_id, kind, filename, mime, size, thumb_key IS NOT NULL, to_char(created_at,'DD/MM/YYYY HH24:MI')`,
+		bookID, kind, name, ctype, len(data), key, thumbKey))
+	if err != nil {
+		cleanup()
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		cleanup()
+		bad(w, err, 500)
+		return
+	}
+	for _, k := range oldKeys {
+		_ = a.blobs.Delete(ctx, k)
+	}
+	writeJSON(w, at)
+}
+
+func (a *API) listBookAttachments(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), attachmentSelect+"WHERE book_id=$1 ORDER BY kind DESC, created_at", chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []AttachmentRow{}
+	for rows.Next() {
+		at, err := scanAttachment(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, at)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) serveBlob(w http.ResponseWriter, r *http.Request, q string, thumb bool, arg string) {
+	if a.blobs == nil {
+		bad(w, fmt.Errorf("file storage is not configured"), 501)
+		return
+	}
+	var key *string
+	var name, ctype string
+	var size int
+	err := a.db.QueryRow(context.Background(), q, arg).Scan(&key, &name, &ctype, &size)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && key == nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	rc, err := a.blobs.Get(r.Context(), *key)
+	if errors.Is(err, ErrBlobNotFound) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rc.Close()
+	if thumb {
+		ctype = "image/jpeg"
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	_, _ = io.Copy(w, rc)
+}
+
+func (a *API) getAttachment(w http.ResponseWriter, r *http.Request) {
+	a.serveBlob(w, r, `SELECT storage_key, filename, mime, size FROM book_attachments WHERE id=$1`, false, chi.URLParam(r, "id"))
+}
+
+func (a *API) getAttachmentThumb(w http.ResponseWriter, r *http.Request) {
+	a.serveBlob(w, r, `SELECT thumb_key, filename, mime, size FROM book_attachments WHERE id=$1`, true, chi.URLParam(r, "id"))
+}
+
+// Обложки отдаются без авторизации, чтобы их можно было вставлять в <img>.
+func (a *API) getCover(w http.ResponseWriter, r *http.Request) {
+	a.serveBlob(w, r, `SELECT storage_key, filename, mime, size FROM book_attachments WHERE book_id=$1 AND kind='cover'`, false, chi.URLParam(r, "id"))
+}
+
+func (a *API) getCoverThumb(w http.ResponseWriter, r *http.Request) {
+	a.serveBlob(w, r, `SELECT thumb_key, filename, mime, size FROM book_attachments WHERE book_id=$1 AND kind='cover'`, true, chi.URLParam(r, "id"))
+}
+
+func (a *API) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var key string
+	var thumbKey *string
+	err := a.db.QueryRow(ctx, `DELETE FROM book_attachments WHERE id=$1 RETURNING storage_key, thumb_key`, chi.URLParam(r, "id")).
+		Scan(&key, &thumbKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if a.blobs != nil {
+		_ = a.blobs.Delete(ctx, key)
+		if thumbKey != nil {
+			_ = a.blobs.Delete(ctx, *thumbKey)
+		}
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	out, err := makeThumbnail(encodePNG(t, 600, 400), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 200 {
+		t.Errorf("thumbnail is %dx%d, want 300x200", b.Dx(), b.Dy())
+	}
+}
+
+// Маленький PNG, заявляющий в IHDR огромные размеры, отклоняется до декодирования.
+func TestMakeThumbnailRejectsHugeImage(t *testing.T) {
+	data := encodePNG(t, 1, 1)
+	// сигнатура (8) + длина (4) + "IHDR" (4), затем ширина и высота
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if _, err := makeThumbnail(data, 300); err == nil {
+		t.Fatal("expected error for oversized image")
+	}
+}
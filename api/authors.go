@@ -0,0 +1,514 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type PersonName struct {
+	Surname    string `json:"surname"`
+	GivenNames string `json:"given_names"`
+	Patronymic string `json:"patronymic"`
+}
+
+type AuthorRow struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	PersonName
+	BirthYear *int     `json:"birth_year,omitempty"`
+	DeathYear *int     `json:"death_year,omitempty"`
+	AltNames  []string `json:"alt_names"`
+	FullName  string   `json:"full_name"`
+	ShortName string   `json:"short_name"`
+	LifeDates string   `json:"life_dates,omitempty"`
+}
+
+func isCyrillic(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInitial(tok string) bool {
+	n := len([]rune(strings.TrimSuffix(tok, ".")))
+	return n == 1 || n <= 2 && strings.HasSuffix(tok, ".")
+}
+
+// splitNameParts делит строку на слова, разбивая слитные инициалы: "А.С." -> "А.", "С.".
+func splitNameParts(s string) []string {
+	var out []string
+	for _, f := range strings.Fields(s) {
+		if strings.Count(f, ".") > 1 {
+			for _, p := range strings.SplitAfter(f, ".") {
+				if p != "" {
+					out = append(out, p)
+				}
+			}
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// ParseAuthorName раскладывает имя из каталога на фамилию, имя и отчество.
+// Понимает "Пушкин А.С.", "Пушкин Александр Сергеевич", "А.С. Пушкин",
+// "Hunt, Andrew" и "Andrew Hunt".
+func ParseAuthorName(s string) PersonName {
+	s = strings.TrimSpace(s)
+	cyr := isCyrillic(s)
+	var p PersonName
+	var rest []string
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		p.Surname = strings.TrimSpace(s[:i])
+		rest = splitNameParts(s[i+1:])
+	} else {
+		parts := splitNameParts(s)
+		switch {
+		case len(parts) == 0:
+			return p
+		case len(parts) == 1:
+			return PersonName{Surname: parts[0]}
+		case !isInitial(parts[0]) && allInitials(parts[1:]):
+			p.Surname, rest = parts[0], parts[1:]
+		case allInitials(parts[:len(parts)-1]):
+			p.Surname, rest = parts[len(parts)-1], parts[:len(parts)-1]
+		case cyr:
+			p.Surname, rest = parts[0], parts[1:]
+		default:
+			p.Surname, rest = parts[len(parts)-1], parts[:len(parts)-1]
+		}
+	}
+	if cyr && len(rest) == 2 {
+		p.GivenNames, p.Patronymic = rest[0], rest[1]
+	} else {
+		p.GivenNames = strings.Join(rest, " ")
+	}
+	return p
+}
+
+func allInitials(parts []string) bool {
+	for _, p := range parts {
+		if !isInitial(p) {
+			return false
+		}
+	}
+	return len(parts) > 0
+}
+
+func nameInitials(p PersonName) string {
+	var b strings.Builder
+	for _, w := range append(strings.Fields(p.GivenNames), strings.Fields(p.Patronymic)...) {
+		r := []rune(w)
+		b.WriteString(string(r[0]) + ".")
+	}
+	return b.String()
+}
+
+// FormatAuthorName: "full" — "Пушкин Александр Сергеевич", "short" — "Пушкин А.С.",
+// "initials_first" — "А.С. Пушкин".
+func FormatAuthorName(p PersonName, style string) string {
+	switch style {
+	case "full":
+		return strings.Join(strings.Fields(p.Surname+" "+p.GivenNames+" "+p.Patronymic), " ")
+	case "initials_first":
+		return strings.TrimSpace(nameInitials(p) + " " + p.Surname)
+	default:
+		return strings.TrimSpace(p.Surname + " " + nameInitials(p))
+	}
+}
+
+func (ar *AuthorRow) fill() {
+	ar.FullName = FormatAuthorName(ar.PersonName, "full")
+	ar.ShortName = FormatAuthorName(ar.PersonName, "short")
+	ar.LifeDates = ""
+	if ar.BirthYear != nil || ar.DeathYear != nil {
+		b, d := "?", ""
+		if ar.BirthYear != nil {
+			b = strconv.Itoa(*ar.BirthYear)
+		}
+		if ar.DeathYear != nil {
+			d = strconv.Itoa(*ar.DeathYear)
+		}
+		ar.LifeDates = b + "–" + d
+	}
+	if ar.AltNames == nil {
+		ar.AltNames = []string{}
+	}
+}
+
+const authorSelect = `
+SELECT id, name, coalesce(surname,''), coalesce(given_names,''), coalesce(patronymic,''),
+       birth_year, death_year, alt_names
+FROM book_authors
+`
+
+func scanAuthor(row interface{ Scan(...any) error }) (AuthorRow, error) {
+	var ar AuthorRow
+	err := row.Scan(&ar.ID, &ar.Name, &ar.Surname, &ar.GivenNames, &ar.Patronymic, &ar.BirthYear, &ar.DeathYear, &ar.AltNames)
+	if err != nil {
+		return ar, err
+	}
+	if ar.Surname == "" {
+		ar.PersonName = ParseAuthorName(ar.Name)
+	}
+	ar.fill()
+	return ar, nil
+}
+
+func (a *API) queryAuthors(where string, args ...any) ([]AuthorRow, error) {
+	rows, err := a.db.Query(context.Background(), authorSelect+where+" ORDER BY name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AuthorRow
+	for rows.Next() {
+		ar, err := scanAuthor(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ar)
+	}
+	return out, rows.Err()
+}
+
+func strVal(v any) string {
+	if s, ok := v.(*string); ok && s != nil {
+		return *s
+	}
+	return ""
+}
+
+func nullStr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// prepareAuthor дополняет структурные поля из name и наоборот. Если изменили
+// только name, части имени разбираются заново; если только части — name
+// пересобирается в коротком виде.
+func prepareAuthor(v dictValues, set map[string]bool) error {
+	name, _ := v["name"].(string)
+	p := PersonName{Surname: strVal(v["surname"]), GivenNames: strVal(v["given_names"]), Patronymic: strVal(v["patronymic"])}
+	structured := set["surname"] || set["given_names"] || set["patronymic"]
+	switch {
+	case name == "" && p.Surname == "":
+		return fmt.Errorf("name required")
+	case p.Surname == "" || set["name"] && !structured:
+		p = ParseAuthorName(name)
+	case name == "" || structured && !set["name"]:
+		name = FormatAuthorName(p, "short")
+	}
+	birth, _ := v["birth_year"].(*int)
+	death, _ := v["death_year"].(*int)
+	if birth != nil && death != nil && *death < *birth {
+		return fmt.Errorf("death_year before birth_year")
+	}
+	alt := []string{}
+	seen := map[string]bool{name: true}
+	old, _ := v["alt_names"].([]string)
+	for _, n := range old {
+		if n = strings.TrimSpace(n); n != "" && !seen[n] {
+			seen[n] = true
+			alt = append(alt, n)
+		}
+	}
+	v["name"] = name
+	v["surname"] = nullStr(p.Surname)
+	v["given_names"] = nullStr(p.GivenNames)
+	v["patronymic"] = nullStr(p.Patronymic)
+	v["alt_names"] = alt
+	return nil
+}
+
+func decorateAuthor(v dictValues) {
+	ar := AuthorRow{
+		PersonName: PersonName{Surname: strVal(v["surname"]), GivenNames: strVal(v["given_names"]), Patronymic: strVal(v["patronymic"])},
+	}
+	ar.BirthYear, _ = v["birth_year"].(*int)
+	ar.DeathYear, _ = v["death_year"].(*int)
+	if ar.Surname == "" {
+		name, _ := v["name"].(string)
+		ar.PersonName = ParseAuthorName(name)
+		v["surname"] = nullStr(ar.Surname)
+		v["given_names"] = nullStr(ar.GivenNames)
+		v["patronymic"] = nullStr(ar.Patronymic)
+	}
+	ar.fill()
+	v["full_name"] = ar.FullName
+	v["short_name"] = ar.ShortName
+	if ar.LifeDates != "" {
+		v["life_dates"] = ar.LifeDates
+	}
+}
+
+// mergeIDs — id присоединяемых записей без пустых, повторов и самой цели,
+// чтобы их число совпадало с числом заблокированных строк.
+func mergeIDs(target string, ids []string) []string {
+	seen := map[string]bool{target: true, "": true}
+	var out []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// mergeConflict объясняет нарушение уникальности при слиянии авторов.
+func mergeConflict(pe *pgconn.PgError) error {
+	if pe.ConstraintName == "unique_book" {
+		return fmt.Errorf("merge would create duplicate books: %s", pe.Detail)
+	}
+	return fmt.Errorf("merge conflicts with %s on %s: %s", pe.ConstraintName, pe.TableName, pe.Detail)
+}
+
+// mergeAuthors переносит книги (основной автор и соавторы) с дублей на автора {id},
+// добавляет их написания в alt_names и удаляет дубли — всё в одной транзакции.
+func (a *API) mergeAuthors(w http.ResponseWriter, r *http.Request) {
+	target := chi.URLParam(r, "id")
+	var in struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dups := mergeIDs(target, in.IDs)
+	if len(dups) == 0 {
+		bad(w, fmt.Errorf("ids of duplicate authors required"), 400)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var locked int
+	if err := tx.QueryRow(ctx, `
+SELECT count(*) FROM (SELECT id FROM book_authors WHERE id = $1 OR id = ANY($2::uuid[]) FOR UPDATE) t`,
+		target, dups).Scan(&locked); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if locked != len(dups)+1 {
+		bad(w, fmt.Errorf("author not found"), 404)
+		return
+	}
+
+	steps := []string{
+		`INSERT INTO book_coauthors(book_id, author_id, position)
+		 SELECT book_id, $1, min(position) FROM book_coauthors WHERE author_id = ANY($2::uuid[]) GROUP BY book_id
+		 ON CONFLICT DO NOTHING`,
+		`DELETE FROM book_coauthors WHERE author_id = ANY($2::uuid[])`,
+		`UPDATE books SET author_id = $1 WHERE author_id = ANY($2::uuid[])`,
+		`DELETE FROM book_coauthors bc USING books b WHERE b.id = bc.book_id AND b.author_id = bc.author_id AND bc.author_id = $1`,
+		`UPDATE book_authors t
+		 SET alt_names = (SELECT coalesce(array_agg(DISTINCT n), '{}')
+		                  FROM (SELECT unnest(t.alt_names) n
+		                        UNION SELECT name FROM book_authors WHERE id = ANY($2::uuid[])
+		                        UNION SELECT unnest(alt_names) FROM book_authors WHERE id = ANY($2::uuid[])) v
+		                  WHERE n <> t.name),
+		     birth_year = coalesce(t.birth_year, (SELECT max(birth_year) FROM book_authors WHERE id = ANY($2::uuid[]))),
+		     death_year = coalesce(t.death_year, (SELECT max(death_year) FROM book_authors WHERE id = ANY($2::uuid[])))
+		 WHERE t.id = $1`,
+		`UPDATE works SET author_id = $1 WHERE author_id = ANY($2::uuid[])`,
+		`DELETE FROM book_authors WHERE id = ANY($2::uuid[])`,
+	}
+	var moved int64
+	for i, q := range steps {
+		cmd, err := tx.Exec(ctx, q, target, dups)
+		if err != nil {
+			var pe *pgconn.PgError
+			if errors.As(err, &pe) && pe.Code == "23505" {
+				bad(w, mergeConflict(pe), 409)
+				return
+			}
+			bad(w, err, 400)
+			return
+		}
+		if i == 2 {
+			moved = cmd.RowsAffected()
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+
+	ar, err := scanAuthor(a.db.QueryRow(ctx, authorSelect+"WHERE id=$1", target))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, map[string]any{"author": ar, "books_moved": moved, "merged": dups})
+}
+
+type authorKey struct {
+	surname  string
+	initials string
+}
+
+func authorKeys(ar AuthorRow) []authorKey {
+	names := []PersonName{ar.PersonName}
+	for _, n := range ar.AltNames {
+		names = append(names, ParseAuthorName(n))
+	}
+	var out []authorKey
+	for _, p := range names {
+		out = append(out, authorKey{
+			surname:  normName(p.Surname),
+			initials: strings.ReplaceAll(normName(nameInitials(p)), ".", ""),
+		})
+	}
+	return out
+}
+
+func normName(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "ё", "е")
+}
+
+// levenshtein по рунам.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// authorSimilarity: 1 — совпали фамилия и инициалы, меньше — инициалы неполные
+// или фамилия отличается опечаткой. 0 — не похожи.
+func authorSimilarity(x, y AuthorRow) float64 {
+	best := 0.0
+	for _, kx := range authorKeys(x) {
+		for _, ky := range authorKeys(y) {
+			if kx.surname == "" || ky.surname == "" {
+				continue
+			}
+			score := 1.0
+			if kx.surname != ky.surname {
+				d := levenshtein(kx.surname, ky.surname)
+				if d > 1 || len([]rune(kx.surname)) < 5 {
+					continue
+				}
+				score -= 0.15
+			}
+			switch {
+			case kx.initials == ky.initials:
+			case strings.HasPrefix(kx.initials, ky.initials) || strings.HasPrefix(ky.initials, kx.initials):
+				score -= 0.1
+			default:
+				continue
+			}
+			if score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+// authorCandidates — пары авторов (i < j), которые стоит сравнивать: с общей
+// фамилией или фамилиями на расстоянии одной правки. Такие фамилии совпадают
+// после удаления не больше одной буквы из каждой, поэтому авторы
+// раскладываются по корзинам фамилии и всех её вариантов без одной буквы.
+func authorCandidates(all []AuthorRow) [][2]int {
+	buckets := map[string][]int{}
+	for i, ar := range all {
+		keys := map[string]bool{}
+		for _, k := range authorKeys(ar) {
+			r := []rune(k.surname)
+			if len(r) == 0 {
+				continue
+			}
+			keys[k.surname] = true
+			for d := range r {
+				keys[string(r[:d])+string(r[d+1:])] = true
+			}
+		}
+		for k := range keys {
+			buckets[k] = append(buckets[k], i)
+		}
+	}
+	seen := map[[2]int]bool{}
+	var out [][2]int
+	for _, idx := range buckets {
+		for x := range idx {
+			for y := x + 1; y < len(idx); y++ {
+				p := [2]int{idx[x], idx[y]}
+				if !seen[p] {
+					seen[p] = true
+					out = append(out, p)
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i][0] != out[j][0] {
+			return out[i][0] < out[j][0]
+		}
+		return out[i][1] < out[j][1]
+	})
+	return out
+}
+
+func (a *API) authorDuplicates(w http.ResponseWriter, r *http.Request) {
+	minScore := 0.7
+	if v, err := strconv.ParseFloat(r.URL.Query().Get("min_score"), 64); err == nil {
+		minScore = v
+	}
+	all, err := a.queryAuthors("")
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	type pair struct {
+		A     AuthorRow `json:"a"`
+		B     AuthorRow `json:"b"`
+		Score float64   `json:"score"`
+	}
+	out := []pair{}
+	for _, c := range authorCandidates(all) {
+		i, j := c[0], c[1]
+		if s := authorSimilarity(all[i], all[j]); s >= minScore {
+			out = append(out, pair{A: all[i], B: all[j], Score: s})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	writeJSON(w, out)
+}
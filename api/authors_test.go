@@ -0,0 +1,132 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestParseAuthorName(t *testing.T) {
+	for in, want := range map[string]PersonName{
+		"Пушкин А.С.":                 {Surname: "Пушкин", GivenNames: "А.", Patronymic: "С."},
+		"Пушкин А. С.":                {Surname: "Пушкин", GivenNames: "А.", Patronymic: "С."},
+		"А.С. Пушкин":                 {Surname: "Пушкин", GivenNames: "А.", Patronymic: "С."},
+		"Пушкин Александр Сергеевич":  {Surname: "Пушкин", GivenNames: "Александр", Patronymic: "Сергеевич"},
+		"Пушкин, Александр Сергеевич": {Surname: "Пушкин", GivenNames: "Александр", Patronymic: "Сергеевич"},
+		"Буч":               {Surname: "Буч"},
+		"Hunt, Andrew":      {Surname: "Hunt", GivenNames: "Andrew"},
+		"Andrew Hunt":       {Surname: "Hunt", GivenNames: "Andrew"},
+		"Hunt A.":           {Surname: "Hunt", GivenNames: "A."},
+		"J.R.R. Tolkien":    {Surname: "Tolkien", GivenNames: "J. R. R."},
+		"Ursula K. Le Guin": {Surname: "Guin", GivenNames: "Ursula K. Le"},
+		"  ":                {},
+	} {
+		if got := ParseAuthorName(in); got != want {
+			t.Errorf("%q: got %+v, want %+v", in, got, want)
+		}
+	}
+}
+
+func TestFormatAuthorName(t *testing.T) {
+	p := PersonName{Surname: "Пушкин", GivenNames: "Александр", Patronymic: "Сергеевич"}
+	for style, want := range map[string]string{
+		"full":           "Пушкин Александр Сергеевич",
+		"short":          "Пушкин А.С.",
+		"initials_first": "А.С. Пушкин",
+		"":               "Пушкин А.С.",
+	} {
+		if got := FormatAuthorName(p, style); got != want {
+			t.Errorf("%q: got %q, want %q", style, got, want)
+		}
+	}
+	// разбор и сборка сходятся для коротких форм
+	for _, s := range []string{"Пушкин А.С.", "Hunt A."} {
+		if got := FormatAuthorName(ParseAuthorName(s), "short"); got != s {
+			t.Errorf("round trip %q: got %q", s, got)
+		}
+	}
+	if got := FormatAuthorName(PersonName{Surname: "Буч"}, "initials_first"); got != "Буч" {
+		t.Errorf("surname only: %q", got)
+	}
+}
+
+func author(name string, alt ...string) AuthorRow {
+	return AuthorRow{Name: name, PersonName: ParseAuthorName(name), AltNames: alt}
+}
+
+func TestAuthorKeys(t *testing.T) {
+	got := authorKeys(author("Пушкин Александр Сергеевич", "Пушкин А.С.", "ПУШКИН А."))
+	want := []authorKey{{"пушкин", "ас"}, {"пушкин", "ас"}, {"пушкин", "а"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := normName("  Алёшин "); got != "алешин" {
+		t.Errorf("normName: %q", got)
+	}
+}
+
+func TestAuthorSimilarity(t *testing.T) {
+	for _, c := range []struct {
+		a, b AuthorRow
+		want float64
+	}{
+		{author("Пушкин А.С."), author("Пушкин Александр Сергеевич"), 1},
+		{author("А.С. Пушкин"), author("Пушкин А. С."), 1},
+		{author("Пушкин А."), author("Пушкин Александр Сергеевич"), 0.9},
+		{author("Пушкен А.С."), author("Пушкин А.С."), 0.85},
+		{author("Алёшин В.П."), author("Алешин В.П."), 1},
+		{author("Пушкин А.С."), author("Пушкин В.Л."), 0},
+		// короткие фамилии опечаткой не считаются
+		{author("Буч Г."), author("Бух Г."), 0},
+		{author("Hunt, Andrew"), author("Andrew Hunt"), 1},
+		{author("Hunt A."), author("Hunt, Andrew"), 1},
+		{author("Thomas, David"), author("Thomas, Dylan"), 1},
+		{author("Thomas, David"), author("Thomas, Bob"), 0},
+		{author("Hunt, Andrew"), author("Thomas, David"), 0},
+		// совпадение по альтернативному написанию
+		{author("Hunt, Andrew", "Хант Э."), author("Хант Эндрю"), 1},
+	} {
+		got := authorSimilarity(c.a, c.b)
+		if d := got - c.want; d > 1e-9 || d < -1e-9 {
+			t.Errorf("%q vs %q: got %v, want %v", c.a.Name, c.b.Name, got, c.want)
+		}
+	}
+}
+
+func TestAuthorCandidates(t *testing.T) {
+	all := []AuthorRow{
+		author("Пушкин А.С."),
+		author("Иванов И.И."),
+		author("Пушкен А.С."),
+		author("Петров П.П."),
+		author("Иванова М.И."),
+		author("Hunt, Andrew", "Пушкин А."),
+	}
+	want := [][2]int{{0, 2}, {0, 5}, {1, 4}, {2, 5}}
+	if got := authorCandidates(all); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeIDs(t *testing.T) {
+	got := mergeIDs("t", []string{"a", "", "t", "b", "a"})
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := mergeIDs("t", []string{"t", ""}); len(got) != 0 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestMergeConflict(t *testing.T) {
+	books := mergeConflict(&pgconn.PgError{Code: "23505", ConstraintName: "unique_book", TableName: "books", Detail: "Key (...) already exists."})
+	if !strings.Contains(books.Error(), "duplicate books") {
+		t.Errorf("unique_book: %v", books)
+	}
+	other := mergeConflict(&pgconn.PgError{Code: "23505", ConstraintName: "uniq_works_author_title", TableName: "works", Detail: "Key (...) already exists."})
+	if strings.Contains(other.Error(), "duplicate books") || !strings.Contains(other.Error(), "uniq_works_author_title") {
+		t.Errorf("other constraint: %v", other)
+	}
+}
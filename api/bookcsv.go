@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Импорт книг из CSV (в том числе сохранённого русским Excel: BOM и «;»).
+// Первая строка — заголовки: title, author, place, publisher, year
+// (обязательные), pages, isbn; регистр не важен, прочие колонки пропускаются.
+// Справочники сопоставляются и пополняются так же, как при импорте MARC.
+
+var csvBookRequired = []string{"title", "author", "place", "publisher", "year"}
+
+// csvBook — строка файла: книга или причина, по которой её не импортировать.
+type csvBook struct {
+	Line int
+	Book marcBook
+	Err  error
+}
+
+func parseBookCSV(data []byte) ([]csvBook, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	head, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(head, []byte(";")) > bytes.Count(head, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range csvBookRequired {
+		if _, ok := col[c]; !ok {
+			return nil, fmt.Errorf("column %q required", c)
+		}
+	}
+
+	var out []csvBook
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		row := csvBook{Line: line, Book: marcBook{
+			Title:     get("title"),
+			Author:    get("author"),
+			Place:     get("place"),
+			Publisher: get("publisher"),
+		}}
+		for _, c := range csvBookRequired {
+			if get(c) == "" {
+				row.Err = fmt.Errorf("%s required", c)
+				break
+			}
+		}
+		if row.Err == nil {
+			if row.Book.Year, err = strconv.Atoi(get("year")); err != nil {
+				row.Err = fmt.Errorf("bad year %q", get("year"))
+			}
+		}
+		if v := get("pages"); v != "" && row.Err == nil {
+			if row.Book.Pages, err = strconv.Atoi(v); err != nil || row.Book.Pages <= 0 {
+				row.Err = fmt.Errorf("bad pages %q", v)
+			}
+		}
+		if v := get("isbn"); v != "" && row.Err == nil {
+			if row.Book.ISBN, err = NormalizeISBN(v); err != nil {
+				row.Err = fmt.Errorf("%w %q", err, v)
+			}
+		}
+		out = append(out, row)
+	}
+}
+
+// importBooksCSV: ?group_id=&room_id= — раздел и зал для всех книг файла.
+func (a *API) importBooksCSV(w http.ResponseWriter, r *http.Request) {
+	groupID := r.URL.Query().Get("group_id")
+	roomID := r.URL.Query().Get("room_id")
+	if groupID == "" || roomID == "" {
+		bad(w, fmt.Errorf("group_id and room_id required"), 400)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 32<<20))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	rows, err := parseBookCSV(data)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+
+	type skipped struct {
+		Line  int    `json:"line"`
+		Title string `json:"title"`
+		Error string `json:"error"`
+	}
+	res := struct {
+		Imported []string  `json:"imported"`
+		Skipped  []skipped `json:"skipped"`
+	}{Imported: []string{}, Skipped: []skipped{}}
+
+	ctx := context.Background()
+	for _, row := range rows {
+		err := row.Err
+		if err == nil {
+			var id string
+			if id, err = a.importMarcBook(ctx, row.Book, groupID, roomID); err == nil {
+				res.Imported = append(res.Imported, id)
+				continue
+			}
+		}
+		res.Skipped = append(res.Skipped, skipped{Line: row.Line, Title: row.Book.Title, Error: err.Error()})
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBookCSV(t *testing.T) {
+	// как сохраняет русский Excel: BOM, «;», лишняя колонка
+	data := "\ufeffTitle;Author;Place;Publisher;Year;Pages;ISBN;Полка\r\n" +
+		"Евгений Онегин;Пушкин А.С.;Москва;Эксмо;2006;352;5-699-12014-9;3\r\n" +
+		"Без ISBN;Пушкин А.С.;Москва;Эксмо;2006;;;\r\n" +
+		"Плохой ISBN;Пушкин А.С.;Москва;Эксмо;2006;;5-699-12014-0;\r\n" +
+		"Без года;Пушкин А.С.;Москва;Эксмо;;;;\r\n" +
+		"\"Кавычки; и точка с запятой\";Пушкин А.С.;Москва;Эксмо;1999;-5;;\r\n"
+	rows, err := parseBookCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	want := marcBook{Title: "Евгений Онегин", Author: "Пушкин А.С.", Place: "Москва", Publisher: "Эксмо",
+		Year: 2006, Pages: 352, ISBN: "9785699120147"}
+	if rows[0].Err != nil || !reflect.DeepEqual(rows[0].Book, want) || rows[0].Line != 2 {
+		t.Errorf("row 1: %+v", rows[0])
+	}
+	if rows[1].Err != nil || rows[1].Book.ISBN != "" {
+		t.Errorf("row 2: %+v", rows[1])
+	}
+	for i, line := range []int{4, 5, 6} {
+		if r := rows[i+2]; r.Err == nil || r.Line != line {
+			t.Errorf("line %d: expected error, got %+v", line, r)
+		}
+	}
+	if rows[4].Book.Title != "Кавычки; и точка с запятой" {
+		t.Errorf("quoted title %q", rows[4].Book.Title)
+	}
+
+	rows, err = parseBookCSV([]byte("title,author,place,publisher,year\nThe pragmatic programmer,\"Hunt, Andrew\",\"Reading, Mass.\",Addison-Wesley,1999\n"))
+	if err != nil || len(rows) != 1 || rows[0].Err != nil || rows[0].Book.Author != "Hunt, Andrew" || rows[0].Book.Year != 1999 {
+		t.Errorf("comma-separated: %+v %v", rows, err)
+	}
+	if _, err := parseBookCSV([]byte("title;author;year\n")); err == nil {
+		t.Error("expected error for missing columns")
+	}
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+var classSchemes = map[string]bool{"udc": true, "bbk": true, "local": true}
+
+type ClassRow struct {
+	ID       string      `json:"id"`
+	Scheme   string      `json:"scheme"`
+	Code     *string     `json:"code,omitempty"`
+	Name     string      `json:"name"`
+	ParentID *string     `json:"parent_id,omitempty"`
+	Books    int         `json:"books"`
+	Children []*ClassRow `json:"children,omitempty"`
+}
+
+type ClassRef struct {
+	ID     string  `json:"id"`
+	Scheme string  `json:"scheme"`
+	Code   *string `json:"code,omitempty"`
+	Name   string  `json:"name"`
+}
+
+// classSubtree — рекурсивный CTE sub со всеми узлами, подходящими под cond,
+// и их потомками.
+func classSubtree(cond string) string {
+	return `
+WITH RECURSIVE sub AS (
+  SELECT id FROM classifications WHERE ` + cond + `
+  UNION ALL
+  SELECT c.id FROM classifications c JOIN sub ON c.parent_id = sub.id
+)`
+}
+
+const classSelect = `
+SELECT c.id, c.scheme, c.code, c.name, c.parent_id,
+       (SELECT count(*) FROM book_classifications bc WHERE bc.classification_id = c.id)
+FROM classifications c
+`
+
+func scanClasses(rows pgx.Rows) ([]*ClassRow, error) {
+	defer rows.Close()
+	var out []*ClassRow
+	for rows.Next() {
+		var c ClassRow
+		if err := rows.Scan(&c.ID, &c.Scheme, &c.Code, &c.Name, &c.ParentID, &c.Books); err != nil {
+			return nil, err
+		}
+		out = append(out, &c)
+	}
+	return out, rows.Err()
+}
+
+// listClasses: ?scheme= и ?parent_id= (без parent_id — корневые узлы), ?q= — поиск по коду и названию.
+func (a *API) listClasses(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := qs.Get("scheme"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("c.scheme = $%d", len(args)))
+	}
+	if v := strings.TrimSpace(qs.Get("q")); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("(c.code LIKE $%d || '%%' OR c.name ILIKE '%%' || $%d || '%%')", len(args), len(args)))
+	} else if v := qs.Get("parent_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("c.parent_id = $%d", len(args)))
+	} else {
+		where = append(where, "c.parent_id IS NULL")
+	}
+	q := classSelect + " WHERE " + strings.Join(where, " AND ") + " ORDER BY c.scheme, c.code NULLS LAST, c.name"
+	rows, err := a.db.Query(context.Background(), q, args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	out, err := scanClasses(rows)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) classTree(w http.ResponseWriter, r *http.Request) {
+	q := classSelect + " ORDER BY c.code NULLS LAST, c.name"
+	var args []any
+	if v := r.URL.Query().Get("scheme"); v != "" {
+		q = classSelect + " WHERE c.scheme = $1 ORDER BY c.code NULLS LAST, c.name"
+		args = append(args, v)
+	}
+	rows, err := a.db.Query(context.Background(), q, args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	all, err := scanClasses(rows)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	byID := make(map[string]*ClassRow, len(all))
+	for _, c := range all {
+		byID[c.ID] = c
+	}
+	roots := []*ClassRow{}
+	for _, c := range all {
+		if c.ParentID != nil {
+			if p, ok := byID[*c.ParentID]; ok {
+				p.Children = append(p.Children, c)
+				continue
+			}
+		}
+		roots = append(roots, c)
+	}
+	writeJSON(w, roots)
+}
+
+type classUpsert struct {
+	Scheme   string  `json:"scheme"`
+	Code     *string `json:"code"`
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+func (in *classUpsert) validate(ctx context.Context, a *API) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Scheme == "" {
+		in.Scheme = "udc"
+	}
+	if !classSchemes[in.Scheme] {
+		return fmt.Errorf("scheme must be udc, bbk or local")
+	}
+	if in.Code != nil {
+		c := strings.TrimSpace(*in.Code)
+		in.Code = &c
+		if c == "" {
+			in.Code = nil
+		}
+	}
+	if in.Name == "" {
+		return fmt.Errorf("name required")
+	}
+	if in.ParentID != nil && *in.ParentID == "" {
+		in.ParentID = nil
+	}
+	if in.ParentID != nil {
+		var scheme string
+		if err := a.db.QueryRow(ctx, `SELECT scheme FROM classifications WHERE id=$1`, *in.ParentID).Scan(&scheme); err != nil {
+			return fmt.Errorf("parent not found")
+		}
+		if scheme != in.Scheme {
+			return fmt.Errorf("parent belongs to another scheme")
+		}
+	}
+	return nil
+}
+
+func (a *API) createClass(w http.ResponseWriter, r *http.Request) {
+	var in classUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	if err := in.validate(ctx, a); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var id string
+	if err := a.db.QueryRow(ctx,
+		`INSERT INTO classifications(scheme, code, name, parent_id) VALUES($1,$2,$3,$4) RETURNING id`,
+		in.Scheme, in.Code, in.Name, in.ParentID).Scan(&id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, ClassRow{ID: id, Scheme: in.Scheme, Code: in.Code, Name: in.Name, ParentID: in.ParentID})
+}
+
+func (a *API) updateClass(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in classUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	if err := in.validate(ctx, a); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.ParentID != nil {
+		var cycle bool
+		if err := a.db.QueryRow(ctx, classSubtree("id = $1")+` SELECT EXISTS(SELECT 1 FROM sub WHERE id = $2)`, id, *in.ParentID).Scan(&cycle); err != nil {
+			bad(w, err, 400)
+			return
+		}
+		if cycle {
+			bad(w, fmt.Errorf("parent cannot be the node itself or its descendant"), 400)
+			return
+		}
+	}
+	// смена схемы не должна разрывать дерево: подклассы остаются в схеме узла
+	var foreign int
+	if err := a.db.QueryRow(ctx, `SELECT count(*) FROM classifications WHERE parent_id=$1 AND scheme<>$2`, id, in.Scheme).Scan(&foreign); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if foreign > 0 {
+		bad(w, fmt.Errorf("%d subclasses belong to another scheme", foreign), 409)
+		return
+	}
+	cmd, err := a.db.Exec(ctx, `UPDATE classifications SET scheme=$1, code=$2, name=$3, parent_id=$4 WHERE id=$5`,
+		in.Scheme, in.Code, in.Name, in.ParentID, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	writeJSON(w, ClassRow{ID: id, Scheme: in.Scheme, Code: in.Code, Name: in.Name, ParentID: in.ParentID})
+}
+
+func (a *API) deleteClass(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var children, books int
+	if err := a.db.QueryRow(ctx, `
+SELECT (SELECT count(*) FROM classifications WHERE parent_id=$1),
+       (SELECT count(*) FROM book_classifications WHERE classification_id=$1)`, id).Scan(&children, &books); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if children > 0 || books > 0 {
+		bad(w, fmt.Errorf("classification has %d subclasses and %d books", children, books), 409)
+		return
+	}
+	cmd, err := a.db.Exec(ctx, `DELETE FROM classifications WHERE id=$1`, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// classBooks — книги узла; по умолчанию вместе с подклассами, ?subclasses=false — только сам узел.
+func (a *API) classBooks(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	where := " WHERE b.id IN (SELECT book_id FROM book_classifications WHERE classification_id = $1)"
+	if r.URL.Query().Get("subclasses") != "false" {
+		where = " WHERE b.id IN (" + classSubtree("id = $1") + " SELECT bc.book_id FROM book_classifications bc JOIN sub ON sub.id = bc.classification_id)"
+	}
+	out, err := a.queryBooks(where, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) bookClasses(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT c.id, c.scheme, c.code, c.name
+FROM book_classifications bc
+JOIN classifications c ON c.id = bc.classification_id
+WHERE bc.book_id = $1
+ORDER BY c.scheme, c.code NULLS LAST, c.name`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []ClassRef{}
+	for rows.Next() {
+		var c ClassRef
+		if err := rows.Scan(&c.ID, &c.Scheme, &c.Code, &c.Name); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, c)
+	}
+	writeJSON(w, out)
+}
+
+// setBookClasses заменяет набор классификаций книги. Основная группа
+// (books.book_group_id) сохраняется всегда.
+func (a *API) setBookClasses(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID string
+	err = tx.QueryRow(ctx, `SELECT book_group_id FROM books WHERE id=$1 FOR UPDATE`, id).Scan(&groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM book_classifications WHERE book_id=$1 AND classification_id <> $2`, id, groupID); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO book_classifications(book_id, classification_id)
+SELECT $1, unnest($2::uuid[])
+ON CONFLICT DO NOTHING`, id, in.IDs); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.bookClasses(w, r)
+}
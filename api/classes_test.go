@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Узел со схемой, отличной от родителя или подклассов, смешал бы УДК и ББК в одном дереве.
+func TestUpdateClassKeepsSchemeConsistent(t *testing.T) {
+	db := testDB(t)
+	a := NewAPI(db)
+	ctx := context.Background()
+
+	var root, child string
+	if err := db.QueryRow(ctx, `INSERT INTO classifications(scheme, code, name) VALUES('udc','82','Литература') RETURNING id`).Scan(&root); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(ctx, `INSERT INTO classifications(scheme, code, name, parent_id) VALUES('udc','821','Художественная литература',$1) RETURNING id`, root).Scan(&child); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(id, body string) int {
+		t.Helper()
+		rc := chi.NewRouteContext()
+		rc.URLParams.Add("id", id)
+		req := httptest.NewRequest(http.MethodPut, "/classes/"+id, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rc))
+		rec := httptest.NewRecorder()
+		a.updateClass(rec, req)
+		return rec.Code
+	}
+	// у корня есть подкласс УДК
+	if code := update(root, `{"scheme":"bbk","code":"83","name":"Литература"}`); code != 409 {
+		t.Errorf("root to bbk: %d, want 409", code)
+	}
+	// родитель в УДК
+	if code := update(child, `{"scheme":"bbk","code":"84","name":"Художественная литература","parent_id":"`+root+`"}`); code != 400 {
+		t.Errorf("child to bbk under udc parent: %d, want 400", code)
+	}
+	// отдельный лист можно перевести в другую схему
+	if code := update(child, `{"scheme":"bbk","code":"84","name":"Художественная литература"}`); code != 200 {
+		t.Errorf("detached leaf to bbk: %d, want 200", code)
+	}
+	if code := update(root, `{"scheme":"bbk","code":"83","name":"Литература"}`); code != 200 {
+		t.Errorf("childless root to bbk: %d, want 200", code)
+	}
+}
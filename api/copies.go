@@ -0,0 +1,621 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Экземпляры книг, полки в залах и перемещения экземпляров между залами.
+// Перемещение: requested → in_transit → received (или cancelled до получения).
+
+type ShelfRow struct {
+	ID     string  `json:"id"`
+	RoomID string  `json:"room_id"`
+	Code   string  `json:"code"`
+	Name   *string `json:"name,omitempty"`
+	Copies int     `json:"copies"`
+}
+
+type CopyRow struct {
+	ID          string  `json:"id"`
+	BookID      string  `json:"book_id"`
+	BookTitle   string  `json:"book_title"`
+	InventoryNo string  `json:"inventory_no"`
+	HomeRoomID  string  `json:"home_room_id"`
+	RoomID      string  `json:"room_id"`
+	RoomName    string  `json:"room_name"`
+	ShelfID     *string `json:"shelf_id,omitempty"`
+	ShelfCode   *string `json:"shelf_code,omitempty"`
+	Status      string  `json:"status"`
+}
+
+type TransferRow struct {
+	ID           string  `json:"id"`
+	CopyID       string  `json:"copy_id"`
+	InventoryNo  string  `json:"inventory_no"`
+	BookID       string  `json:"book_id"`
+	BookTitle    string  `json:"book_title"`
+	FromRoomID   string  `json:"from_room_id"`
+	FromRoomName string  `json:"from_room_name"`
+	ToRoomID     string  `json:"to_room_id"`
+	ToRoomName   string  `json:"to_room_name"`
+	ToShelfID    *string `json:"to_shelf_id,omitempty"`
+	Status       string  `json:"status"`
+	Note         *string `json:"note,omitempty"`
+	RequestedAt  string  `json:"requested_at"`
+	ShippedAt    *string `json:"shipped_at,omitempty"`
+	ReceivedAt   *string `json:"received_at,omitempty"`
+	CancelledAt  *string `json:"cancelled_at,omitempty"`
+}
+
+const copySelect = `
+SELECT c.id, b.id, b.name, c.inventory_no, b.reading_room_id, rr.id, rr.name, s.id, s.code, c.status
+FROM book_copies c
+JOIN books b ON b.id = c.book_id
+JOIN reading_rooms rr ON rr.id = c.room_id
+LEFT JOIN shelves s ON s.id = c.shelf_id
+`
+
+func scanCopy(row interface{ Scan(...any) error }) (CopyRow, error) {
+	var c CopyRow
+	err := row.Scan(&c.ID, &c.BookID, &c.BookTitle, &c.InventoryNo, &c.HomeRoomID, &c.RoomID, &c.RoomName, &c.ShelfID, &c.ShelfCode, &c.Status)
+	return c, err
+}
+
+const transferSelect = `
+SELECT t.id, c.id, c.inventory_no, b.id, b.name,
+       fr.id, fr.name, tr.id, tr.name, t.to_shelf_id, t.status, t.note,
+       to_char(t.requested_at,'DD/MM/YYYY HH24:MI'),
+       to_char(t.shipped_at,'DD/MM/YYYY HH24:MI'),
+       to_char(t.received_at,'DD/MM/YYYY HH24:MI'),
+       to_char(t.cancelled_at,'DD/MM/YYYY HH24:MI')
+FROM copy_transfers t
+JOIN book_copies c ON c.id = t.copy_id
+JOIN books b ON b.id = c.book_id
+JOIN reading_rooms fr ON fr.id = t.from_room_id
+JOIN reading_rooms tr ON tr.id = t.to_room_id
+`
+
+func scanTransfer(row interface{ Scan(...any) error }) (TransferRow, error) {
+	var t TransferRow
+	err := row.Scan(&t.ID, &t.CopyID, &t.InventoryNo, &t.BookID, &t.BookTitle,
+		&t.FromRoomID, &t.FromRoomName, &t.ToRoomID, &t.ToRoomName, &t.ToShelfID, &t.Status, &t.Note,
+		&t.RequestedAt, &t.ShippedAt, &t.ReceivedAt, &t.CancelledAt)
+	return t, err
+}
+
+func (a *API) queryCopies(where string, args ...any) ([]CopyRow, error) {
+	rows, err := a.db.Query(context.Background(), copySelect+where+" ORDER BY b.name, c.inventory_no", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []CopyRow{}
+	for rows.Next() {
+		c, err := scanCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (a *API) queryTransfers(where string, args ...any) ([]TransferRow, error) {
+	rows, err := a.db.Query(context.Background(), transferSelect+where+" ORDER BY t.requested_at DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TransferRow{}
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// SHELVES
+
+func (a *API) listShelves(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT s.id, s.room_id, s.code, s.name, (SELECT count(*) FROM book_copies c WHERE c.shelf_id = s.id)
+FROM shelves s WHERE s.room_id=$1 ORDER BY s.code`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []ShelfRow{}
+	for rows.Next() {
+		var s ShelfRow
+		if err := rows.Scan(&s.ID, &s.RoomID, &s.Code, &s.Name, &s.Copies); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, out)
+}
+
+type shelfUpsert struct {
+	Code string  `json:"code"`
+	Name *string `json:"name"`
+}
+
+func decodeShelf(r *http.Request) (shelfUpsert, error) {
+	var in shelfUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		return in, err
+	}
+	in.Code = strings.TrimSpace(in.Code)
+	if in.Code == "" {
+		return in, fmt.Errorf("code required")
+	}
+	if in.Name != nil && strings.TrimSpace(*in.Name) == "" {
+		in.Name = nil
+	}
+	return in, nil
+}
+
+func (a *API) createShelf(w http.ResponseWriter, r *http.Request) {
+	in, err := decodeShelf(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	s := ShelfRow{RoomID: chi.URLParam(r, "id"), Code: in.Code, Name: in.Name}
+	if err := a.db.QueryRow(context.Background(),
+		`INSERT INTO shelves(room_id, code, name) VALUES($1,$2,$3) RETURNING id`, s.RoomID, s.Code, s.Name).Scan(&s.ID); err != nil {
+		dictConflict(w, err)
+		return
+	}
+	writeJSON(w, s)
+}
+
+func (a *API) updateShelf(w http.ResponseWriter, r *http.Request) {
+	in, err := decodeShelf(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	s := ShelfRow{ID: chi.URLParam(r, "id"), Code: in.Code, Name: in.Name}
+	err = a.db.QueryRow(context.Background(), `
+UPDATE shelves SET code=$2, name=$3 WHERE id=$1
+RETURNING room_id, (SELECT count(*) FROM book_copies c WHERE c.shelf_id = shelves.id)`, s.ID, s.Code, s.Name).Scan(&s.RoomID, &s.Copies)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		dictConflict(w, err)
+		return
+	}
+	writeJSON(w, s)
+}
+
+// deleteShelf: экземпляры с удаляемой полки остаются в зале без полки.
+func (a *API) deleteShelf(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(), `DELETE FROM shelves WHERE id=$1`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// COPIES
+
+func (a *API) listBookCopies(w http.ResponseWriter, r *http.Request) {
+	out, err := a.queryCopies(" WHERE c.book_id=$1", chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) getCopy(w http.ResponseWriter, r *http.Request) {
+	c, err := scanCopy(a.db.QueryRow(context.Background(), copySelect+" WHERE c.id=$1", chi.URLParam(r, "id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (a *API) copyByInventory(w http.ResponseWriter, r *http.Request) {
+	c, err := scanCopy(a.db.QueryRow(context.Background(), copySelect+" WHERE c.inventory_no=$1", chi.URLParam(r, "no")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, c)
+}
+
+// addCopy заводит новый экземпляр и увеличивает books.number_copies.
+// Без room_id экземпляр ставится в зал книги; без inventory_no номер выдаётся автоматически.
+func (a *API) addCopy(w http.ResponseWriter, r *http.Request) {
+	bookID := chi.URLParam(r, "id")
+	var in struct {
+		InventoryNo string  `json:"inventory_no"`
+		RoomID      string  `json:"room_id"`
+		ShelfID     *string `json:"shelf_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var home string
+	if err := tx.QueryRow(ctx, `SELECT reading_room_id FROM books WHERE id=$1 FOR UPDATE`, bookID).Scan(&home); err != nil {
+		bad(w, fmt.Errorf("book not found"), 404)
+		return
+	}
+	if in.RoomID == "" {
+		in.RoomID = home
+	}
+	var id string
+	if err := tx.QueryRow(ctx, `
+INSERT INTO book_copies(book_id, room_id, shelf_id, inventory_no)
+VALUES($1,$2,$3, coalesce(nullif($4,''), lpad(nextval('book_copy_inventory_seq')::text, 8, '0')))
+RETURNING id`, bookID, in.RoomID, in.ShelfID, strings.TrimSpace(in.InventoryNo)).Scan(&id); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE books SET number_copies = number_copies + 1 WHERE id=$1`, bookID); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.copyByID(w, id)
+}
+
+func (a *API) copyByID(w http.ResponseWriter, id string) {
+	c, err := scanCopy(a.db.QueryRow(context.Background(), copySelect+" WHERE c.id=$1", id))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, c)
+}
+
+// copyFree — условие «экземпляр c можно выдать прямо сейчас».
+const copyFree = `c.status = 'available'
+  AND NOT EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL)`
+
+// pickCopy выбирает экземпляр для выдачи: указанный (по id или инвентарному
+// номеру) либо первый свободный, в первую очередь из зала книги.
+func (a *API) pickCopy(ctx context.Context, bookID, copyID, inventoryNo string) (string, string, error) {
+	var id, inv string
+	if copyID == "" && inventoryNo == "" {
+		err := a.db.QueryRow(ctx, `
+SELECT c.id, c.inventory_no FROM book_copies c JOIN books b ON b.id = c.book_id
+WHERE c.book_id = $1 AND `+copyFree+`
+ORDER BY (c.room_id = b.reading_room_id) DESC, c.inventory_no
+LIMIT 1`, bookID).Scan(&id, &inv)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", fmt.Errorf("Свободных экземпляров книги больше нет")
+		}
+		return id, inv, err
+	}
+	var book string
+	var ok bool
+	err := a.db.QueryRow(ctx, `
+SELECT c.id, c.inventory_no, c.book_id, `+copyFree+`
+FROM book_copies c WHERE c.id::text = $1 OR c.inventory_no = $2`, copyID, inventoryNo).Scan(&id, &inv, &book, &ok)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", "", fmt.Errorf("экземпляр не найден")
+	case err != nil:
+		return "", "", err
+	case book != bookID:
+		return "", "", fmt.Errorf("экземпляр %s относится к другой книге", inv)
+	case !ok:
+		return "", "", fmt.Errorf("экземпляр %s недоступен для выдачи", inv)
+	}
+	return id, inv, nil
+}
+
+// updateCopy меняет инвентарный номер и полку в текущем зале.
+// Зал меняется только через перемещение.
+func (a *API) updateCopy(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		InventoryNo *string `json:"inventory_no"`
+		ShelfID     *string `json:"shelf_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.InventoryNo != nil && strings.TrimSpace(*in.InventoryNo) == "" {
+		bad(w, fmt.Errorf("inventory_no must not be empty"), 400)
+		return
+	}
+	if in.ShelfID != nil && *in.ShelfID == "" {
+		in.ShelfID = nil
+	}
+	cmd, err := a.db.Exec(context.Background(), `
+UPDATE book_copies SET inventory_no = coalesce($2, inventory_no), shelf_id = $3 WHERE id=$1`,
+		id, in.InventoryNo, in.ShelfID)
+	if err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.copyByID(w, id)
+}
+
+// TRANSFERS
+
+// listTransfers: ?status=, ?room_id= (откуда или куда), ?copy_id=.
+func (a *API) listTransfers(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := qs.Get("status"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("t.status = $%d", len(args)))
+	}
+	if v := qs.Get("room_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("(t.from_room_id = $%[1]d OR t.to_room_id = $%[1]d)", len(args)))
+	}
+	if v := qs.Get("copy_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("t.copy_id = $%d", len(args)))
+	}
+	w2 := ""
+	if len(where) > 0 {
+		w2 = " WHERE " + strings.Join(where, " AND ")
+	}
+	out, err := a.queryTransfers(w2, args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) copyTransfers(w http.ResponseWriter, r *http.Request) {
+	out, err := a.queryTransfers(" WHERE t.copy_id=$1", chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) transferByID(w http.ResponseWriter, id string) {
+	t, err := scanTransfer(a.db.QueryRow(context.Background(), transferSelect+" WHERE t.id=$1", id))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, t)
+}
+
+// createTransfer: {"copy_id", "to_room_id", "to_shelf_id"?, "note"?}.
+func (a *API) createTransfer(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		CopyID    string  `json:"copy_id"`
+		ToRoomID  string  `json:"to_room_id"`
+		ToShelfID *string `json:"to_shelf_id"`
+		Note      *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.CopyID == "" || in.ToRoomID == "" {
+		bad(w, fmt.Errorf("copy_id and to_room_id required"), 400)
+		return
+	}
+	if in.ToShelfID != nil && *in.ToShelfID == "" {
+		in.ToShelfID = nil
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var room, status string
+	if err := tx.QueryRow(ctx, `SELECT room_id, status FROM book_copies WHERE id=$1 FOR UPDATE`, in.CopyID).Scan(&room, &status); err != nil {
+		bad(w, fmt.Errorf("copy not found"), 404)
+		return
+	}
+	if status != "available" {
+		bad(w, fmt.Errorf("экземпляр недоступен для перемещения (%s)", status), 409)
+		return
+	}
+	var onLoan bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM accounting_books WHERE copy_id=$1 AND date_return IS NULL)`, in.CopyID).Scan(&onLoan); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if onLoan {
+		bad(w, fmt.Errorf("экземпляр выдан читателю"), 409)
+		return
+	}
+	if room == in.ToRoomID {
+		bad(w, fmt.Errorf("экземпляр уже в этом зале"), 409)
+		return
+	}
+	if in.ToShelfID != nil {
+		var ok bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM shelves WHERE id=$1 AND room_id=$2)`, *in.ToShelfID, in.ToRoomID).Scan(&ok); err != nil || !ok {
+			bad(w, fmt.Errorf("полка находится в другом зале"), 400)
+			return
+		}
+	}
+	var id string
+	if err := tx.QueryRow(ctx, `
+INSERT INTO copy_transfers(copy_id, from_room_id, to_room_id, to_shelf_id, note)
+VALUES($1,$2,$3,$4,$5) RETURNING id`, in.CopyID, room, in.ToRoomID, in.ToShelfID, in.Note).Scan(&id); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.transferByID(w, id)
+}
+
+// advanceTransfer переводит перемещение из статуса from в to и обновляет экземпляр
+// запросом copySQL ($1 — id экземпляра, далее copyArgs).
+func (a *API) advanceTransfer(w http.ResponseWriter, id string, from []string, to, stamp, copySQL string, copyArgs ...any) {
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var copyID, status string
+	if err := tx.QueryRow(ctx, `SELECT copy_id, status FROM copy_transfers WHERE id=$1 FOR UPDATE`, id).Scan(&copyID, &status); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == status
+	}
+	if !allowed {
+		bad(w, fmt.Errorf("перемещение в статусе %s нельзя перевести в %s", status, to), 409)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE copy_transfers SET status=$2, `+stamp+`=now() WHERE id=$1`, id, to); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if copySQL != "" {
+		if _, err := tx.Exec(ctx, copySQL, append([]any{copyID}, copyArgs...)...); err != nil {
+			badConstraint(w, err)
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.transferByID(w, id)
+}
+
+func (a *API) shipTransfer(w http.ResponseWriter, r *http.Request) {
+	a.advanceTransfer(w, chi.URLParam(r, "id"), []string{"requested"}, "in_transit", "shipped_at",
+		`UPDATE book_copies SET status='in_transit' WHERE id=$1`)
+}
+
+// receiveTransfer: {"shelf_id"?} — полка в зале назначения, по умолчанию to_shelf_id.
+func (a *API) receiveTransfer(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		ShelfID *string `json:"shelf_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			bad(w, err, 400)
+			return
+		}
+	}
+	if in.ShelfID != nil && *in.ShelfID == "" {
+		in.ShelfID = nil
+	}
+	id := chi.URLParam(r, "id")
+	a.advanceTransfer(w, id, []string{"in_transit"}, "received", "received_at", `
+UPDATE book_copies c SET status='available', room_id=t.to_room_id, shelf_id=coalesce($3::uuid, t.to_shelf_id)
+FROM copy_transfers t WHERE c.id=$1 AND t.id=$2`, id, in.ShelfID)
+}
+
+// cancelTransfer: экземпляр остаётся (или возвращается) в исходном зале.
+func (a *API) cancelTransfer(w http.ResponseWriter, r *http.Request) {
+	a.advanceTransfer(w, chi.URLParam(r, "id"), []string{"requested", "in_transit"}, "cancelled", "cancelled_at",
+		`UPDATE book_copies SET status='available' WHERE id=$1 AND status='in_transit'`)
+}
+
+// INVENTORY
+
+type RoomInventoryRow struct {
+	BookID    string `json:"book_id"`
+	Title     string `json:"title"`
+	Expected  int    `json:"expected"`   // числится за залом
+	Present   int    `json:"present"`    // из них находится в зале
+	InTransit int    `json:"in_transit"` // в пути
+	Elsewhere int    `json:"elsewhere"`  // в других залах
+	Foreign   int    `json:"foreign"`    // в зале, но числится за другим залом
+	OnLoan    int    `json:"on_loan"`
+}
+
+// roomInventory сравнивает, что должно быть в зале (книги зала), с тем, где
+// экземпляры находятся сейчас. Списанные и утерянные экземпляры не учитываются.
+func (a *API) roomInventory(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT b.id, b.name,
+       count(*) FILTER (WHERE b.reading_room_id = $1),
+       count(*) FILTER (WHERE b.reading_room_id = $1 AND c.room_id = $1 AND c.status = 'available'),
+       count(*) FILTER (WHERE b.reading_room_id = $1 AND c.status = 'in_transit'),
+       count(*) FILTER (WHERE b.reading_room_id = $1 AND c.room_id <> $1 AND c.status = 'available'),
+       count(*) FILTER (WHERE b.reading_room_id <> $1 AND c.room_id = $1),
+       (SELECT count(*) FROM accounting_books ab WHERE ab.book_id = b.id AND ab.date_return IS NULL)
+FROM book_copies c
+JOIN books b ON b.id = c.book_id
+WHERE (b.reading_room_id = $1 OR c.room_id = $1)
+  AND c.status NOT IN ('lost', 'written_off')
+GROUP BY b.id, b.name
+ORDER BY b.name`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []RoomInventoryRow{}
+	for rows.Next() {
+		var x RoomInventoryRow
+		if err := rows.Scan(&x.BookID, &x.Title, &x.Expected, &x.Present, &x.InTransit, &x.Elsewhere, &x.Foreign, &x.OnLoan); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, x)
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 18/10/2026 — воскресенье
+	for _, c := range []struct {
+		spec, from, want string
+	}{
+		{"*/15 * * * *", "2026-10-18 10:07", "2026-10-18 10:15"},
+		{"5/20 * * * *", "2026-10-18 10:07", "2026-10-18 10:25"},
+		{"0,30 * * * *", "2026-10-18 10:30", "2026-10-18 11:00"},
+		{"0 2 * * *", "2026-10-18 10:07", "2026-10-19 02:00"},
+		// строго после t
+		{"30 3 * * *", "2026-10-18 03:30", "2026-10-19 03:30"},
+		{"0 9-17/4 * * *", "2026-10-18 10:07", "2026-10-18 13:00"},
+		{"0 9-17/4 * * *", "2026-10-18 17:01", "2026-10-19 09:00"},
+		{"0 0 * * 7", "2026-10-18 10:07", "2026-10-25 00:00"},
+		{"0 0 * * 0", "2026-10-18 10:07", "2026-10-25 00:00"},
+		{"0 0 * * 1-5", "2026-10-18 10:07", "2026-10-19 00:00"},
+		{"0 0 * * 6", "2026-10-18 10:07", "2026-10-24 00:00"},
+		// день месяца или день недели
+		{"0 0 1 * 1", "2026-10-18 10:07", "2026-10-19 00:00"},
+		{"0 0 1 * 1", "2026-10-27 10:07", "2026-11-01 00:00"},
+		{"0 0 13 * 5", "2026-11-07 10:07", "2026-11-13 00:00"},
+		// */n в дне месяца — как «*»: ограничивает только день недели
+		{"0 0 */1 * 1", "2026-10-18 10:07", "2026-10-19 00:00"},
+		{"0 0 1 * *", "2026-10-18 10:07", "2026-11-01 00:00"},
+		{"0 0 31 * *", "2026-10-31 10:07", "2026-12-31 00:00"},
+		{"0 0 1 1 *", "2026-10-18 10:07", "2027-01-01 00:00"},
+		{"59 23 31 12 *", "2026-12-31 23:59", "2027-12-31 23:59"},
+		{"0 0 29 2 *", "2026-10-18 10:07", "2028-02-29 00:00"},
+		{"0 12 * 3 *", "2026-10-18 10:07", "2027-03-01 12:00"},
+	} {
+		cs, err := parseCron(c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if got := cs.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Errorf("%q after %s: got %s, want %s", c.spec, c.from, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+
+	// пояс со смещением в полчаса
+	if loc, err := time.LoadLocation("Asia/Kolkata"); err == nil {
+		cs, _ := parseCron("0 2 * * *")
+		from := time.Date(2026, 10, 18, 10, 7, 0, 0, loc)
+		if got, want := cs.Next(from), time.Date(2026, 10, 19, 2, 0, 0, 0, loc); !got.Equal(want) {
+			t.Errorf("Asia/Kolkata: got %s, want %s", got, want)
+		}
+	}
+
+	for _, spec := range []string{"0 0 31 2 *", "0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		cs, err := parseCron(spec)
+		if err != nil {
+			t.Fatalf("%q: %v", spec, err)
+		}
+		if got := cs.Next(at("2026-10-18 10:07")); !got.IsZero() {
+			t.Errorf("%q never fires, got %s", spec, got)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "* * * * * *",
+		"60 * * * *", "* 24 * * *", "* * 0 * *", "* * 32 * *", "* * * 0 *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "*/x * * * *", "5-1 * * * *", "a * * * *", "1-b * * * *", "-1 * * * *", "1,,2 * * * *",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestParseCronField(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want []int
+	}{
+		{"*", []int{0, 1, 2, 3, 4, 5, 6}},
+		{"*/3", []int{0, 3, 6}},
+		{"2/2", []int{2, 4, 6}},
+		{"1-5/2", []int{1, 3, 5}},
+		{"1,3-4,6", []int{1, 3, 4, 6}},
+		{"5", []int{5}},
+	} {
+		set, err := parseCronField(c.s, 0, 6)
+		if err != nil {
+			t.Errorf("%q: %v", c.s, err)
+			continue
+		}
+		var want uint64
+		for _, v := range c.want {
+			want |= 1 << uint(v)
+		}
+		if set != want {
+			t.Errorf("%q: got %b, want %b", c.s, set, want)
+		}
+	}
+}
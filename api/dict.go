@@ -0,0 +1,576 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Справочник объявляется один раз в dictionaries (dictionaries.go) и получает
+// CRUD-маршруты /api/<name>, поиск, пагинацию, счётчик использования и
+// проверку ссылок при удалении.
+
+type dictFieldType int
+
+const (
+	dictString  dictFieldType = iota // varchar, NULL для пустой строки
+	dictInt                          // integer
+	dictStrings                      // varchar[]
+	dictNumber                       // numeric
+	dictUUID                         // ссылка на другую таблицу; в поиске не участвует
+)
+
+type dictField struct {
+	Name     string // ключ JSON и имя колонки
+	Type     dictFieldType
+	Required bool
+}
+
+// dictRef — колонка, ссылающаяся на справочник. BookColumn указывает, где в
+// таблице id книги (для books — "id"); пусто, если ссылка не связана с книгами.
+// LinkTable — таблица-связка, где пара (BookColumn, Column) уникальна: при
+// переназначении совпадающие строки схлопываются. У остальных ссылок
+// переназначение — простой UPDATE.
+type dictRef struct {
+	Table      string
+	Column     string
+	BookColumn string
+	LinkTable  bool
+}
+
+type dictValues map[string]any
+
+type dictionary struct {
+	Name   string
+	Table  string
+	Fields []dictField
+	Refs   []dictRef
+	// Prepare нормализует и проверяет значения перед записью; set — поля,
+	// пришедшие в запросе.
+	Prepare func(v dictValues, set map[string]bool) error
+	// Decorate добавляет вычисляемые поля в ответ.
+	Decorate func(v dictValues)
+	// AfterReassign — SQL, выполняемый после переноса ссылок на запись $1.
+	AfterReassign []string
+}
+
+func (d *dictionary) table() string { return pgx.Identifier{d.Table}.Sanitize() }
+
+func (d *dictionary) columns() []string {
+	cols := []string{"d.id", "d.name"}
+	for _, f := range d.Fields {
+		cols = append(cols, "d."+pgx.Identifier{f.Name}.Sanitize())
+	}
+	return append(cols, d.usageExpr())
+}
+
+// usageExpr — число разных книг, ссылающихся на запись.
+func (d *dictionary) usageExpr() string {
+	var parts []string
+	for _, ref := range d.Refs {
+		if ref.BookColumn == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT %s AS book_id FROM %s WHERE %s = d.id",
+			pgx.Identifier{ref.BookColumn}.Sanitize(), pgx.Identifier{ref.Table}.Sanitize(), pgx.Identifier{ref.Column}.Sanitize()))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return "(SELECT count(DISTINCT u.book_id) FROM (" + strings.Join(parts, " UNION ALL ") + ") u)"
+}
+
+func (d *dictionary) selectSQL() string {
+	return "SELECT " + strings.Join(d.columns(), ", ") + " FROM " + d.table() + " d"
+}
+
+func (d *dictionary) scan(row interface{ Scan(...any) error }) (dictValues, error) {
+	var id, name string
+	var usage int
+	dest := []any{&id, &name}
+	holders := make([]any, len(d.Fields))
+	for i, f := range d.Fields {
+		switch f.Type {
+		case dictInt:
+			holders[i] = new(*int)
+		case dictNumber:
+			holders[i] = new(*float64)
+		case dictStrings:
+			holders[i] = new([]string)
+		default:
+			holders[i] = new(*string)
+		}
+		dest = append(dest, holders[i])
+	}
+	dest = append(dest, &usage)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	v := dictValues{"id": id, "name": name, "usage": usage}
+	for i, f := range d.Fields {
+		switch h := holders[i].(type) {
+		case **int:
+			v[f.Name] = *h
+		case **float64:
+			v[f.Name] = *h
+		case *[]string:
+			if *h == nil {
+				*h = []string{}
+			}
+			v[f.Name] = *h
+		case **string:
+			v[f.Name] = *h
+		}
+	}
+	if d.Decorate != nil {
+		d.Decorate(v)
+	}
+	return v, nil
+}
+
+// decode разбирает тело запроса поверх текущих значений v.
+func (d *dictionary) decode(r *http.Request, v dictValues) (map[string]bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	if m, ok := raw["name"]; ok {
+		var s string
+		if err := json.Unmarshal(m, &s); err != nil {
+			return nil, fmt.Errorf("name: %w", err)
+		}
+		v["name"] = strings.TrimSpace(s)
+		set["name"] = true
+	}
+	for _, f := range d.Fields {
+		m, ok := raw[f.Name]
+		if !ok {
+			continue
+		}
+		set[f.Name] = true
+		switch f.Type {
+		case dictInt:
+			var n *int
+			if err := json.Unmarshal(m, &n); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			v[f.Name] = n
+		case dictNumber:
+			var n *float64
+			if err := json.Unmarshal(m, &n); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			v[f.Name] = n
+		case dictStrings:
+			var ss []string
+			if err := json.Unmarshal(m, &ss); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if ss == nil {
+				ss = []string{}
+			}
+			v[f.Name] = ss
+		default:
+			var s *string
+			if err := json.Unmarshal(m, &s); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if s != nil {
+				if t := strings.TrimSpace(*s); t != "" {
+					s = &t
+				} else {
+					s = nil
+				}
+			}
+			v[f.Name] = s
+		}
+	}
+	return set, nil
+}
+
+func (d *dictionary) validate(v dictValues, set map[string]bool) error {
+	if d.Prepare != nil {
+		if err := d.Prepare(v, set); err != nil {
+			return err
+		}
+	}
+	if s, _ := v["name"].(string); s == "" {
+		return fmt.Errorf("name required")
+	}
+	for _, f := range d.Fields {
+		if !f.Required {
+			continue
+		}
+		switch x := v[f.Name].(type) {
+		case *string:
+			if x == nil {
+				return fmt.Errorf("%s required", f.Name)
+			}
+		case *int:
+			if x == nil {
+				return fmt.Errorf("%s required", f.Name)
+			}
+		case *float64:
+			if x == nil {
+				return fmt.Errorf("%s required", f.Name)
+			}
+		case nil:
+			return fmt.Errorf("%s required", f.Name)
+		}
+	}
+	return nil
+}
+
+func (d *dictionary) args(v dictValues) []any {
+	args := []any{v["name"]}
+	for _, f := range d.Fields {
+		val := v[f.Name]
+		if val == nil && f.Type == dictStrings {
+			val = []string{}
+		}
+		args = append(args, val)
+	}
+	return args
+}
+
+func dictConflict(w http.ResponseWriter, err error) {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) && pe.Code == "23505" {
+		bad(w, fmt.Errorf("такая запись уже есть"), 409)
+		return
+	}
+	bad(w, err, 400)
+}
+
+func (a *API) mountDict(r chi.Router, d *dictionary) {
+	base := "/" + d.Name
+	r.Get(base, func(w http.ResponseWriter, r *http.Request) { a.listDict(w, r, d) })
+	r.Post(base, func(w http.ResponseWriter, r *http.Request) { a.createDict(w, r, d) })
+	r.Get(base+"/{id}", func(w http.ResponseWriter, r *http.Request) { a.getDict(w, r, d) })
+	r.Put(base+"/{id}", func(w http.ResponseWriter, r *http.Request) { a.updateDict(w, r, d) })
+	r.Delete(base+"/{id}", func(w http.ResponseWriter, r *http.Request) { a.deleteDict(w, r, d) })
+}
+
+// listDict: ?q= — поиск по name (и строковым полям), ?sort=name|usage,
+// ?limit=&offset= — страница; общее число записей в заголовке X-Total-Count.
+func (a *API) listDict(w http.ResponseWriter, r *http.Request, d *dictionary) {
+	qs := r.URL.Query()
+	var where string
+	var args []any
+	if q := strings.TrimSpace(qs.Get("q")); q != "" {
+		args = append(args, q)
+		conds := []string{"d.name ILIKE '%' || $1 || '%'"}
+		for _, f := range d.Fields {
+			switch f.Type {
+			case dictString:
+				conds = append(conds, "d."+pgx.Identifier{f.Name}.Sanitize()+" ILIKE '%' || $1 || '%'")
+			case dictStrings:
+				conds = append(conds, "array_to_string(d."+pgx.Identifier{f.Name}.Sanitize()+", ' ') ILIKE '%' || $1 || '%'")
+			}
+		}
+		where = " WHERE " + strings.Join(conds, " OR ")
+	}
+	order := " ORDER BY d.name"
+	if qs.Get("sort") == "usage" {
+		order = " ORDER BY " + d.usageExpr() + " DESC, d.name"
+	}
+	page := ""
+	if n, err := strconv.Atoi(qs.Get("limit")); err == nil && n > 0 {
+		page += " LIMIT " + strconv.Itoa(n)
+	}
+	if n, err := strconv.Atoi(qs.Get("offset")); err == nil && n > 0 {
+		page += " OFFSET " + strconv.Itoa(n)
+	}
+
+	ctx := context.Background()
+	var total int
+	if err := a.db.QueryRow(ctx, "SELECT count(*) FROM "+d.table()+" d"+where, args...).Scan(&total); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	rows, err := a.db.Query(ctx, d.selectSQL()+where+order+page, args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []dictValues{}
+	for rows.Next() {
+		v, err := d.scan(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, v)
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	writeJSON(w, out)
+}
+
+func (a *API) loadDict(ctx context.Context, d *dictionary, id string) (dictValues, error) {
+	return d.scan(a.db.QueryRow(ctx, d.selectSQL()+" WHERE d.id = $1", id))
+}
+
+func (a *API) getDict(w http.ResponseWriter, r *http.Request, d *dictionary) {
+	v, err := a.loadDict(context.Background(), d, chi.URLParam(r, "id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, v)
+}
+
+func (a *API) createDict(w http.ResponseWriter, r *http.Request, d *dictionary) {
+	v := dictValues{}
+	set, err := d.decode(r, v)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := d.validate(v, set); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	cols := []string{"name"}
+	ph := []string{"$1"}
+	for i, f := range d.Fields {
+		cols = append(cols, pgx.Identifier{f.Name}.Sanitize())
+		ph = append(ph, "$"+strconv.Itoa(i+2))
+	}
+	ctx := context.Background()
+	var id string
+	q := "INSERT INTO " + d.table() + "(" + strings.Join(cols, ", ") + ") VALUES(" + strings.Join(ph, ", ") + ") RETURNING id"
+	if err := a.db.QueryRow(ctx, q, d.args(v)...).Scan(&id); err != nil {
+		dictConflict(w, err)
+		return
+	}
+	out, err := a.loadDict(ctx, d, id)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) updateDict(w http.ResponseWriter, r *http.Request, d *dictionary) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	v, err := a.loadDict(ctx, d, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	set, err := d.decode(r, v)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := d.validate(v, set); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	sets := []string{"name = $1"}
+	for i, f := range d.Fields {
+		sets = append(sets, pgx.Identifier{f.Name}.Sanitize()+" = $"+strconv.Itoa(i+2))
+	}
+	args := append(d.args(v), id)
+	q := "UPDATE " + d.table() + " SET " + strings.Join(sets, ", ") + " WHERE id = $" + strconv.Itoa(len(args))
+	cmd, err := a.db.Exec(ctx, q, args...)
+	if err != nil {
+		dictConflict(w, err)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	out, err := a.loadDict(ctx, d, id)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, out)
+}
+
+type dbQuerier interface {
+	QueryRow(context.Context, string, ...any) pgx.Row
+	Query(context.Context, string, ...any) (pgx.Rows, error)
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+}
+
+// dictReferences считает ссылки на запись по каждой объявленной колонке.
+func dictReferences(ctx context.Context, q dbQuerier, d *dictionary, id string) (map[string]int, error) {
+	refs := map[string]int{}
+	for _, ref := range d.Refs {
+		var n int
+		sql := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s = $1",
+			pgx.Identifier{ref.Table}.Sanitize(), pgx.Identifier{ref.Column}.Sanitize())
+		if err := q.QueryRow(ctx, sql, id).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs[ref.Table+"."+ref.Column] = n
+		}
+	}
+	return refs, nil
+}
+
+type blockingBook struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Year  int    `json:"pub_year"`
+}
+
+// dictBlockingBooks — книги, которые ссылаются на запись (не больше limit).
+func dictBlockingBooks(ctx context.Context, q dbQuerier, d *dictionary, id string, limit int) ([]blockingBook, error) {
+	var parts []string
+	for _, ref := range d.Refs {
+		if ref.BookColumn == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1",
+			pgx.Identifier{ref.BookColumn}.Sanitize(), pgx.Identifier{ref.Table}.Sanitize(), pgx.Identifier{ref.Column}.Sanitize()))
+	}
+	out := []blockingBook{}
+	if len(parts) == 0 {
+		return out, nil
+	}
+	rows, err := q.Query(ctx, `
+SELECT b.id, b.name, b.year_publication FROM books b
+WHERE b.id IN (`+strings.Join(parts, " UNION ")+`)
+ORDER BY b.name, b.year_publication
+LIMIT $2`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b blockingBook
+		if err := rows.Scan(&b.ID, &b.Title, &b.Year); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// reassignDict переносит все ссылки с from на to.
+func reassignDict(ctx context.Context, tx pgx.Tx, d *dictionary, from, to string) error {
+	for _, ref := range d.Refs {
+		t, col := pgx.Identifier{ref.Table}.Sanitize(), pgx.Identifier{ref.Column}.Sanitize()
+		if ref.LinkTable {
+			bc := pgx.Identifier{ref.BookColumn}.Sanitize()
+			q := fmt.Sprintf(`DELETE FROM %[1]s x WHERE x.%[2]s = $1
+AND EXISTS (SELECT 1 FROM %[1]s y WHERE y.%[3]s = x.%[3]s AND y.%[2]s = $2)`, t, col, bc)
+			if _, err := tx.Exec(ctx, q, from, to); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET %s = $2 WHERE %s = $1", t, col, col), from, to); err != nil {
+			return err
+		}
+	}
+	for _, q := range d.AfterReassign {
+		if _, err := tx.Exec(ctx, q, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteDict удаляет запись, если на неё никто не ссылается. Иначе — 409 со
+// списком книг. С ?reassign_to=<id> ссылки сначала переносятся на другую
+// запись, и удаление проходит в той же транзакции.
+func (a *API) deleteDict(w http.ResponseWriter, r *http.Request, d *dictionary) {
+	id := chi.URLParam(r, "id")
+	target := r.URL.Query().Get("reassign_to")
+	if target == id {
+		bad(w, fmt.Errorf("reassign_to must differ from the deleted entry"), 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var found int
+	lock := "SELECT count(*) FROM (SELECT id FROM " + d.table() + " WHERE id = $1 OR id = $2 FOR UPDATE) t"
+	if target == "" {
+		lock = "SELECT count(*) FROM (SELECT id FROM " + d.table() + " WHERE id = $1 FOR UPDATE) t"
+	}
+	args := []any{id}
+	if target != "" {
+		args = append(args, target)
+	}
+	if err := tx.QueryRow(ctx, lock, args...).Scan(&found); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if found != len(args) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+
+	if target != "" {
+		if err := reassignDict(ctx, tx, d, id, target); err != nil {
+			var pe *pgconn.PgError
+			if errors.As(err, &pe) && pe.Code == "23505" {
+				bad(w, fmt.Errorf("reassign would create duplicate books: %s", pe.Detail), 409)
+				return
+			}
+			bad(w, err, 400)
+			return
+		}
+	} else {
+		refs, err := dictReferences(ctx, tx, d, id)
+		if err != nil {
+			bad(w, err, 400)
+			return
+		}
+		if len(refs) > 0 {
+			books, err := dictBlockingBooks(ctx, tx, d, id, 100)
+			if err != nil {
+				bad(w, err, 500)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(409)
+			writeJSON(w, map[string]any{
+				"error":      "запись используется; укажите reassign_to, чтобы перенести ссылки",
+				"references": refs,
+				"books":      books,
+			})
+			return
+		}
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM "+d.table()+" WHERE id = $1", id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
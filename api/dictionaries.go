@@ -0,0 +1,125 @@
+package api
+
+import "fmt"
+
+func bookRef(column string) dictRef { return dictRef{Table: "books", Column: column, BookColumn: "id"} }
+
+var dictionaries = []*dictionary{
+	{
+		Name:  "authors",
+		Table: "book_authors",
+		Fields: []dictField{
+			{Name: "surname"},
+			{Name: "given_names"},
+			{Name: "patronymic"},
+			{Name: "birth_year", Type: dictInt},
+			{Name: "death_year", Type: dictInt},
+			{Name: "alt_names", Type: dictStrings},
+		},
+		Refs: []dictRef{
+			bookRef("author_id"),
+			{Table: "book_coauthors", Column: "author_id", BookColumn: "book_id", LinkTable: true},
+			{Table: "works", Column: "author_id"},
+		},
+		Prepare:  prepareAuthor,
+		Decorate: decorateAuthor,
+		// основной автор книги не должен дублироваться среди соавторов
+		AfterReassign: []string{
+			`DELETE FROM book_coauthors bc USING books b
+			 WHERE b.id = bc.book_id AND b.author_id = bc.author_id AND bc.author_id = $1`,
+		},
+	},
+	{
+		Name:  "places",
+		Table: "place_publications",
+		Refs:  []dictRef{bookRef("place_publication_id")},
+	},
+	{
+		Name:  "publishers",
+		Table: "publishing_houses",
+		Refs: []dictRef{
+			bookRef("published_house_id"),
+			{Table: "serials", Column: "publisher_id"},
+			{Table: "series", Column: "publisher_id"},
+		},
+	},
+	{
+		Name:  "groups",
+		Table: "book_groups",
+		Refs:  []dictRef{bookRef("book_group_id")},
+	},
+	{
+		Name:   "rooms",
+		Table:  "reading_rooms",
+		Fields: []dictField{{Name: "capacity", Type: dictInt}},
+		Refs: []dictRef{
+			bookRef("reading_room_id"),
+			{Table: "book_copies", Column: "room_id", BookColumn: "book_id"},
+			{Table: "copy_transfers", Column: "from_room_id"},
+			{Table: "copy_transfers", Column: "to_room_id"},
+			{Table: "seat_bookings", Column: "room_id"},
+			{Table: "room_visits", Column: "room_id"},
+			{Table: "serials", Column: "reading_room_id"},
+			{Table: "acquisition_receipts", Column: "room_id"},
+		},
+		Prepare: func(v dictValues, _ map[string]bool) error {
+			if c, _ := v["capacity"].(*int); c != nil && *c < 0 {
+				return fmt.Errorf("capacity must not be negative")
+			}
+			return nil
+		},
+	},
+	{
+		Name:  "languages",
+		Table: "languages",
+		Fields: []dictField{
+			{Name: "code", Required: true},
+			{Name: "native_name"},
+		},
+		Refs: []dictRef{{Table: "book_languages", Column: "language_id", BookColumn: "book_id", LinkTable: true}},
+		Prepare: func(v dictValues, _ map[string]bool) error {
+			c, _ := v["code"].(*string)
+			if c == nil {
+				return nil
+			}
+			l, err := normLanguage(*c)
+			v["code"] = l
+			return err
+		},
+	},
+	{
+		Name:   "series",
+		Table:  "series",
+		Fields: []dictField{{Name: "publisher_id", Type: dictUUID}},
+		Refs:   []dictRef{bookRef("series_id")},
+	},
+	{
+		Name:  "suppliers",
+		Table: "suppliers",
+		Fields: []dictField{
+			{Name: "publisher_id", Type: dictUUID},
+			{Name: "contact"},
+			{Name: "phone"},
+			{Name: "email"},
+		},
+		Refs: []dictRef{{Table: "purchase_orders", Column: "supplier_id"}},
+	},
+	{
+		Name:  "funds",
+		Table: "acquisition_funds",
+		Fields: []dictField{
+			{Name: "year", Type: dictInt},
+			{Name: "budget", Type: dictNumber},
+		},
+		Refs: []dictRef{{Table: "purchase_order_lines", Column: "fund_id"}},
+	},
+}
+
+func dictByName(name string) *dictionary {
+	for _, d := range dictionaries {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
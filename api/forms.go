@@ -0,0 +1,442 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Годовая статистическая форма в духе 6-НК: движение фонда, пользователи и
+// посещения, выдача документов. Данные считаются из books/book_copies,
+// serial_issues, users и accounting_books; форма выгружается в JSON, XLSX
+// (ячейки показателей можно поправить вручную перед сдачей) или PDF.
+
+type FormRow struct {
+	Code   string `json:"code"`
+	Label  string `json:"label"`
+	Values []int  `json:"values"`
+}
+
+type FormSection struct {
+	Title   string    `json:"title"`
+	Columns []string  `json:"columns"`
+	Rows    []FormRow `json:"rows"`
+}
+
+type StatForm struct {
+	Year     int           `json:"year"`
+	Title    string        `json:"title"`
+	Sections []FormSection `json:"sections"`
+}
+
+// возрастные группы 6-НК на конец отчётного года; $2 — последний день года
+var ageGroupSQL = ageGroupAt("$2::date")
+
+// ageGroupAt — возрастная группа читателя u на дату at.
+func ageGroupAt(at string) string {
+	return `CASE WHEN date_part('year', age(` + at + `, u.date_birth)) <= 14 THEN 1
+            WHEN date_part('year', age(` + at + `, u.date_birth)) <= 30 THEN 2
+            ELSE 3 END`
+}
+
+// loanAgeGroupSQL — группа для выдачи: у обезличенной сохранённая при
+// обезличивании, 0 — неизвестна (обезличена до появления reader_age_group).
+var loanAgeGroupSQL = `CASE WHEN u.id IS NULL THEN coalesce(ab.reader_age_group, 0) ELSE ` + ageGroupSQL + ` END`
+
+var ageColumns = []string{"Всего", "дети до 14 лет включительно", "молодёжь 15–30 лет", "старше 30 лет"}
+
+// ageRow — строка с графами «всего» и по возрастным группам 1..3;
+// группа 0 (возраст неизвестен) входит только во «всего».
+func ageRow(code, label string, byAge map[int]int) FormRow {
+	v := []int{0, byAge[1], byAge[2], byAge[3]}
+	v[0] = byAge[0] + v[1] + v[2] + v[3]
+	return FormRow{Code: code, Label: label, Values: v}
+}
+
+func (a *API) statForm(ctx context.Context, year int) (*StatForm, error) {
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC)
+	form := &StatForm{Year: year, Title: "Сведения об общедоступной (публичной) библиотеке (форма 6-НК)"}
+
+	// Раздел 1. Движение фонда: поступило (экземпляр заведён), выбыло
+	// (утерян или списан), состоит на конец года. Экземпляры без даты
+	// поступления были в фонде до поэкземплярного учёта.
+	rows, err := a.db.Query(ctx, `
+WITH c AS (
+    SELECT coalesce(bc.acquired_on, '-infinity') AS acquired, b.book_group_id,
+           (SELECT l.code FROM book_languages bl JOIN languages l ON l.id = bl.language_id
+            WHERE bl.book_id = b.id ORDER BY bl.position, l.code LIMIT 1) AS lang,
+           bc.retired_on AS retired
+    FROM book_copies bc
+    JOIN books b ON b.id = bc.book_id
+)
+SELECT g.name, coalesce(c.lang, ''),
+       count(*) FILTER (WHERE c.acquired BETWEEN $1 AND $2),
+       count(*) FILTER (WHERE c.retired BETWEEN $1 AND $2),
+       count(*) FILTER (WHERE c.acquired <= $2 AND (c.retired IS NULL OR c.retired > $2))
+FROM c
+JOIN book_groups g ON g.id = c.book_group_id
+GROUP BY g.name, c.lang`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var books, ru, other [3]int
+	groups := map[string]*[3]int{}
+	for rows.Next() {
+		var group, lang string
+		var v [3]int
+		if err := rows.Scan(&group, &lang, &v[0], &v[1], &v[2]); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		g := groups[group]
+		if g == nil {
+			g = &[3]int{}
+			groups[group] = g
+		}
+		for i := range v {
+			books[i] += v[i]
+			g[i] += v[i]
+			switch lang {
+			case "ru":
+				ru[i] += v[i]
+			case "":
+			default:
+				other[i] += v[i]
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var serials [3]int
+	if err := a.db.QueryRow(ctx, `
+SELECT coalesce(sum(copies) FILTER (WHERE received_at BETWEEN $1 AND $2), 0),
+       coalesce(sum(copies) FILTER (WHERE received_at <= $2), 0)
+FROM serial_issues WHERE status = 'received'`, from, to).Scan(&serials[0], &serials[2]); err != nil {
+		return nil, err
+	}
+	total := [3]int{books[0] + serials[0], books[1] + serials[1], books[2] + serials[2]}
+	holdings := FormSection{
+		Title:   "Раздел 1. Движение библиотечного фонда, экз.",
+		Columns: []string{"Поступило за год", "Выбыло за год", "Состоит на конец года"},
+		Rows: []FormRow{
+			{"01", "Библиотечный фонд — всего", total[:]},
+			{"02", "в том числе книги и брошюры", books[:]},
+			{"03", "периодические издания (номера журналов и газет)", serials[:]},
+			{"04", "из книг: на русском языке", ru[:]},
+			{"05", "из книг: на других языках", other[:]},
+		},
+	}
+	names := make([]string, 0, len(groups))
+	for n := range groups {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for i, n := range names {
+		holdings.Rows = append(holdings.Rows, FormRow{
+			Code: fmt.Sprintf("%02d", 10+i), Label: "из книг по разделу «" + n + "»", Values: groups[n][:],
+		})
+	}
+
+	// Раздел 2. Пользователи: записаны до конца года и записались или
+	// пользовались библиотекой в этом году (перерегистрация).
+	// Посещение — день, когда читатель брал документы или был в зале.
+	// Обезличенные выдачи дают посещение, если отмечены counts_visit.
+	regs, newRegs, visits := map[int]int{}, map[int]int{}, map[int]int{}
+	rows, err = a.db.Query(ctx, `
+WITH days AS (
+    SELECT user_id, date_issue AS day FROM accounting_books
+    WHERE user_id IS NOT NULL AND date_issue BETWEEN $1 AND $2
+    UNION
+    SELECT user_id, checked_in_at::date FROM room_visits WHERE checked_in_at::date BETWEEN $1 AND $2
+),
+     uv AS (SELECT user_id, count(*) AS n FROM days GROUP BY user_id)
+SELECT `+ageGroupSQL+`,
+       count(*) FILTER (WHERE u.registered_at BETWEEN $1 AND $2 OR uv.n IS NOT NULL),
+       count(*) FILTER (WHERE u.registered_at BETWEEN $1 AND $2),
+       coalesce(sum(uv.n), 0)::bigint
+FROM users u
+LEFT JOIN uv ON uv.user_id = u.id
+WHERE u.registered_at <= $2
+GROUP BY 1`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var age, r, n, v int
+		if err := rows.Scan(&age, &r, &n, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		regs[age], newRegs[age], visits[age] = r, n, v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = a.db.Query(ctx, `
+SELECT coalesce(reader_age_group, 0), count(*) FROM accounting_books
+WHERE user_id IS NULL AND counts_visit AND date_issue BETWEEN $1 AND $2
+GROUP BY 1`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var age, v int
+		if err := rows.Scan(&age, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		visits[age] += v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	readers := FormSection{
+		Title:   "Раздел 2. Пользователи и посещения",
+		Columns: ageColumns,
+		Rows: []FormRow{
+			ageRow("01", "Число зарегистрированных пользователей, чел.", regs),
+			ageRow("02", "из них записались впервые в отчётном году", newRegs),
+			ageRow("03", "Число посещений", visits),
+		},
+	}
+
+	// Раздел 3. Выдача документов, включая обезличенные выдачи.
+	var loans [5]map[int]int
+	for i := range loans {
+		loans[i] = map[int]int{}
+	}
+	rows, err = a.db.Query(ctx, `
+SELECT `+loanAgeGroupSQL+`, count(*), count(ab.book_id), count(ab.issue_id),
+       count(*) FILTER (WHERE ab.loan_type = $3), count(*) FILTER (WHERE ab.loan_type = $4)
+FROM accounting_books ab
+LEFT JOIN users u ON u.id = ab.user_id
+WHERE ab.date_issue BETWEEN $1 AND $2
+GROUP BY 1`, from, to, lendTakeHome, lendReadingRoom)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var age int
+		var v [5]int
+		if err := rows.Scan(&age, &v[0], &v[1], &v[2], &v[3], &v[4]); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for i := range v {
+			loans[i][age] = v[i]
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	issued := FormSection{
+		Title:   "Раздел 3. Выдача документов, экз.",
+		Columns: ageColumns,
+		Rows: []FormRow{
+			ageRow("01", "Выдано документов — всего", loans[0]),
+			ageRow("02", "в том числе книг и брошюр", loans[1]),
+			ageRow("03", "периодических изданий", loans[2]),
+			ageRow("04", "из общего числа: на дом", loans[3]),
+			ageRow("05", "из общего числа: в читальном зале", loans[4]),
+		},
+	}
+
+	form.Sections = []FormSection{holdings, readers, issued}
+	return form, nil
+}
+
+func (f *StatForm) XLSX() ([]byte, error) {
+	x := excelize.NewFile()
+	defer x.Close()
+	const sheet = "6-НК"
+	if err := x.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	border := []excelize.Border{
+		{Type: "left", Color: "000000", Style: 1}, {Type: "right", Color: "000000", Style: 1},
+		{Type: "top", Color: "000000", Style: 1}, {Type: "bottom", Color: "000000", Style: 1},
+	}
+	title, _ := x.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 13}})
+	bold, _ := x.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	head, _ := x.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true}, Border: border,
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
+	})
+	label, _ := x.NewStyle(&excelize.Style{Border: border, Alignment: &excelize.Alignment{WrapText: true, Vertical: "center"}})
+	code, _ := x.NewStyle(&excelize.Style{Border: border, Alignment: &excelize.Alignment{Horizontal: "center"}})
+	// ячейки для заполнения/правки выделены цветом и не защищаются
+	input, _ := x.NewStyle(&excelize.Style{
+		Border: border, Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFF8DC"}},
+		Protection: &excelize.Protection{Locked: false},
+	})
+	x.SetColWidth(sheet, "A", "A", 8)
+	x.SetColWidth(sheet, "B", "B", 52)
+	x.SetColWidth(sheet, "C", "F", 16)
+
+	cell := func(col, row int) string {
+		c, _ := excelize.CoordinatesToCellName(col, row)
+		return c
+	}
+	x.SetCellValue(sheet, "A1", f.Title)
+	x.SetCellStyle(sheet, "A1", "A1", title)
+	x.SetCellValue(sheet, "A2", fmt.Sprintf("за %d год", f.Year))
+	row := 4
+	for _, l := range []string{"Наименование библиотеки", "Почтовый адрес", "Ответственный за составление"} {
+		x.SetCellValue(sheet, cell(1, row), l)
+		x.MergeCell(sheet, cell(3, row), cell(6, row))
+		x.SetCellStyle(sheet, cell(3, row), cell(6, row), input)
+		row++
+	}
+	row++
+
+	for _, s := range f.Sections {
+		x.SetCellValue(sheet, cell(1, row), s.Title)
+		x.SetCellStyle(sheet, cell(1, row), cell(1, row), bold)
+		row++
+		x.SetCellValue(sheet, cell(1, row), "№ строки")
+		x.SetCellValue(sheet, cell(2, row), "Наименование показателя")
+		for i, c := range s.Columns {
+			x.SetCellValue(sheet, cell(3+i, row), c)
+		}
+		x.SetCellStyle(sheet, cell(1, row), cell(2+len(s.Columns), row), head)
+		x.SetRowHeight(sheet, row, 32)
+		row++
+		// нумерация граф, как на бланке
+		for i := 0; i < 2+len(s.Columns); i++ {
+			x.SetCellValue(sheet, cell(1+i, row), i+1)
+		}
+		x.SetCellStyle(sheet, cell(1, row), cell(2+len(s.Columns), row), head)
+		row++
+		for _, r := range s.Rows {
+			x.SetCellValue(sheet, cell(1, row), r.Code)
+			x.SetCellStyle(sheet, cell(1, row), cell(1, row), code)
+			x.SetCellValue(sheet, cell(2, row), r.Label)
+			x.SetCellStyle(sheet, cell(2, row), cell(2, row), label)
+			for i, v := range r.Values {
+				x.SetCellValue(sheet, cell(3+i, row), v)
+			}
+			x.SetCellStyle(sheet, cell(3, row), cell(2+len(r.Values), row), input)
+			row++
+		}
+		row++
+	}
+	x.SetCellValue(sheet, cell(1, row+1), "Руководитель")
+	x.SetCellValue(sheet, cell(1, row+2), "Дата составления")
+	for _, r := range []int{row + 1, row + 2} {
+		x.MergeCell(sheet, cell(3, r), cell(4, r))
+		x.SetCellStyle(sheet, cell(3, r), cell(4, r), input)
+	}
+	b, err := x.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (f *StatForm) PDF(font *pdfFont) []byte {
+	d := newPDF(font)
+	d.Text((pdfPageW-d.TextWidth(f.Title, 12))/2, 50, 12, f.Title)
+	sub := fmt.Sprintf("за %d год", f.Year)
+	d.Text((pdfPageW-d.TextWidth(sub, 11))/2, 66, 11, sub)
+	y := 92.0
+	for _, l := range []string{"Наименование библиотеки", "Почтовый адрес"} {
+		d.Text(40, y, 10, l+":")
+		d.Line(190, y+2, pdfPageW-40, y+2)
+		y += 20
+	}
+	y += 6
+	for _, s := range f.Sections {
+		if y > pdfPageH-120 {
+			d.AddPage()
+			y = 50
+		}
+		d.Text(40, y, 11, s.Title)
+		y += 8
+		valW := 70.0
+		widths := []float64{40, pdfPageW - 80 - 40 - valW*float64(len(s.Columns))}
+		header := []string{"№ строки", "Наименование показателя"}
+		for _, c := range s.Columns {
+			widths = append(widths, valW)
+			header = append(header, c)
+		}
+		rows := make([][]string, 0, len(s.Rows))
+		for _, r := range s.Rows {
+			cells := []string{r.Code, r.Label}
+			for _, v := range r.Values {
+				cells = append(cells, strconv.Itoa(v))
+			}
+			rows = append(rows, cells)
+		}
+		y = d.Table(40, y, 9, widths, header, rows) + 24
+	}
+	if y > pdfPageH-80 {
+		d.AddPage()
+		y = 50
+	}
+	for _, l := range []string{"Руководитель", "Дата составления"} {
+		d.Text(40, y, 10, l+":")
+		d.Line(160, y+2, 360, y+2)
+		y += 26
+	}
+	return d.Bytes()
+}
+
+// statFormHandler: ?year= (по умолчанию прошлый год), ?format=json|xlsx|pdf.
+func (a *API) statFormHandler(w http.ResponseWriter, r *http.Request) {
+	year := today().Year() - 1
+	if s := r.URL.Query().Get("year"); s != "" {
+		var err error
+		if year, err = strconv.Atoi(s); err != nil || year < 1900 || year > today().Year() {
+			bad(w, fmt.Errorf("bad year"), 400)
+			return
+		}
+	}
+	format := r.URL.Query().Get("format")
+	var font *pdfFont
+	if format == "pdf" {
+		if a.pdfFont == "" {
+			bad(w, fmt.Errorf("PDF font not configured"), 501)
+			return
+		}
+		var err error
+		if font, err = loadPDFFont(a.pdfFont); err != nil {
+			bad(w, err, 501)
+			return
+		}
+	}
+	form, err := a.statForm(r.Context(), year)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	switch format {
+	case "", "json":
+		writeJSON(w, form)
+	case "xlsx":
+		b, err := form.XLSX()
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="6nk-%d.xlsx"`, year))
+		w.Write(b)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="6nk-%d.pdf"`, year))
+		w.Write(form.PDF(font))
+	default:
+		bad(w, fmt.Errorf("format must be json, xlsx or pdf"), 400)
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// История выдач и профиль читателя. Возвращённые выдачи старше срока
+// хранения обезличиваются (user_id = NULL) — в статистике они остаются
+// (в 6-НК — с возрастной группой, сохранённой при обезличивании).
+
+const defaultHistoryDays = 3 * 365
+
+// userLoans — вся история выдач читателя, новые сначала; фильтры,
+// сортировка и страницы — как у /loans.
+func (a *API) userLoans(w http.ResponseWriter, r *http.Request) {
+	where, args, err := loanFilters(r, []string{"ab.user_id = $1::uuid"}, []any{chi.URLParam(r, "id")})
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.loanPage(w, r, where, args)
+}
+
+type ProfileItem struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Loans int    `json:"loans"`
+}
+
+// ReaderBalance — задолженность читателя перед библиотекой. Штрафы не
+// начисляются, поэтому задолженность — это книги на руках и просрочка.
+type ReaderBalance struct {
+	OnHand      int     `json:"on_hand"`
+	Overdue     int     `json:"overdue"`
+	OverdueDays int     `json:"overdue_days"`
+	NextDue     *string `json:"next_due,omitempty"`
+}
+
+type ReaderProfile struct {
+	User          UserRow       `json:"user"`
+	Loans         int           `json:"loans"`
+	Titles        int           `json:"titles"`
+	ReturnedLate  int           `json:"returned_late"`
+	AvgLoanDays   *float64      `json:"avg_loan_days,omitempty"`
+	FirstLoan     *string       `json:"first_loan,omitempty"`
+	LastLoan      *string       `json:"last_loan,omitempty"`
+	Renewals      int           `json:"renewals"`
+	Groups        []ProfileItem `json:"favourite_groups"`
+	Authors       []ProfileItem `json:"favourite_authors"`
+	Balance       ReaderBalance `json:"balance"`
+	HistoryDays   int           `json:"history_retention_days"`
+	HistoryShared bool          `json:"history_default"`
+}
+
+func (a *API) favourites(ctx context.Context, q string, userID string) ([]ProfileItem, error) {
+	rows, err := a.db.Query(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ProfileItem{}
+	for rows.Next() {
+		var p ProfileItem
+		if err := rows.Scan(&p.ID, &p.Name, &p.Loans); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// userProfile — сводка по читателю: итоги, любимые разделы и авторы, задолженность.
+// Считается по сохранённой (не обезличенной) истории.
+func (a *API) userProfile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var p ReaderProfile
+	var err error
+	p.User, err = scanUser(a.db.QueryRow(ctx, userSelect+` WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var retention *int
+	if err := a.db.QueryRow(ctx, `
+SELECT count(*), count(DISTINCT coalesce(ab.book_id, ab.issue_id)),
+       count(*) FILTER (WHERE ab.date_return > ab.date_due),
+       round(avg(ab.date_return - ab.date_issue), 1)::float8,
+       to_char(min(ab.date_issue),'DD/MM/YYYY'), to_char(max(ab.date_issue),'DD/MM/YYYY'),
+       coalesce(sum(ab.renewals), 0)::int,
+       count(*) FILTER (WHERE ab.date_return IS NULL),
+       count(*) FILTER (WHERE ab.date_return IS NULL AND ab.date_due < $2),
+       coalesce(sum(greatest($2::date - ab.date_due, 0)) FILTER (WHERE ab.date_return IS NULL), 0)::int,
+       to_char(min(ab.date_due) FILTER (WHERE ab.date_return IS NULL AND ab.date_due >= $2),'DD/MM/YYYY'),
+       (SELECT history_retention_days FROM users WHERE id=$1)
+FROM accounting_books ab
+WHERE ab.user_id=$1`, id, today()).Scan(&p.Loans, &p.Titles, &p.ReturnedLate, &p.AvgLoanDays, &p.FirstLoan, &p.LastLoan,
+		&p.Renewals, &p.Balance.OnHand, &p.Balance.Overdue, &p.Balance.OverdueDays, &p.Balance.NextDue, &retention); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	p.HistoryDays, p.HistoryShared = a.historyDays, retention == nil
+	if retention != nil {
+		p.HistoryDays = *retention
+	}
+	if p.Groups, err = a.favourites(ctx, `
+SELECT g.id::text, g.name, count(*) FROM accounting_books ab
+JOIN books b ON b.id = ab.book_id
+JOIN book_groups g ON g.id = b.book_group_id
+WHERE ab.user_id=$1
+GROUP BY g.id ORDER BY count(*) DESC, g.name LIMIT 5`, id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if p.Authors, err = a.favourites(ctx, `
+SELECT au.id::text, au.name, count(*) FROM accounting_books ab
+JOIN books b ON b.id = ab.book_id
+JOIN book_authors au ON au.id = b.author_id
+WHERE ab.user_id=$1
+GROUP BY au.id ORDER BY count(*) DESC, au.name LIMIT 5`, id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, p)
+}
+
+// anonymiseHistory обезличивает возвращённые выдачи старше срока хранения
+// (у читателя свой срок или a.historyDays). userID != "" — только этого
+// читателя; force — всю его историю сразу, без учёта срока.
+//
+// Для 6-НК у выдачи остаются возрастная группа на конец года выдачи и
+// counts_visit: день выдачи — посещение, если в этот день читатель не
+// отмечался в зале и других его выдач за день не осталось (из обезличиваемых
+// сейчас отмечается одна). Так день считается ровно один раз, даже если
+// выдачи одного дня обезличиваются в разное время.
+func (a *API) anonymiseHistory(ctx context.Context, userID string, force bool) (int64, error) {
+	cmd, err := a.db.Exec(ctx, `
+WITH cand AS (
+    SELECT ab.id, ab.user_id, ab.date_issue
+    FROM accounting_books ab
+    JOIN users u ON u.id = ab.user_id
+    WHERE ab.date_return IS NOT NULL
+      AND ($2 OR ab.date_return < $1::date - coalesce(u.history_retention_days, $3))
+      AND ($4 = '' OR u.id::text = $4)
+)
+UPDATE accounting_books ab
+SET user_id = NULL,
+    reader_age_group = `+ageGroupAt("make_date(extract(year FROM c.date_issue)::int, 12, 31)")+`,
+    counts_visit = NOT EXISTS (SELECT 1 FROM accounting_books o
+                               WHERE o.user_id = c.user_id AND o.date_issue = c.date_issue
+                                 AND (o.id < c.id OR NOT EXISTS (SELECT 1 FROM cand c2 WHERE c2.id = o.id)))
+               AND NOT EXISTS (SELECT 1 FROM room_visits v
+                               WHERE v.user_id = c.user_id AND v.checked_in_at::date = c.date_issue)
+FROM cand c
+JOIN users u ON u.id = c.user_id
+WHERE ab.id = c.id`, today(), force, a.historyDays, userID)
+	if err != nil {
+		return 0, err
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// anonymiseUser (сотрудник): обезличить всю завершённую историю читателя сейчас.
+func (a *API) anonymiseUser(w http.ResponseWriter, r *http.Request) {
+	n, err := a.anonymiseHistory(context.Background(), chi.URLParam(r, "id"), true)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, map[string]int64{"anonymised": n})
+}
+
+// readerPrivacy (личный кабинет): {"keep_history": false} — не хранить
+// историю после возврата, true — хранить в течение срока библиотеки.
+func (a *API) readerPrivacy(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		KeepHistory bool `json:"keep_history"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var days *int
+	if !in.KeepHistory {
+		days = new(int)
+	}
+	rd := currentReader(r)
+	ctx := context.Background()
+	if _, err := a.db.Exec(ctx, `UPDATE users SET history_retention_days=$2 WHERE id=$1`, rd.ID, days); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	n := int64(0)
+	if !in.KeepHistory {
+		var err error
+		if n, err = a.anonymiseHistory(ctx, rd.ID, true); err != nil {
+			bad(w, err, 500)
+			return
+		}
+	}
+	writeJSON(w, map[string]any{"keep_history": in.KeepHistory, "anonymised": n})
+}
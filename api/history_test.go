@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// Обезличенные выдачи остаются в 6-НК: в выдаче — с возрастной группой
+// читателя, в посещениях — один раз за день.
+func TestAnonymisedLoansStayInStatForm(t *testing.T) {
+	db := testDB(t)
+	a := NewAPI(db)
+	ctx := context.Background()
+	issued := today().AddDate(0, 0, -3)
+
+	var userID string
+	if err := db.QueryRow(ctx, `SELECT id FROM users WHERE name='Сергеев Сергей Сергеевич'`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	// две книги за один день, обе уже возвращены
+	if _, err := db.Exec(ctx, `
+INSERT INTO accounting_books(user_id, book_id, date_issue, date_due, date_return)
+SELECT $1, id, $2, $2::date + 14, $2::date + 1 FROM books WHERE name='Евгений Онегин'
+UNION ALL
+SELECT $1, id, $2, $2::date + 14, $2::date + 2 FROM books WHERE name='Евгений Онегин'`, userID, issued); err != nil {
+		t.Fatal(err)
+	}
+
+	form := func() (visits, loans []int) {
+		t.Helper()
+		f, err := a.statForm(ctx, issued.Year())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f.Sections[1].Rows[2].Values, f.Sections[2].Rows[0].Values
+	}
+	visits, loans := form()
+	// читатель 1990 года рождения — группа «старше 30 лет»
+	if want := []int{1, 0, 0, 1}; !reflect.DeepEqual(visits, want) {
+		t.Fatalf("visits before: %v, want %v", visits, want)
+	}
+	if want := []int{2, 0, 0, 2}; !reflect.DeepEqual(loans, want) {
+		t.Fatalf("loans before: %v, want %v", loans, want)
+	}
+
+	if n, err := a.anonymiseHistory(ctx, userID, true); err != nil || n != 2 {
+		t.Fatalf("anonymiseHistory: %d %v", n, err)
+	}
+	v2, l2 := form()
+	if !reflect.DeepEqual(v2, visits) || !reflect.DeepEqual(l2, loans) {
+		t.Errorf("after anonymising: visits %v, loans %v; want %v, %v", v2, l2, visits, loans)
+	}
+}
@@ -0,0 +1,442 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Инвентаризация: сессия открывается для зала, номера экземпляров
+// сканируются пачками, при закрытии фиксируется отчёт о недостаче,
+// лишних и не на своём месте экземплярах.
+
+type InventorySession struct {
+	ID       string  `json:"id"`
+	RoomID   string  `json:"room_id"`
+	RoomName string  `json:"room_name"`
+	Status   string  `json:"status"`
+	Note     *string `json:"note,omitempty"`
+	OpenedAt string  `json:"opened_at"`
+	ClosedAt *string `json:"closed_at,omitempty"`
+	Scanned  int     `json:"scanned"`
+}
+
+type InventoryItem struct {
+	InventoryNo string  `json:"inventory_no"`
+	CopyID      *string `json:"copy_id,omitempty"`
+	BookID      *string `json:"book_id,omitempty"`
+	Title       *string `json:"title,omitempty"`
+	RoomName    *string `json:"room_name,omitempty"`
+	ShelfCode   *string `json:"shelf_code,omitempty"`
+	// missing: not_found; unexpected: unknown, lost, written_off, on_loan;
+	// misplaced: other_room, in_transit, wrong_shelf
+	Reason string `json:"reason"`
+}
+
+type InventoryReport struct {
+	SessionID  string          `json:"session_id"`
+	RoomID     string          `json:"room_id"`
+	Expected   int             `json:"expected"`
+	Scanned    int             `json:"scanned"`
+	Found      int             `json:"found"`
+	OnLoan     int             `json:"on_loan"`
+	Missing    []InventoryItem `json:"missing"`
+	Unexpected []InventoryItem `json:"unexpected"`
+	Misplaced  []InventoryItem `json:"misplaced"`
+}
+
+const sessionSelect = `
+SELECT s.id, rr.id, rr.name, s.status, s.note,
+       to_char(s.opened_at,'DD/MM/YYYY HH24:MI'), to_char(s.closed_at,'DD/MM/YYYY HH24:MI'),
+       (SELECT count(*) FROM inventory_scans sc WHERE sc.session_id = s.id)
+FROM inventory_sessions s
+JOIN reading_rooms rr ON rr.id = s.room_id
+`
+
+func scanSession(row interface{ Scan(...any) error }) (InventorySession, error) {
+	var s InventorySession
+	err := row.Scan(&s.ID, &s.RoomID, &s.RoomName, &s.Status, &s.Note, &s.OpenedAt, &s.ClosedAt, &s.Scanned)
+	return s, err
+}
+
+// inventoryReport сравнивает сканы сессии с экземплярами, которые по учёту
+// находятся в зале, и с активными выдачами.
+func inventoryReport(ctx context.Context, q dbQuerier, sessionID, roomID string) (*InventoryReport, error) {
+	rep := &InventoryReport{SessionID: sessionID, RoomID: roomID,
+		Missing: []InventoryItem{}, Unexpected: []InventoryItem{}, Misplaced: []InventoryItem{}}
+
+	err := q.QueryRow(ctx, `
+SELECT count(*),
+       count(*) FILTER (WHERE EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL))
+FROM book_copies c WHERE c.room_id = $1 AND c.status = 'available'`, roomID).Scan(&rep.Expected, &rep.OnLoan)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `
+SELECT c.inventory_no, c.id, b.id, b.name, sh.code
+FROM book_copies c
+JOIN books b ON b.id = c.book_id
+LEFT JOIN shelves sh ON sh.id = c.shelf_id
+WHERE c.room_id = $2 AND c.status = 'available'
+  AND NOT EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL)
+  AND NOT EXISTS (SELECT 1 FROM inventory_scans s WHERE s.session_id = $1 AND s.copy_id = c.id)
+ORDER BY sh.code NULLS LAST, b.name, c.inventory_no`, sessionID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		it := InventoryItem{Reason: "not_found"}
+		if err := rows.Scan(&it.InventoryNo, &it.CopyID, &it.BookID, &it.Title, &it.ShelfCode); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rep.Missing = append(rep.Missing, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx, `
+SELECT s.inventory_no, c.id, b.id, b.name, rr.name, sh.code,
+       CASE WHEN c.id IS NULL THEN 'unknown'
+            WHEN c.status IN ('lost', 'written_off') THEN c.status
+            WHEN EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL) THEN 'on_loan'
+            WHEN c.status = 'in_transit' THEN 'in_transit'
+            WHEN c.room_id <> $2 THEN 'other_room'
+            WHEN s.shelf_id IS NOT NULL AND c.shelf_id IS DISTINCT FROM s.shelf_id THEN 'wrong_shelf'
+            ELSE 'ok' END
+FROM inventory_scans s
+LEFT JOIN book_copies c ON c.id = s.copy_id
+LEFT JOIN books b ON b.id = c.book_id
+LEFT JOIN reading_rooms rr ON rr.id = c.room_id
+LEFT JOIN shelves sh ON sh.id = c.shelf_id
+WHERE s.session_id = $1
+ORDER BY s.scanned_at, s.inventory_no`, sessionID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it InventoryItem
+		if err := rows.Scan(&it.InventoryNo, &it.CopyID, &it.BookID, &it.Title, &it.RoomName, &it.ShelfCode, &it.Reason); err != nil {
+			return nil, err
+		}
+		rep.Scanned++
+		switch it.Reason {
+		case "ok":
+			rep.Found++
+		case "other_room", "in_transit", "wrong_shelf":
+			rep.Misplaced = append(rep.Misplaced, it)
+		default:
+			rep.Unexpected = append(rep.Unexpected, it)
+		}
+	}
+	return rep, rows.Err()
+}
+
+// listInventorySessions: ?room_id=, ?status=open|closed.
+func (a *API) listInventorySessions(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := qs.Get("room_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("s.room_id = $%d", len(args)))
+	}
+	if v := qs.Get("status"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("s.status = $%d", len(args)))
+	}
+	q := sessionSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY s.opened_at DESC", args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []InventorySession{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) getInventorySession(w http.ResponseWriter, r *http.Request) {
+	s, err := scanSession(a.db.QueryRow(context.Background(), sessionSelect+" WHERE s.id=$1", chi.URLParam(r, "id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, s)
+}
+
+// openInventorySession: {"room_id", "note"?}; в зале может быть одна открытая сессия.
+func (a *API) openInventorySession(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		RoomID string  `json:"room_id"`
+		Note   *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.RoomID == "" {
+		bad(w, fmt.Errorf("room_id required"), 400)
+		return
+	}
+	ctx := context.Background()
+	var id string
+	if err := a.db.QueryRow(ctx, `INSERT INTO inventory_sessions(room_id, note) VALUES($1,$2) RETURNING id`, in.RoomID, in.Note).Scan(&id); err != nil {
+		var pe *pgconn.PgError
+		if errors.As(err, &pe) && pe.Code == "23505" {
+			bad(w, fmt.Errorf("в зале уже идёт инвентаризация"), 409)
+			return
+		}
+		bad(w, err, 400)
+		return
+	}
+	s, err := scanSession(a.db.QueryRow(ctx, sessionSelect+" WHERE s.id=$1", id))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, s)
+}
+
+// addInventoryScans: {"items": ["00000012", ...], "shelf_id"?}. Повторные номера
+// в сессии пропускаются, неизвестные сохраняются и попадают в отчёт как лишние.
+func (a *API) addInventoryScans(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		Items   []string `json:"items"`
+		ShelfID *string  `json:"shelf_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var items []string
+	for _, s := range in.Items {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	if len(items) == 0 {
+		bad(w, fmt.Errorf("items required"), 400)
+		return
+	}
+	if in.ShelfID != nil && *in.ShelfID == "" {
+		in.ShelfID = nil
+	}
+
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var room, status string
+	if err := tx.QueryRow(ctx, `SELECT room_id, status FROM inventory_sessions WHERE id=$1 FOR UPDATE`, id).Scan(&room, &status); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if status != "open" {
+		bad(w, fmt.Errorf("сессия закрыта"), 409)
+		return
+	}
+	if in.ShelfID != nil {
+		var ok bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM shelves WHERE id=$1 AND room_id=$2)`, *in.ShelfID, room).Scan(&ok); err != nil || !ok {
+			bad(w, fmt.Errorf("полка находится в другом зале"), 400)
+			return
+		}
+	}
+	cmd, err := tx.Exec(ctx, `
+INSERT INTO inventory_scans(session_id, inventory_no, copy_id, shelf_id)
+SELECT $1, x.no, c.id, $3
+FROM (SELECT DISTINCT unnest($2::text[]) AS no) x
+LEFT JOIN book_copies c ON c.inventory_no = x.no
+ON CONFLICT (session_id, inventory_no) DO NOTHING`, id, items, in.ShelfID)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	unknown := []string{}
+	rows, err := tx.Query(ctx, `
+SELECT x.no FROM unnest($1::text[]) x(no)
+WHERE NOT EXISTS (SELECT 1 FROM book_copies c WHERE c.inventory_no = x.no)`, items)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	for rows.Next() {
+		var no string
+		if err := rows.Scan(&no); err != nil {
+			rows.Close()
+			bad(w, err, 500)
+			return
+		}
+		unknown = append(unknown, no)
+	}
+	rows.Close()
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"accepted":   cmd.RowsAffected(),
+		"duplicates": int64(len(items)) - cmd.RowsAffected(),
+		"unknown":    unknown,
+	})
+}
+
+// deleteInventoryScan убирает ошибочно отсканированный номер из открытой сессии.
+func (a *API) deleteInventoryScan(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(), `
+DELETE FROM inventory_scans s USING inventory_sessions ss
+WHERE ss.id = s.session_id AND ss.status = 'open' AND s.session_id=$1 AND s.inventory_no=$2`,
+		chi.URLParam(r, "id"), chi.URLParam(r, "no"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// getInventoryReport: для закрытой сессии — отчёт на момент закрытия,
+// для открытой — текущее состояние.
+func (a *API) getInventoryReport(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var room string
+	var stored *InventoryReport
+	if err := a.db.QueryRow(ctx, `SELECT room_id, report FROM inventory_sessions WHERE id=$1`, id).Scan(&room, &stored); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if stored != nil {
+		writeJSON(w, stored)
+		return
+	}
+	rep, err := inventoryReport(ctx, a.db, id, room)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, rep)
+}
+
+func (a *API) closeInventorySession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var room, status string
+	if err := tx.QueryRow(ctx, `SELECT room_id, status FROM inventory_sessions WHERE id=$1 FOR UPDATE`, id).Scan(&room, &status); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if status != "open" {
+		bad(w, fmt.Errorf("сессия уже закрыта"), 409)
+		return
+	}
+	rep, err := inventoryReport(ctx, tx, id, room)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE inventory_sessions SET status='closed', closed_at=now(), report=$2 WHERE id=$1`, id, rep); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, rep)
+}
+
+// markInventoryLost: {"copy_ids"?: [...]} — помечает утерянными недостающие
+// экземпляры закрытой сессии (все или выбранные). Экземпляры, найденные или
+// выданные после закрытия, не трогаются.
+func (a *API) markInventoryLost(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		CopyIDs []string `json:"copy_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			bad(w, err, 400)
+			return
+		}
+	}
+	ctx := context.Background()
+	var rep *InventoryReport
+	if err := a.db.QueryRow(ctx, `SELECT report FROM inventory_sessions WHERE id=$1`, id).Scan(&rep); err != nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if rep == nil {
+		bad(w, fmt.Errorf("сначала закройте сессию"), 409)
+		return
+	}
+	missing := map[string]bool{}
+	for _, it := range rep.Missing {
+		if it.CopyID != nil {
+			missing[*it.CopyID] = true
+		}
+	}
+	ids := in.CopyIDs
+	if len(ids) == 0 {
+		for c := range missing {
+			ids = append(ids, c)
+		}
+	}
+	for _, c := range ids {
+		if !missing[c] {
+			bad(w, fmt.Errorf("экземпляр %s не числится в недостаче", c), 400)
+			return
+		}
+	}
+	cmd, err := a.db.Exec(ctx, `
+UPDATE book_copies c SET status='lost'
+WHERE c.id = ANY($1::uuid[]) AND c.status = 'available' AND c.room_id = $2
+  AND NOT EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL)`, ids, rep.RoomID)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, map[string]int64{"marked": cmd.RowsAffected()})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"strings"
+)
+
+var errBadISBN = errors.New("invalid ISBN")
+
+// NormalizeISBN проверяет контрольную сумму ISBN-10/13 и приводит номер
+// к ISBN-13 без дефисов и пробелов.
+func NormalizeISBN(s string) (string, error) {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(strings.TrimSpace(s)) {
+		switch {
+		case c >= '0' && c <= '9', c == 'X':
+			b.WriteRune(c)
+		case c == '-' || c == ' ':
+		default:
+			return "", errBadISBN
+		}
+	}
+	d := b.String()
+	switch len(d) {
+	case 10:
+		if !isbn10Valid(d) {
+			return "", errBadISBN
+		}
+		d = "978" + d[:9]
+		return d + string(isbn13Check(d)), nil
+	case 13:
+		if strings.ContainsRune(d, 'X') || isbn13Check(d[:12]) != d[12] {
+			return "", errBadISBN
+		}
+		return d, nil
+	}
+	return "", errBadISBN
+}
+
+func isbn10Valid(d string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var v int
+		switch {
+		case d[i] == 'X' && i == 9:
+			v = 10
+		case d[i] >= '0' && d[i] <= '9':
+			v = int(d[i] - '0')
+		default:
+			return false
+		}
+		sum += v * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func isbn13Check(d12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		v := int(d12[i] - '0')
+		if i%2 == 1 {
+			v *= 3
+		}
+		sum += v
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// isbnArg превращает необязательный ISBN из запроса в значение для колонки books.isbn.
+func isbnArg(s string) (*string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	n, err := NormalizeISBN(s)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+var errBadISSN = errors.New("invalid ISSN")
+
+// NormalizeISSN проверяет контрольную цифру ISSN и приводит номер к виду NNNN-NNNC.
+func NormalizeISSN(s string) (string, error) {
+	d := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(strings.TrimSpace(s)))
+	if len(d) != 8 {
+		return "", errBadISSN
+	}
+	sum := 0
+	for i := 0; i < 7; i++ {
+		if d[i] < '0' || d[i] > '9' {
+			return "", errBadISSN
+		}
+		sum += int(d[i]-'0') * (8 - i)
+	}
+	check := byte('0' + (11-sum%11)%11)
+	if check == '0'+10 {
+		check = 'X'
+	}
+	if d[7] != check {
+		return "", errBadISSN
+	}
+	return d[:4] + "-" + d[4:], nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"0-306-40615-2", "9780306406157"},
+		{"0306406152", "9780306406157"},
+		{" 0 306 40615 2 ", "9780306406157"},
+		{"0-8044-2957-X", "9780804429573"},
+		{"0-8044-2957-x", "9780804429573"},
+		{"978-0-306-40615-7", "9780306406157"},
+		{"9785699120147", "9785699120147"},
+		{"0-306-40615-3", ""},   // контрольная цифра
+		{"030640615X", ""},      // X вместо верной цифры
+		{"X306406152", ""},      // X не в конце
+		{"978030640615X", ""},   // X в ISBN-13
+		{"9780306406158", ""},   // контрольная цифра ISBN-13
+		{"978-0-306-40615", ""}, // 12 цифр
+		{"0-306-40615-2 (в пер.)", ""},
+		{"", ""},
+	} {
+		got, err := NormalizeISBN(c.in)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%q: got %q, want error", c.in, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %q, %v; want %q", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestNormalizeISSN(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"0317-8471", "0317-8471"},
+		{"03178471", "0317-8471"},
+		{" 0317 8471 ", "0317-8471"},
+		{"2434-561X", "2434-561X"},
+		{"2434-561x", "2434-561X"},
+		{"0317-8472", ""},
+		{"2434-5610", ""},
+		{"0317-847", ""},
+		{"X317-8471", ""},
+	} {
+		got, err := NormalizeISSN(c.in)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%q: got %q, want error", c.in, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("%q: got %q, %v; want %q", c.in, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Фоновые задания. Расписание и пауза хранятся в таблице jobs; каждая реплика
+// раз в jobTick проверяет, какие задания пора запускать, и берёт аренду
+// (lease) на задание — так одно задание одновременно выполняет только одна
+// реплика. Каждый запуск записывается в job_runs.
+
+const (
+	jobTick  = 30 * time.Second
+	jobLease = 30 * time.Minute
+	// пока задание выполняется, аренда продлевается с таким интервалом
+	jobLeaseRenew = jobLease / 3
+	// бронь снимается, если читатель не пришёл в течение этого времени от начала
+	bookingNoShow = 30 * time.Minute
+	jobRunsKeep   = 90 * 24 * time.Hour
+)
+
+type jobFunc func(a *API, ctx context.Context) (any, error)
+
+var jobRegistry = map[string]jobFunc{
+	"overdue": (*API).recalcOverdue,
+	"notifications": func(a *API, ctx context.Context) (any, error) {
+		return a.runNotifications(ctx)
+	},
+	"expire_bookings": (*API).expireBookings,
+	"purge_sessions":  (*API).purgeSessions,
+	"anonymise_history": func(a *API, ctx context.Context) (any, error) {
+		n, err := a.anonymiseHistory(ctx, "", false)
+		return map[string]int64{"anonymised": n}, err
+	},
+}
+
+var errJobBusy = errors.New("задание уже выполняется")
+
+// recalcOverdue пересчитывает дни просрочки по невозвращённым выдачам.
+func (a *API) recalcOverdue(ctx context.Context) (any, error) {
+	day := today()
+	cmd, err := a.db.Exec(ctx, `
+UPDATE accounting_books SET overdue_days = greatest($1::date - date_due, 0)
+WHERE date_return IS NULL AND overdue_days <> greatest($1::date - date_due, 0)`, day)
+	if err != nil {
+		return nil, err
+	}
+	var overdue int
+	if err := a.db.QueryRow(ctx, `
+SELECT count(*) FROM accounting_books WHERE date_return IS NULL AND date_due < $1`, day).Scan(&overdue); err != nil {
+		return nil, err
+	}
+	return map[string]int64{"updated": cmd.RowsAffected(), "overdue": int64(overdue)}, nil
+}
+
+// expireBookings снимает брони мест, по которым читатель так и не отметился в зале.
+func (a *API) expireBookings(ctx context.Context) (any, error) {
+	cmd, err := a.db.Exec(ctx, `
+UPDATE seat_bookings sb SET cancelled_at = now(), no_show = true
+WHERE sb.cancelled_at IS NULL AND sb.starts_at <= $1
+  AND NOT EXISTS (SELECT 1 FROM room_visits v
+                  WHERE v.user_id = sb.user_id AND v.room_id = sb.room_id
+                    AND v.checked_in_at >= sb.starts_at - $2::interval AND v.checked_in_at < sb.ends_at)`,
+		wallNow().Add(-bookingNoShow), bookingNoShow.String())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"expired": cmd.RowsAffected()}, nil
+}
+
+// purgeSessions удаляет истёкшие токены сотрудников и читателей и старую историю заданий.
+func (a *API) purgeSessions(ctx context.Context) (any, error) {
+	out := map[string]int64{}
+	for key, q := range map[string]string{
+		"employee_sessions": `DELETE FROM employee_sessions WHERE expires_at < now()`,
+		"reader_sessions":   `DELETE FROM reader_sessions WHERE expires_at < now()`,
+		"job_runs":          `DELETE FROM job_runs WHERE started_at < now() - '` + jobRunsKeep.String() + `'::interval`,
+	} {
+		cmd, err := a.db.Exec(ctx, q)
+		if err != nil {
+			return out, err
+		}
+		out[key] = cmd.RowsAffected()
+	}
+	return out, nil
+}
+
+func schedulerNode() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// RunScheduler выполняет задания по расписанию, пока не отменён ctx.
+func (a *API) RunScheduler(ctx context.Context) {
+	node := schedulerNode()
+	t := time.NewTicker(jobTick)
+	defer t.Stop()
+	for {
+		if err := a.runDueJobs(ctx, node); err != nil {
+			log.Printf("scheduler: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (a *API) runDueJobs(ctx context.Context, node string) error {
+	rows, err := a.db.Query(ctx, `
+SELECT name FROM jobs
+WHERE NOT paused AND (next_run_at IS NULL OR next_run_at <= $1) AND (lease_until IS NULL OR lease_until < now())
+ORDER BY next_run_at NULLS FIRST`, wallNow())
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if _, err := a.runJob(ctx, name, node, nil); err != nil && !errors.Is(err, errJobBusy) {
+			log.Printf("job %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// runJob берёт аренду на задание, выполняет его и освобождает аренду.
+// by != nil — ручной запуск сотрудником: выполняется вне расписания, даже на паузе.
+// Возвращает id записи в job_runs.
+func (a *API) runJob(ctx context.Context, name, node string, by *string) (string, error) {
+	fn := jobRegistry[name]
+	if fn == nil {
+		return "", fmt.Errorf("unknown job %q", name)
+	}
+	manual := by != nil
+	var schedule string
+	err := a.db.QueryRow(ctx, `
+UPDATE jobs SET lease_owner=$2, lease_until=now() + $3::interval
+WHERE name=$1 AND (lease_until IS NULL OR lease_until < now())
+  AND ($4 OR (NOT paused AND (next_run_at IS NULL OR next_run_at <= $5)))
+RETURNING schedule`, name, node, jobLease.String(), manual, wallNow()).Scan(&schedule)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errJobBusy
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var runID string
+	if err := a.db.QueryRow(ctx, `
+INSERT INTO job_runs(job_name, node, manual, triggered_by) VALUES($1,$2,$3,$4) RETURNING id`,
+		name, node, manual, by).Scan(&runID); err != nil {
+		a.releaseJob(name, node, schedule, manual)
+		return "", err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.keepJobLease(jobCtx, cancel, name, node)
+	}()
+	res, jobErr := fn(a, jobCtx)
+	cancel()
+	<-done
+	status, errText := "ok", (*string)(nil)
+	if jobErr != nil {
+		status, errText = "failed", nullStr(jobErr.Error())
+	}
+	result, _ := json.Marshal(res)
+	// задание могли прервать остановкой сервера — итог всё равно записываем
+	if _, err := a.db.Exec(context.Background(), `
+UPDATE job_runs SET finished_at=now(), status=$2, result=$3, error=$4 WHERE id=$1`,
+		runID, status, result, errText); err != nil {
+		log.Printf("job %s: %v", name, err)
+	}
+	a.releaseJob(name, node, schedule, manual)
+	return runID, nil
+}
+
+// keepJobLease продлевает аренду задания, пока не отменён ctx. Если аренду
+// потеряли (например, реплика долго не могла достучаться до базы и задание
+// уже взяла другая), задание отменяется через cancel.
+func (a *API) keepJobLease(ctx context.Context, cancel context.CancelFunc, name, node string) {
+	t := time.NewTicker(jobLeaseRenew)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		cmd, err := a.db.Exec(ctx, `
+UPDATE jobs SET lease_until=now() + $3::interval
+WHERE name=$1 AND lease_owner=$2 AND lease_until > now()`, name, node, jobLease.String())
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("job %s: renew lease: %v", name, err)
+			}
+			continue
+		}
+		if cmd.RowsAffected() == 0 {
+			log.Printf("job %s: lease lost, cancelling", name)
+			cancel()
+			return
+		}
+	}
+}
+
+// releaseJob снимает аренду; после запуска по расписанию назначается следующий.
+func (a *API) releaseJob(name, node, schedule string, manual bool) {
+	var next *time.Time
+	if !manual {
+		n := wallNow().Add(time.Hour)
+		if cs, err := parseCron(schedule); err != nil {
+			log.Printf("job %s: %v", name, err)
+		} else if t := cs.Next(wallNow()); !t.IsZero() {
+			n = t
+		}
+		next = &n
+	}
+	if _, err := a.db.Exec(context.Background(), `
+UPDATE jobs SET lease_owner=NULL, lease_until=NULL, next_run_at=coalesce($3, next_run_at)
+WHERE name=$1 AND lease_owner=$2`, name, node, next); err != nil {
+		log.Printf("job %s: %v", name, err)
+	}
+}
+
+type JobRow struct {
+	Name       string          `json:"name"`
+	Schedule   string          `json:"schedule"`
+	Paused     bool            `json:"paused"`
+	NextRun    *string         `json:"next_run_at,omitempty"`
+	RunningOn  *string         `json:"running_on,omitempty"`
+	LastStatus *string         `json:"last_status,omitempty"`
+	LastRun    *string         `json:"last_run_at,omitempty"`
+	LastResult json.RawMessage `json:"last_result,omitempty"`
+	LastError  *string         `json:"last_error,omitempty"`
+}
+
+type JobRun struct {
+	ID          string          `json:"id"`
+	Node        string          `json:"node"`
+	Manual      bool            `json:"manual"`
+	TriggeredBy *string         `json:"triggered_by,omitempty"`
+	StartedAt   string          `json:"started_at"`
+	FinishedAt  *string         `json:"finished_at,omitempty"`
+	Status      string          `json:"status"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *string         `json:"error,omitempty"`
+}
+
+const jobSelect = `
+SELECT j.name, j.schedule, j.paused, to_char(j.next_run_at,'DD/MM/YYYY HH24:MI'),
+       CASE WHEN j.lease_until > now() THEN j.lease_owner END,
+       r.status, to_char(r.started_at,'DD/MM/YYYY HH24:MI'), r.result, r.error
+FROM jobs j
+LEFT JOIN LATERAL (SELECT * FROM job_runs r WHERE r.job_name = j.name ORDER BY r.started_at DESC LIMIT 1) r ON true
+`
+
+func scanJob(row interface{ Scan(...any) error }) (JobRow, error) {
+	var j JobRow
+	var result []byte
+	err := row.Scan(&j.Name, &j.Schedule, &j.Paused, &j.NextRun, &j.RunningOn,
+		&j.LastStatus, &j.LastRun, &result, &j.LastError)
+	j.LastResult = result
+	return j, err
+}
+
+func (a *API) listJobs(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), jobSelect+" ORDER BY j.name")
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []JobRow{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, j)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) jobByName(w http.ResponseWriter, name string) {
+	j, err := scanJob(a.db.QueryRow(context.Background(), jobSelect+" WHERE j.name=$1", name))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, j)
+}
+
+// listJobRuns — последние 100 запусков задания.
+func (a *API) listJobRuns(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT r.id, r.node, r.manual, e.login, to_char(r.started_at,'DD/MM/YYYY HH24:MI:SS'),
+       to_char(r.finished_at,'DD/MM/YYYY HH24:MI:SS'), r.status, r.result, r.error
+FROM job_runs r
+LEFT JOIN employees e ON e.id = r.triggered_by
+WHERE r.job_name=$1
+ORDER BY r.started_at DESC LIMIT 100`, chi.URLParam(r, "name"))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []JobRun{}
+	for rows.Next() {
+		var jr JobRun
+		var result []byte
+		if err := rows.Scan(&jr.ID, &jr.Node, &jr.Manual, &jr.TriggeredBy, &jr.StartedAt, &jr.FinishedAt,
+			&jr.Status, &result, &jr.Error); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		jr.Result = result
+		out = append(out, jr)
+	}
+	writeJSON(w, out)
+}
+
+// triggerJob запускает задание сразу и ждёт его завершения. Задание
+// выполняется до конца, даже если клиент не дождался ответа.
+func (a *API) triggerJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if jobRegistry[name] == nil {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	e := currentEmployee(r)
+	if _, err := a.runJob(context.WithoutCancel(r.Context()), name, schedulerNode(), &e.ID); err != nil {
+		if errors.Is(err, errJobBusy) {
+			bad(w, err, 409)
+			return
+		}
+		bad(w, err, 500)
+		return
+	}
+	a.jobByName(w, name)
+}
+
+func (a *API) pauseJob(w http.ResponseWriter, r *http.Request)  { a.setJobPaused(w, r, true) }
+func (a *API) resumeJob(w http.ResponseWriter, r *http.Request) { a.setJobPaused(w, r, false) }
+
+func (a *API) setJobPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	name := chi.URLParam(r, "name")
+	cmd, err := a.db.Exec(context.Background(), `UPDATE jobs SET paused=$2 WHERE name=$1`, name, paused)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.jobByName(w, name)
+}
+
+// updateJob: {"schedule": "*/15 * * * *"} — новое расписание действует со следующего запуска.
+func (a *API) updateJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	var in struct {
+		Schedule string `json:"schedule"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	cs, err := parseCron(in.Schedule)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	next := cs.Next(wallNow())
+	if next.IsZero() {
+		bad(w, fmt.Errorf("schedule never fires"), 400)
+		return
+	}
+	cmd, err := a.db.Exec(context.Background(), `UPDATE jobs SET schedule=$2, next_run_at=$3 WHERE name=$1`,
+		name, in.Schedule, next)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.jobByName(w, name)
+}
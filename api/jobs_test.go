@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+// Книгу перевели в зал, пока она на руках: пересчёт просрочки и продление
+// не должны повторять проверки выдачи.
+func TestRecalcOverdueAfterLendingModeChange(t *testing.T) {
+	db := testDB(t)
+	a := NewAPI(db)
+	ctx := context.Background()
+	day := today()
+
+	var bookID string
+	if err := db.QueryRow(ctx, `SELECT id FROM books WHERE name='Евгений Онегин'`).Scan(&bookID); err != nil {
+		t.Fatal(err)
+	}
+	var overdueID, activeID string
+	if err := db.QueryRow(ctx, `
+INSERT INTO accounting_books(user_id, book_id, date_issue, date_due)
+SELECT id, $1, $2::date - 30, $2::date - 10 FROM users WHERE name='Сергеев Сергей Сергеевич'
+RETURNING id`, bookID, day).Scan(&overdueID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(ctx, `
+INSERT INTO accounting_books(user_id, book_id, date_issue, date_due)
+SELECT id, $1, $2::date - 5, $2::date FROM users WHERE name='Антонов Антон Валерьевич'
+RETURNING id`, bookID, day).Scan(&activeID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `UPDATE books SET lending_mode='reading_room' WHERE id=$1`, bookID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.recalcOverdue(ctx); err != nil {
+		t.Fatalf("recalcOverdue: %v", err)
+	}
+	var days int
+	if err := db.QueryRow(ctx, `SELECT overdue_days FROM accounting_books WHERE id=$1`, overdueID).Scan(&days); err != nil {
+		t.Fatal(err)
+	}
+	if days != 10 {
+		t.Errorf("overdue_days = %d, want 10", days)
+	}
+	if _, code, err := a.renewLoan(ctx, activeID, ""); err != nil {
+		t.Errorf("renewLoan: %d %v", code, err)
+	}
+}
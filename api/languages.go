@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Языки книг: справочник languages (коды ISO 639) и связка book_languages.
+
+type LangRef struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// normLanguage приводит код языка ISO 639 к нижнему регистру; пустой — NULL.
+func normLanguage(s string) (*string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return nil, nil
+	}
+	if len(s) < 2 || len(s) > 3 || strings.Trim(s, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return nil, fmt.Errorf("language must be an ISO 639 code")
+	}
+	return &s, nil
+}
+
+// resolveLanguages переводит коды в id справочника, сохраняя порядок.
+func resolveLanguages(ctx context.Context, q dbQuerier, codes []string) ([]string, error) {
+	ids := make([]string, 0, len(codes))
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		var id string
+		if err := q.QueryRow(ctx, `SELECT id FROM languages WHERE code=$1`, c).Scan(&id); err != nil {
+			return nil, fmt.Errorf("unknown language %q", c)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setBookLanguages заменяет языки книги; первый в списке — основной.
+func setBookLanguages(ctx context.Context, q dbQuerier, bookID string, ids []string) error {
+	if _, err := q.Exec(ctx, `DELETE FROM book_languages WHERE book_id=$1`, bookID); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if _, err := q.Exec(ctx, `INSERT INTO book_languages(book_id, language_id, position) VALUES($1,$2,$3)`, bookID, id, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrMetadataNotFound = errors.New("metadata not found")
+
+// BookMetadata — библиографическое описание, полученное от внешнего источника.
+type BookMetadata struct {
+	ISBN      string   `json:"isbn"`
+	Title     string   `json:"title"`
+	Authors   []string `json:"authors"`
+	Publisher string   `json:"publisher"`
+	Place     string   `json:"place"`
+	Year      int      `json:"year"`
+	Pages     int      `json:"pages"`
+}
+
+// MetadataProvider ищет описание книги по нормализованному ISBN-13.
+// Если записи нет, возвращает ErrMetadataNotFound.
+type MetadataProvider interface {
+	Lookup(ctx context.Context, isbn string) (*BookMetadata, error)
+}
+
+// ChainProvider опрашивает источники по очереди до первого найденного.
+type ChainProvider []MetadataProvider
+
+func (c ChainProvider) Lookup(ctx context.Context, isbn string) (*BookMetadata, error) {
+	var lastErr error = ErrMetadataNotFound
+	for _, p := range c {
+		m, err := p.Lookup(ctx, isbn)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, ErrMetadataNotFound) {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// FileProvider читает JSON-файл вида {"9785...": {...BookMetadata}}.
+// Подходит для работы без сети и для тестов. Файл читается при первом
+// удачном обращении; ошибка чтения не запоминается, следующий запрос
+// попробует снова.
+type FileProvider struct {
+	Path string
+
+	mu   sync.Mutex
+	data map[string]BookMetadata
+}
+
+func (f *FileProvider) load() (map[string]BookMetadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data != nil {
+		return f.data, nil
+	}
+	raw, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	var in map[string]BookMetadata
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	data := make(map[string]BookMetadata, len(in))
+	for k, v := range in {
+		if n, err := NormalizeISBN(k); err == nil {
+			v.ISBN = n
+			data[n] = v
+		}
+	}
+	f.data = data
+	return data, nil
+}
+
+func (f *FileProvider) Lookup(_ context.Context, isbn string) (*BookMetadata, error) {
+	data, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	m, ok := data[isbn]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	return &m, nil
+}
+
+// OpenLibraryProvider обращается к Books API в формате Open Library
+// (GET /api/books?bibkeys=ISBN:...&format=json&jscmd=data).
+type OpenLibraryProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibraryProvider(baseURL string) *OpenLibraryProvider {
+	return &OpenLibraryProvider{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type olName struct {
+	Name string `json:"name"`
+}
+
+type olBook struct {
+	Title         string   `json:"title"`
+	Subtitle      string   `json:"subtitle"`
+	Authors       []olName `json:"authors"`
+	Publishers    []olName `json:"publishers"`
+	PublishPlaces []olName `json:"publish_places"`
+	PublishDate   string   `json:"publish_date"`
+	NumberOfPages int      `json:"number_of_pages"`
+}
+
+func (p *OpenLibraryProvider) Lookup(ctx context.Context, isbn string) (*BookMetadata, error) {
+	key := "ISBN:" + isbn
+	u := p.BaseURL + "/api/books?" + url.Values{
+		"bibkeys": {key},
+		"format":  {"json"},
+		"jscmd":   {"data"},
+	}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata provider: %s", resp.Status)
+	}
+	var out map[string]olBook
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	b, ok := out[key]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	m := &BookMetadata{ISBN: isbn, Title: b.Title, Pages: b.NumberOfPages}
+	if b.Subtitle != "" {
+		m.Title += ": " + b.Subtitle
+	}
+	for _, a := range b.Authors {
+		m.Authors = append(m.Authors, a.Name)
+	}
+	if len(b.Publishers) > 0 {
+		m.Publisher = b.Publishers[0].Name
+	}
+	if len(b.PublishPlaces) > 0 {
+		m.Place = b.PublishPlaces[0].Name
+	}
+	m.Year, _ = strconv.Atoi(reYear.FindString(b.PublishDate))
+	return m, nil
+}
+
+// findDict ищет запись справочника по имени без учёта регистра, не создавая новую.
+func (a *API) findDict(ctx context.Context, d *dictionary, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	var id string
+	err := a.db.QueryRow(ctx, `SELECT id FROM `+d.table()+` WHERE lower(name)=lower($1) LIMIT 1`, name).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
+func (a *API) lookupBook(w http.ResponseWriter, r *http.Request) {
+	isbn, err := NormalizeISBN(r.URL.Query().Get("isbn"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if a.meta == nil {
+		bad(w, fmt.Errorf("metadata lookup is not configured"), 501)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	m, err := a.meta.Lookup(ctx, isbn)
+	if errors.Is(err, ErrMetadataNotFound) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 502)
+		return
+	}
+
+	proposed := BookUpsert{Title: m.Title, PubYear: m.Year, Pages: m.Pages, Copies: 1, ISBN: isbn}
+	if len(m.Authors) > 0 {
+		if proposed.AuthorID, err = a.findDict(ctx, dictByName("authors"), m.Authors[0]); err != nil {
+			bad(w, err, 500)
+			return
+		}
+	}
+	if proposed.PlaceID, err = a.findDict(ctx, dictByName("places"), m.Place); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if proposed.PublisherID, err = a.findDict(ctx, dictByName("publishers"), m.Publisher); err != nil {
+		bad(w, err, 500)
+		return
+	}
+
+	res := struct {
+		Book       BookUpsert   `json:"book"`
+		Metadata   BookMetadata `json:"metadata"`
+		ExistingID *string      `json:"existing_book_id,omitempty"`
+	}{Book: proposed, Metadata: *m}
+	var existing string
+	if err := a.db.QueryRow(ctx, `SELECT id FROM books WHERE isbn=$1`, isbn).Scan(&existing); err == nil {
+		res.ExistingID = &existing
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	p := &FileProvider{Path: filepath.Join("testdata", "metadata.json")}
+	ctx := context.Background()
+	// ключи файла нормализуются: ISBN-10 с дефисами находится по ISBN-13
+	m, err := p.Lookup(ctx, "9785699120147")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BookMetadata{ISBN: "9785699120147", Title: "Евгений Онегин", Authors: []string{"Пушкин А.С."},
+		Publisher: "Эксмо", Place: "Москва", Year: 2006, Pages: 352}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+	if _, err := p.Lookup(ctx, "9780306406157"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("missing isbn: %v", err)
+	}
+}
+
+// Ошибка чтения не запоминается: появившийся файл подхватывается.
+func TestFileProviderRetriesLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.json")
+	p := &FileProvider{Path: path}
+	ctx := context.Background()
+	if _, err := p.Lookup(ctx, "9785699120147"); err == nil || errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("missing file: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Lookup(ctx, "9785699120147"); err != nil {
+		t.Errorf("after file appeared: %v", err)
+	}
+}
+
+type stubProvider struct {
+	m     *BookMetadata
+	err   error
+	calls int
+}
+
+func (s *stubProvider) Lookup(context.Context, string) (*BookMetadata, error) {
+	s.calls++
+	return s.m, s.err
+}
+
+func TestChainProvider(t *testing.T) {
+	ctx := context.Background()
+	found := &BookMetadata{Title: "found"}
+	down := errors.New("connection refused")
+
+	miss, hit, after := &stubProvider{err: ErrMetadataNotFound}, &stubProvider{m: found}, &stubProvider{m: &BookMetadata{}}
+	if m, err := (ChainProvider{miss, hit, after}).Lookup(ctx, "9785699120147"); err != nil || m != found {
+		t.Errorf("got %v, %v", m, err)
+	}
+	if after.calls != 0 {
+		t.Error("lookup continued after a hit")
+	}
+	// недоступный источник не мешает следующему
+	if m, err := (ChainProvider{&stubProvider{err: down}, hit}).Lookup(ctx, "9785699120147"); err != nil || m != found {
+		t.Errorf("fallback after error: %v, %v", m, err)
+	}
+	// никто не нашёл, но один источник сломан — отдаём его ошибку, а не «не найдено»
+	if _, err := (ChainProvider{&stubProvider{err: down}, miss}).Lookup(ctx, "9785699120147"); !errors.Is(err, down) {
+		t.Errorf("got %v, want %v", err, down)
+	}
+	if _, err := (ChainProvider{miss, miss}).Lookup(ctx, "9785699120147"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("all missed: %v", err)
+	}
+	if _, err := (ChainProvider{}).Lookup(ctx, "9785699120147"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("empty chain: %v", err)
+	}
+}
+
+func TestOpenLibraryProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/books" || q.Get("format") != "json" || q.Get("jscmd") != "data" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch q.Get("bibkeys") {
+		case "ISBN:9780201616224":
+			w.Write([]byte(`{"ISBN:9780201616224": {
+  "title": "The pragmatic programmer", "subtitle": "from journeyman to master",
+  "authors": [{"name": "Andrew Hunt"}, {"name": "David Thomas"}],
+  "publishers": [{"name": "Addison-Wesley"}, {"name": "Pearson"}],
+  "publish_places": [{"name": "Reading, Mass"}],
+  "publish_date": "October 1999", "number_of_pages": 321}}`))
+		case "ISBN:9780306406157":
+			w.Write([]byte(`{}`))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	p := NewOpenLibraryProvider(srv.URL + "/")
+	ctx := context.Background()
+
+	m, err := p.Lookup(ctx, "9780201616224")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BookMetadata{ISBN: "9780201616224", Title: "The pragmatic programmer: from journeyman to master",
+		Authors: []string{"Andrew Hunt", "David Thomas"}, Publisher: "Addison-Wesley", Place: "Reading, Mass",
+		Year: 1999, Pages: 321}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+	if _, err := p.Lookup(ctx, "9780306406157"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("unknown isbn: %v", err)
+	}
+	if _, err := p.Lookup(ctx, "9785699120147"); err == nil || errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("server error: %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const marcXMLNS = "http://www.loc.gov/MARC21/slim"
+
+type MarcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type MarcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type MarcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []MarcSubfield `xml:"subfield"`
+}
+
+type MarcRecord struct {
+	XMLName xml.Name           `xml:"record"`
+	Leader  string             `xml:"leader"`
+	Control []MarcControlField `xml:"controlfield"`
+	Data    []MarcDataField    `xml:"datafield"`
+}
+
+type marcCollection struct {
+	XMLName xml.Name     `xml:"collection"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Records []MarcRecord `xml:"record"`
+}
+
+// Values возвращает все подполя code во всех полях tag.
+func (m MarcRecord) Values(tag, code string) []string {
+	var out []string
+	for _, f := range m.Data {
+		if f.Tag != tag {
+			continue
+		}
+		for _, sf := range f.Subfields {
+			if sf.Code == code {
+				out = append(out, strings.TrimSpace(sf.Value))
+			}
+		}
+	}
+	return out
+}
+
+func (m MarcRecord) Value(tag, code string) string {
+	if v := m.Values(tag, code); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (m *MarcRecord) add(tag string, subfields ...string) {
+	f := MarcDataField{Tag: tag, Ind1: " ", Ind2: " "}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if subfields[i+1] == "" {
+			continue
+		}
+		f.Subfields = append(f.Subfields, MarcSubfield{Code: subfields[i], Value: subfields[i+1]})
+	}
+	if len(f.Subfields) > 0 {
+		m.Data = append(m.Data, f)
+	}
+}
+
+const (
+	isoRecordEnd = 0x1D
+	isoFieldEnd  = 0x1E
+	isoSubfield  = 0x1F
+)
+
+// ParseISO2709 разбирает поток записей MARC21 в формате ISO 2709.
+// Данные ожидаются в UTF-8.
+func ParseISO2709(data []byte) ([]MarcRecord, error) {
+	var out []MarcRecord
+	for len(bytes.TrimSpace(data)) > 0 {
+		end := bytes.IndexByte(data, isoRecordEnd)
+		if end < 0 {
+			end = len(data)
+		}
+		raw := bytes.TrimLeft(data[:end], "\r\n ")
+		if end < len(data) {
+			data = data[end+1:]
+		} else {
+			data = nil
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		rec, err := parseISORecord(raw)
+		if err != nil {
+			return out, fmt.Errorf("record %d: %w", len(out)+1, err)
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func parseISORecord(raw []byte) (MarcRecord, error) {
+	if len(raw) < 24 {
+		return MarcRecord{}, errors.New("record shorter than leader")
+	}
+	rec := MarcRecord{Leader: string(raw[:24])}
+	base, ok := isoNumber(raw[12:17])
+	if !ok || base <= 24 || base > len(raw) {
+		return MarcRecord{}, errors.New("bad base address of data")
+	}
+	dir := raw[24 : base-1]
+	if len(dir)%12 != 0 {
+		return MarcRecord{}, errors.New("bad directory length")
+	}
+	for i := 0; i < len(dir); i += 12 {
+		tag := string(dir[i : i+3])
+		length, ok1 := isoNumber(dir[i+3 : i+7])
+		start, ok2 := isoNumber(dir[i+7 : i+12])
+		if !ok1 || !ok2 || base+start+length > len(raw) {
+			return MarcRecord{}, fmt.Errorf("bad directory entry for %s", tag)
+		}
+		body := bytes.TrimRight(raw[base+start:base+start+length], string([]byte{isoFieldEnd}))
+		if tag < "010" {
+			rec.Control = append(rec.Control, MarcControlField{Tag: tag, Value: string(body)})
+			continue
+		}
+		f := MarcDataField{Tag: tag, Ind1: " ", Ind2: " "}
+		if len(body) >= 2 {
+			f.Ind1, f.Ind2 = string(body[0]), string(body[1])
+			body = body[2:]
+		}
+		for _, part := range bytes.Split(body, []byte{isoSubfield}) {
+			if len(part) == 0 {
+				continue
+			}
+			f.Subfields = append(f.Subfields, MarcSubfield{Code: string(part[0]), Value: string(part[1:])})
+		}
+		rec.Data = append(rec.Data, f)
+	}
+	return rec, nil
+}
+
+// isoNumber разбирает числовое поле лидера или справочника: только цифры,
+// знаки и пробелы (strconv.Atoi принял бы "-001") не допускаются.
+func isoNumber(b []byte) (int, bool) {
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, len(b) > 0
+}
+
+// ParseMARCXML читает как <collection>, так и одиночную <record>.
+func ParseMARCXML(r io.Reader) ([]MarcRecord, error) {
+	dec := xml.NewDecoder(r)
+	var out []MarcRecord
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "record" {
+			continue
+		}
+		var rec MarcRecord
+		if err := dec.DecodeElement(&rec, &se); err != nil {
+			return out, err
+		}
+		out = append(out, rec)
+	}
+}
+
+func WriteMARCXML(w io.Writer, recs []MarcRecord) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(marcCollection{Xmlns: marcXMLNS, Records: recs}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type marcBook struct {
+	Title     string
+	Author    string
+	CoAuthors []string
+	Place     string
+	Publisher string
+	Year      int
+	Pages     int
+	ISBN      string
+}
+
+var (
+	reYear   = regexp.MustCompile(`\d{4}`)
+	reNumber = regexp.MustCompile(`\d+`)
+)
+
+// ISBD-пунктуация в конце подполей (" /", " :", ",", ".").
+func marcClean(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), " /:;,=["))
+}
+
+// "Hunt, Andrew." -> "Hunt, Andrew", но "Пушкин А.С." остаётся как есть.
+func marcCleanName(s string) string {
+	s = marcClean(s)
+	if !strings.HasSuffix(s, ".") {
+		return s
+	}
+	last := s[strings.LastIndexAny(s, " ,")+1 : len(s)-1]
+	if len([]rune(last)) > 1 && !strings.Contains(last, ".") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func marcToBook(m MarcRecord) marcBook {
+	var b marcBook
+	b.Title = marcClean(m.Value("245", "a"))
+	if sub := marcClean(m.Value("245", "b")); sub != "" {
+		b.Title += ": " + sub
+	}
+	b.Author = marcCleanName(m.Value("100", "a"))
+	for _, n := range m.Values("700", "a") {
+		if n = marcCleanName(n); n != "" && n != b.Author {
+			b.CoAuthors = append(b.CoAuthors, n)
+		}
+	}
+	if b.Author == "" && len(b.CoAuthors) > 0 {
+		b.Author, b.CoAuthors = b.CoAuthors[0], b.CoAuthors[1:]
+	}
+	for _, tag := range []string{"264", "260"} {
+		if b.Place == "" {
+			b.Place = strings.Trim(marcClean(m.Value(tag, "a")), "[]")
+		}
+		if b.Publisher == "" {
+			b.Publisher = strings.Trim(marcClean(m.Value(tag, "b")), "[]")
+		}
+		if b.Year == 0 {
+			b.Year, _ = strconv.Atoi(reYear.FindString(m.Value(tag, "c")))
+		}
+	}
+	b.Pages, _ = strconv.Atoi(reNumber.FindString(m.Value("300", "a")))
+	for _, v := range m.Values("020", "a") {
+		// "5-699-12014-7 (в пер.)" — берём первый валидный номер
+		f := strings.Fields(v)
+		if len(f) == 0 {
+			continue
+		}
+		if n, err := NormalizeISBN(f[0]); err == nil {
+			b.ISBN = n
+			break
+		}
+	}
+	return b
+}
+
+func bookToMarc(b BookRow, coauthors []string) MarcRecord {
+	m := MarcRecord{
+		Leader:  "00000nam a2200000 i 4500",
+		Control: []MarcControlField{{Tag: "001", Value: b.ID}},
+	}
+	if b.ISBN != nil {
+		m.add("020", "a", *b.ISBN)
+	}
+	m.add("100", "a", b.AuthorName)
+	m.add("245", "a", b.Title)
+	m.add("264", "a", b.PlaceName, "b", b.PublisherName, "c", strconv.Itoa(b.PubYear))
+	m.add("300", "a", fmt.Sprintf("%d p.", b.Pages))
+	m.add("653", "a", b.GroupName)
+	for _, n := range coauthors {
+		m.add("700", "a", n)
+	}
+	m.add("852", "b", b.RoomName)
+	return m
+}
+
+// matchDict находит запись справочника по имени без учёта регистра или создаёт новую.
+func matchDict(ctx context.Context, tx pgx.Tx, d *dictionary, name string) (string, error) {
+	var id string
+	err := tx.QueryRow(ctx, `SELECT id FROM `+d.table()+` WHERE lower(name)=lower($1) LIMIT 1`, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+	err = tx.QueryRow(ctx, `INSERT INTO `+d.table()+`(name) VALUES($1) RETURNING id`, name).Scan(&id)
+	return id, err
+}
+
+func (a *API) importMarcBook(ctx context.Context, b marcBook, groupID, roomID string) (string, error) {
+	if b.Title == "" || b.Author == "" || b.Place == "" || b.Publisher == "" || b.Year == 0 {
+		return "", errors.New("missing 245/100/260 data")
+	}
+	if b.Pages <= 0 {
+		b.Pages = 1
+	}
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	authorID, err := matchDict(ctx, tx, dictByName("authors"), b.Author)
+	if err != nil {
+		return "", err
+	}
+	placeID, err := matchDict(ctx, tx, dictByName("places"), b.Place)
+	if err != nil {
+		return "", err
+	}
+	publisherID, err := matchDict(ctx, tx, dictByName("publishers"), b.Publisher)
+	if err != nil {
+		return "", err
+	}
+	var isbn *string
+	if b.ISBN != "" {
+		isbn = &b.ISBN
+	}
+	workID, err := ensureWork(ctx, tx, b.Title, authorID)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	if err := tx.QueryRow(ctx, `
+INSERT INTO books(name, reading_room_id, author_id, place_publication_id, published_house_id,
+                  year_publication, book_group_id, pages, number_copies, isbn, work_id)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,1,$9,$10)
+RETURNING id`, b.Title, roomID, authorID, placeID, publisherID, b.Year, groupID, b.Pages, isbn, workID).Scan(&id); err != nil {
+		return "", err
+	}
+	for i, n := range b.CoAuthors {
+		coID, err := matchDict(ctx, tx, dictByName("authors"), n)
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO book_coauthors(book_id, author_id, position) VALUES($1,$2,$3) ON CONFLICT DO NOTHING`, id, coID, i); err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit(ctx)
+}
+
+func (a *API) importMarc(w http.ResponseWriter, r *http.Request) {
+	groupID := r.URL.Query().Get("group_id")
+	roomID := r.URL.Query().Get("room_id")
+	if groupID == "" || roomID == "" {
+		bad(w, fmt.Errorf("group_id and room_id required"), 400)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 32<<20))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var recs []MarcRecord
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "iso2709"
+		if t := bytes.TrimSpace(data); len(t) > 0 && t[0] == '<' {
+			format = "marcxml"
+		}
+	}
+	switch format {
+	case "marcxml":
+		recs, err = ParseMARCXML(bytes.NewReader(data))
+	case "iso2709":
+		recs, err = ParseISO2709(data)
+	default:
+		bad(w, fmt.Errorf("format must be marcxml or iso2709"), 400)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+
+	type skipped struct {
+		Record int    `json:"record"`
+		Title  string `json:"title"`
+		Error  string `json:"error"`
+	}
+	res := struct {
+		Imported []string  `json:"imported"`
+		Skipped  []skipped `json:"skipped"`
+	}{Imported: []string{}, Skipped: []skipped{}}
+
+	ctx := context.Background()
+	for i, rec := range recs {
+		b := marcToBook(rec)
+		id, err := a.importMarcBook(ctx, b, groupID, roomID)
+		if err != nil {
+			res.Skipped = append(res.Skipped, skipped{Record: i + 1, Title: b.Title, Error: err.Error()})
+			continue
+		}
+		res.Imported = append(res.Imported, id)
+	}
+	writeJSON(w, res)
+}
+
+func (a *API) coauthorNames(ctx context.Context, ids []string) (map[string][]string, error) {
+	rows, err := a.db.Query(ctx, `
+SELECT bc.book_id, a.name
+FROM book_coauthors bc
+JOIN book_authors a ON a.id = bc.author_id
+WHERE bc.book_id = ANY($1::uuid[])
+ORDER BY bc.position, a.name`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string][]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], name)
+	}
+	return out, rows.Err()
+}
+
+func (a *API) writeMarcBooks(w http.ResponseWriter, books []BookRow) {
+	ids := make([]string, len(books))
+	for i, b := range books {
+		ids[i] = b.ID
+	}
+	co, err := a.coauthorNames(context.Background(), ids)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	recs := make([]MarcRecord, len(books))
+	for i, b := range books {
+		recs[i] = bookToMarc(b, co[b.ID])
+	}
+	w.Header().Set("Content-Type", "application/marcxml+xml; charset=utf-8")
+	_ = WriteMARCXML(w, recs)
+}
+
+func (a *API) exportMarc(w http.ResponseWriter, r *http.Request) {
+	where, args := bookFilter(r)
+	books, err := a.queryBooks(where, args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="catalogue.xml"`)
+	a.writeMarcBooks(w, books)
+}
+
+func (a *API) exportBookMarc(w http.ResponseWriter, r *http.Request) {
+	books, err := a.queryBooks(" WHERE b.id=$1", chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if len(books) == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.writeMarcBooks(w, books)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var marcFixtureBooks = []marcBook{
+	{
+		Title:     "Евгений Онегин: роман в стихах",
+		Author:    "Пушкин А.С.",
+		Place:     "Москва",
+		Publisher: "Эксмо",
+		Year:      2006,
+		Pages:     352,
+		ISBN:      "9785699120147",
+	},
+	{
+		Title:     "The pragmatic programmer: from journeyman to master",
+		Author:    "Hunt, Andrew",
+		CoAuthors: []string{"Thomas, David"},
+		Place:     "Reading, Mass.",
+		Publisher: "Addison-Wesley",
+		Year:      1999,
+		Pages:     321,
+		ISBN:      "9780201616224",
+	},
+}
+
+func readMarcFixture(t *testing.T, name string) []MarcRecord {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []MarcRecord
+	if filepath.Ext(name) == ".xml" {
+		recs, err = ParseMARCXML(bytes.NewReader(data))
+	} else {
+		recs, err = ParseISO2709(data)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+// marcBookRow — книга в том виде, в каком её вернул бы каталог после импорта.
+func marcBookRow(id string, b marcBook) BookRow {
+	row := BookRow{
+		ID:            id,
+		Title:         b.Title,
+		AuthorName:    b.Author,
+		PlaceName:     b.Place,
+		PublisherName: b.Publisher,
+		PubYear:       b.Year,
+		Pages:         b.Pages,
+	}
+	if b.ISBN != "" {
+		row.ISBN = &b.ISBN
+	}
+	return row
+}
+
+// Импорт → экспорт в MARCXML → повторный импорт даёт те же книги.
+func TestMarcRoundTrip(t *testing.T) {
+	for _, name := range []string{"books.mrc", "books.xml"} {
+		t.Run(name, func(t *testing.T) {
+			recs := readMarcFixture(t, name)
+			if len(recs) != len(marcFixtureBooks) {
+				t.Fatalf("got %d records, want %d", len(recs), len(marcFixtureBooks))
+			}
+			var exported []MarcRecord
+			for i, rec := range recs {
+				b := marcToBook(rec)
+				if !reflect.DeepEqual(b, marcFixtureBooks[i]) {
+					t.Fatalf("record %d imported as %+v, want %+v", i+1, b, marcFixtureBooks[i])
+				}
+				exported = append(exported, bookToMarc(marcBookRow(rec.Control[0].Value, b), b.CoAuthors))
+			}
+
+			var buf bytes.Buffer
+			if err := WriteMARCXML(&buf, exported); err != nil {
+				t.Fatal(err)
+			}
+			again, err := ParseMARCXML(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(again) != len(recs) {
+				t.Fatalf("re-import got %d records, want %d", len(again), len(recs))
+			}
+			for i, rec := range again {
+				if b := marcToBook(rec); !reflect.DeepEqual(b, marcFixtureBooks[i]) {
+					t.Errorf("record %d re-imported as %+v, want %+v", i+1, b, marcFixtureBooks[i])
+				}
+				if rec.Control[0].Value != recs[i].Control[0].Value {
+					t.Errorf("record %d: 001 %q, want %q", i+1, rec.Control[0].Value, recs[i].Control[0].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseISO2709Malformed(t *testing.T) {
+	good, err := os.ReadFile(filepath.Join("testdata", "books.mrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := good[:bytes.IndexByte(good, isoRecordEnd)+1]
+	patch := func(at int, s string) []byte {
+		b := bytes.Clone(first)
+		copy(b[at:], s)
+		return b
+	}
+	for name, data := range map[string][]byte{
+		"short leader":      []byte("00024nam"),
+		"base address 24":   patch(12, "00024"),
+		"base past end":     patch(12, "99999"),
+		"signed base":       patch(12, "-0061"),
+		"signed length":     patch(24+3, "-001"),
+		"signed start":      patch(24+7, "-0001"),
+		"length past end":   patch(24+3, "9999"),
+		"non-digit in dir":  patch(24+3, "00x4"),
+		"bad dir alignment": patch(12, "00060"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseISO2709(data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,600 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Уведомления читателей: напоминание о сроке возврата, нарастающие
+// напоминания о просрочке и об окончании срока читательского билета.
+// Сообщения сначала попадают в notification_outbox, затем рассылаются
+// с повторами через настроенные каналы (email, sms).
+
+// Message — одно сообщение для канала доставки.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier доставляет сообщения по одному каналу.
+type Notifier interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTPNotifier отправляет письма через SMTP-сервер; без Username — без авторизации.
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+	// ограничение на всю отправку письма, если у ctx нет своего срока
+	Timeout time.Duration
+}
+
+const smtpTimeout = 30 * time.Second
+
+func (s *SMTPNotifier) Send(ctx context.Context, m Message) error {
+	// адрес попадает в заголовки письма: перевод строки добавил бы свои
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(s.From, "\r\n") {
+		return fmt.Errorf("bad email address %q", m.To)
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = smtpTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	// зависший сервер не должен держать рассылку: срок ctx — срок соединения
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(wc, "From: %s\r\n", s.From)
+	fmt.Fprintf(wc, "To: %s\r\n", m.To)
+	fmt.Fprintf(wc, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(wc, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	io.WriteString(wc, "MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	io.WriteString(wc, strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// SMSGateway отправляет SMS через HTTP-шлюз: POST {"to", "text"} на URL,
+// Token передаётся как Bearer.
+type SMSGateway struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func NewSMSGateway(url, token string) *SMSGateway {
+	return &SMSGateway{URL: url, Token: token, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (g *SMSGateway) Send(ctx context.Context, m Message) error {
+	body, _ := json.Marshal(map[string]string{"to": m.To, "text": m.Body})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sms gateway: %s", resp.Status)
+	}
+	return nil
+}
+
+// FileNotifier дописывает сообщения строками JSON в файл — для отладки и проверок.
+type FileNotifier struct {
+	Path    string
+	Channel string
+	mu      sync.Mutex
+}
+
+func (f *FileNotifier) Send(_ context.Context, m Message) error {
+	line, _ := json.Marshal(struct {
+		Time    string `json:"time"`
+		Channel string `json:"channel"`
+		Message
+	}{time.Now().Format(time.RFC3339), f.Channel, m})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fh, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fh.Write(append(line, '\n')); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+const (
+	notifyEmail = "email"
+	notifySMS   = "sms"
+
+	notifyDueSoon    = "due_soon"
+	notifyOverdue    = "overdue"
+	notifyCardExpiry = "card_expiry"
+
+	// за сколько дней напоминать о сроке возврата и об окончании билета
+	dueSoonDays    = 3
+	cardExpiryDays = 30
+
+	notifyBatch       = 50
+	notifyMaxAttempts = 5
+)
+
+// overdueLevels — через сколько дней просрочки отправляются 1-е, 2-е и последнее напоминания.
+var overdueLevels = []int{1, 7, 21}
+
+type notifyTemplate struct {
+	Subject string
+	Body    string
+}
+
+// notifyData — поля, доступные в шаблонах.
+type notifyData struct {
+	Name    string
+	Ticket  int
+	Title   string
+	Due     string
+	Days    int
+	Level   int
+	Final   bool
+	Expires string
+}
+
+var notifyTemplates = map[string]map[string]notifyTemplate{
+	notifyDueSoon: {
+		"ru": {
+			Subject: "Срок возврата книги {{.Due}}",
+			Body: `Здравствуйте, {{.Name}}!
+Напоминаем, что «{{.Title}}» нужно вернуть в библиотеку до {{.Due}}.
+Продлить выдачу можно в личном кабинете (билет № {{.Ticket}}).`,
+		},
+		"en": {
+			Subject: "Book due on {{.Due}}",
+			Body: `Dear {{.Name}},
+"{{.Title}}" is due back at the library on {{.Due}}.
+You can renew it in the reader portal (card no. {{.Ticket}}).`,
+		},
+	},
+	notifyOverdue: {
+		"ru": {
+			Subject: "Просрочен возврат книги{{if .Final}} — последнее напоминание{{end}}",
+			Body: `Здравствуйте, {{.Name}}!
+Срок возврата «{{.Title}}» истёк {{.Due}} (просрочка {{.Days}} дн.).
+{{if .Final}}Это последнее напоминание. Пожалуйста, верните книгу как можно скорее, иначе выдача будет приостановлена.{{else}}Пожалуйста, верните книгу в библиотеку.{{end}}`,
+		},
+		"en": {
+			Subject: "Overdue book{{if .Final}} — final notice{{end}}",
+			Body: `Dear {{.Name}},
+"{{.Title}}" was due on {{.Due}} and is {{.Days}} day(s) overdue.
+{{if .Final}}This is the final notice. Please return the book as soon as possible or your borrowing will be suspended.{{else}}Please return the book to the library.{{end}}`,
+		},
+	},
+	notifyCardExpiry: {
+		"ru": {
+			Subject: "Срок действия читательского билета истекает {{.Expires}}",
+			Body: `Здравствуйте, {{.Name}}!
+Читательский билет № {{.Ticket}} действителен до {{.Expires}}. Продлить его можно в библиотеке.`,
+		},
+		"en": {
+			Subject: "Your library card expires on {{.Expires}}",
+			Body: `Dear {{.Name}},
+Library card no. {{.Ticket}} is valid until {{.Expires}}. You can renew it at the library.`,
+		},
+	},
+}
+
+func renderNotification(kind, lang string, d notifyData) (Message, error) {
+	t, ok := notifyTemplates[kind][lang]
+	if !ok {
+		t = notifyTemplates[kind]["ru"]
+	}
+	var m Message
+	for _, p := range []struct {
+		src string
+		dst *string
+	}{{t.Subject, &m.Subject}, {t.Body, &m.Body}} {
+		tpl, err := template.New(kind).Parse(p.src)
+		if err != nil {
+			return m, err
+		}
+		var b strings.Builder
+		if err := tpl.Execute(&b, d); err != nil {
+			return m, err
+		}
+		*p.dst = b.String()
+	}
+	return m, nil
+}
+
+// notifyTarget — получатель уведомления и его контакты.
+type notifyTarget struct {
+	UserID string
+	LoanID *string
+	Email  *string
+	Phone  *string
+	Lang   string
+}
+
+// channel выбирает канал: email, если он есть у читателя и настроен, иначе sms.
+func (a *API) channel(t notifyTarget) (string, string) {
+	if t.Email != nil && *t.Email != "" && a.notifiers[notifyEmail] != nil {
+		return notifyEmail, *t.Email
+	}
+	if t.Phone != nil && *t.Phone != "" && a.notifiers[notifySMS] != nil {
+		return notifySMS, *t.Phone
+	}
+	return "", ""
+}
+
+// enqueue ставит уведомление в очередь; повтор с тем же dedupKey игнорируется.
+func (a *API) enqueue(ctx context.Context, t notifyTarget, kind, dedupKey string, d notifyData) (bool, error) {
+	ch, to := a.channel(t)
+	if ch == "" {
+		return false, nil
+	}
+	m, err := renderNotification(kind, t.Lang, d)
+	if err != nil {
+		return false, err
+	}
+	cmd, err := a.db.Exec(ctx, `
+INSERT INTO notification_outbox(user_id, loan_id, kind, channel, recipient, subject, body, dedup_key)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT (dedup_key) DO NOTHING`,
+		t.UserID, t.LoanID, kind, ch, to, m.Subject, m.Body, dedupKey)
+	return err == nil && cmd.RowsAffected() > 0, err
+}
+
+// enqueueNotifications находит выдачи и билеты, о которых пора напомнить.
+func (a *API) enqueueNotifications(ctx context.Context) (int, error) {
+	day := today()
+	queued := 0
+	rows, err := a.db.Query(ctx, `
+SELECT ab.id, u.id, u.name, u.ticket_number, u.email, u.phone, u.notify_lang, `+loanTitle+`, ab.date_due
+FROM accounting_books ab
+JOIN users u ON u.id = ab.user_id
+LEFT JOIN books b ON b.id = ab.book_id
+LEFT JOIN serial_issues si ON si.id = ab.issue_id
+LEFT JOIN serials s ON s.id = si.serial_id
+WHERE ab.date_return IS NULL AND ab.loan_type = $3 AND NOT u.notify_opt_out
+  AND ab.date_due <= $1::date + $2::int`, day, dueSoonDays, lendTakeHome)
+	if err != nil {
+		return 0, err
+	}
+	type dueLoan struct {
+		t   notifyTarget
+		d   notifyData
+		due time.Time
+	}
+	var loans []dueLoan
+	for rows.Next() {
+		var n dueLoan
+		var loanID string
+		if err := rows.Scan(&loanID, &n.t.UserID, &n.d.Name, &n.d.Ticket, &n.t.Email, &n.t.Phone, &n.t.Lang,
+			&n.d.Title, &n.due); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		n.t.LoanID = &loanID
+		n.d.Due = dmy(n.due)
+		loans = append(loans, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, n := range loans {
+		kind, key := loanNotice(*n.t.LoanID, n.due, day, &n.d)
+		if kind == "" {
+			continue
+		}
+		ok, err := a.enqueue(ctx, n.t, kind, key, n.d)
+		if err != nil {
+			return queued, err
+		}
+		if ok {
+			queued++
+		}
+	}
+
+	rows, err = a.db.Query(ctx, `
+SELECT id, name, ticket_number, email, phone, notify_lang, card_expires
+FROM users
+WHERE NOT notify_opt_out AND card_expires BETWEEN $1::date AND $1::date + $2::int`, day, cardExpiryDays)
+	if err != nil {
+		return queued, err
+	}
+	type cardNotice struct {
+		t   notifyTarget
+		d   notifyData
+		exp time.Time
+	}
+	var cards []cardNotice
+	for rows.Next() {
+		var n cardNotice
+		if err := rows.Scan(&n.t.UserID, &n.d.Name, &n.d.Ticket, &n.t.Email, &n.t.Phone, &n.t.Lang, &n.exp); err != nil {
+			rows.Close()
+			return queued, err
+		}
+		n.d.Expires = dmy(n.exp)
+		cards = append(cards, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return queued, err
+	}
+	for _, n := range cards {
+		key := fmt.Sprintf("%s:%s:%s", notifyCardExpiry, n.t.UserID, n.exp.Format("2006-01-02"))
+		ok, err := a.enqueue(ctx, n.t, notifyCardExpiry, key, n.d)
+		if err != nil {
+			return queued, err
+		}
+		if ok {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// loanNotice выбирает напоминание по выдаче со сроком due на день day и
+// заполняет Days, Level и Final в d. Ключ дедупликации включает срок (после
+// продления напоминания начинаются заново) и уровень просрочки: каждое
+// следующее напоминание уходит один раз. Пустой kind — напоминать не о чем.
+func loanNotice(loanID string, due, day time.Time, d *notifyData) (kind, key string) {
+	if !due.Before(day) {
+		d.Days = int(due.Sub(day).Hours() / 24)
+		return notifyDueSoon, fmt.Sprintf("%s:%s:%s", notifyDueSoon, loanID, due.Format("2006-01-02"))
+	}
+	d.Days = int(day.Sub(due).Hours() / 24)
+	d.Level = 0
+	for i, l := range overdueLevels {
+		if d.Days >= l {
+			d.Level = i + 1
+		}
+	}
+	if d.Level == 0 {
+		return "", ""
+	}
+	d.Final = d.Level == len(overdueLevels)
+	return notifyOverdue, fmt.Sprintf("%s:%s:%s:%d", notifyOverdue, loanID, due.Format("2006-01-02"), d.Level)
+}
+
+// retryAfter — пауза перед следующей попыткой после attempts неудачных
+// (5, 20, 45… минут) и не пора ли сдаться.
+func retryAfter(attempts int) (time.Duration, bool) {
+	return time.Duration(5*attempts*attempts) * time.Minute, attempts >= notifyMaxAttempts
+}
+
+type outboxItem struct {
+	ID       string
+	Channel  string
+	Attempts int
+	Message
+}
+
+// deliverNotifications рассылает накопившиеся сообщения. Неудачная отправка
+// повторяется с растущей паузой, после notifyMaxAttempts попыток — failed.
+func (a *API) deliverNotifications(ctx context.Context) (sent, failed int, err error) {
+	// вернули книгу или отказались от рассылки — напоминание больше не нужно
+	if _, err := a.db.Exec(ctx, `
+UPDATE notification_outbox o SET status = 'cancelled'
+FROM users u
+WHERE o.status = 'pending' AND u.id = o.user_id
+  AND (u.notify_opt_out
+       OR EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.id = o.loan_id AND ab.date_return IS NOT NULL))`); err != nil {
+		return 0, 0, err
+	}
+	for {
+		// строки «арендуются» сдвигом next_attempt_at, чтобы параллельная рассылка их не взяла
+		rows, err := a.db.Query(ctx, `
+UPDATE notification_outbox SET attempts = attempts + 1, next_attempt_at = now() + interval '10 minutes'
+WHERE id IN (SELECT id FROM notification_outbox
+             WHERE status = 'pending' AND next_attempt_at <= now()
+             ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+RETURNING id, channel, attempts, recipient, subject, body`, notifyBatch)
+		if err != nil {
+			return sent, failed, err
+		}
+		var batch []outboxItem
+		for rows.Next() {
+			var it outboxItem
+			if err := rows.Scan(&it.ID, &it.Channel, &it.Attempts, &it.To, &it.Subject, &it.Body); err != nil {
+				rows.Close()
+				return sent, failed, err
+			}
+			batch = append(batch, it)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return sent, failed, err
+		}
+		if len(batch) == 0 {
+			return sent, failed, nil
+		}
+		for _, it := range batch {
+			err := fmt.Errorf("channel %s is not configured", it.Channel)
+			if n := a.notifiers[it.Channel]; n != nil {
+				err = n.Send(ctx, it.Message)
+			}
+			if err == nil {
+				sent++
+				_, err = a.db.Exec(ctx, `
+UPDATE notification_outbox SET status = 'sent', sent_at = now(), last_error = NULL WHERE id=$1`, it.ID)
+			} else {
+				status := "pending"
+				delay, giveUp := retryAfter(it.Attempts)
+				if giveUp {
+					status = "failed"
+					failed++
+				}
+				_, err = a.db.Exec(ctx, `
+UPDATE notification_outbox
+SET status = $2, last_error = $3, next_attempt_at = now() + make_interval(secs => $4::int)
+WHERE id=$1`, it.ID, status, err.Error(), int(delay.Seconds()))
+			}
+			if err != nil {
+				return sent, failed, err
+			}
+		}
+	}
+}
+
+// runNotifications: поставить в очередь новые напоминания и разослать очередь.
+func (a *API) runNotifications(ctx context.Context) (map[string]int, error) {
+	queued, err := a.enqueueNotifications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sent, failed, err := a.deliverNotifications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"queued": queued, "sent": sent, "failed": failed}, nil
+}
+
+type OutboxRow struct {
+	ID          string  `json:"id"`
+	UserID      string  `json:"user_id"`
+	UserName    string  `json:"user_name"`
+	LoanID      *string `json:"loan_id,omitempty"`
+	Kind        string  `json:"kind"`
+	Channel     string  `json:"channel"`
+	Recipient   string  `json:"recipient"`
+	Subject     string  `json:"subject"`
+	Body        string  `json:"body"`
+	Status      string  `json:"status"`
+	Attempts    int     `json:"attempts"`
+	LastError   *string `json:"last_error,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	SentAt      *string `json:"sent_at,omitempty"`
+	NextAttempt *string `json:"next_attempt_at,omitempty"`
+}
+
+// listNotifications: ?status=, ?user_id=, ?kind=; последние 500 сообщений.
+func (a *API) listNotifications(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	for _, f := range []string{"status", "user_id", "kind"} {
+		if v := qs.Get(f); v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("o.%s = $%d", f, len(args)))
+		}
+	}
+	q := `
+SELECT o.id, o.user_id, u.name, o.loan_id, o.kind, o.channel, o.recipient, o.subject, o.body, o.status, o.attempts,
+       o.last_error, to_char(o.created_at,'DD/MM/YYYY HH24:MI'), to_char(o.sent_at,'DD/MM/YYYY HH24:MI'),
+       CASE WHEN o.status = 'pending' THEN to_char(o.next_attempt_at,'DD/MM/YYYY HH24:MI') END
+FROM notification_outbox o
+JOIN users u ON u.id = o.user_id`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY o.created_at DESC LIMIT 500", args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []OutboxRow{}
+	for rows.Next() {
+		var o OutboxRow
+		if err := rows.Scan(&o.ID, &o.UserID, &o.UserName, &o.LoanID, &o.Kind, &o.Channel, &o.Recipient, &o.Subject,
+			&o.Body, &o.Status, &o.Attempts, &o.LastError, &o.CreatedAt, &o.SentAt, &o.NextAttempt); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, o)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) runNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := a.runNotifications(r.Context())
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, res)
+}
+
+// retryNotification возвращает неотправленное сообщение в очередь.
+func (a *API) retryNotification(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(), `
+UPDATE notification_outbox SET status = 'pending', attempts = 0, next_attempt_at = now()
+WHERE id=$1 AND status IN ('failed', 'cancelled')`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found or already sent"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
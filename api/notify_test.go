@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderNotification(t *testing.T) {
+	d := notifyData{Name: "Иванов И.И.", Ticket: 17, Title: "Евгений Онегин", Due: "20/10/2026", Days: 22, Level: 3, Final: true}
+	m, err := renderNotification(notifyOverdue, "ru", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "Просрочен возврат книги — последнее напоминание" {
+		t.Errorf("subject %q", m.Subject)
+	}
+	for _, s := range []string{"Иванов И.И.", "«Евгений Онегин»", "истёк 20/10/2026", "просрочка 22 дн.", "последнее напоминание"} {
+		if !strings.Contains(m.Body, s) {
+			t.Errorf("body %q lacks %q", m.Body, s)
+		}
+	}
+
+	d.Final = false
+	if m, _ = renderNotification(notifyOverdue, "en", d); m.Subject != "Overdue book" || !strings.Contains(m.Body, "22 day(s) overdue") {
+		t.Errorf("en: %+v", m)
+	}
+	// неизвестный язык — шаблон на русском
+	m, err = renderNotification(notifyCardExpiry, "de", notifyData{Name: "Петров", Ticket: 5, Expires: "01/12/2026"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "Срок действия читательского билета истекает 01/12/2026" || !strings.Contains(m.Body, "билет № 5") {
+		t.Errorf("fallback: %+v", m)
+	}
+}
+
+func TestLoanNotice(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	due := day.AddDate(0, 0, 2)
+	var d notifyData
+	if kind, key := loanNotice("L1", due, day, &d); kind != notifyDueSoon || key != "due_soon:L1:2026-10-20" || d.Days != 2 {
+		t.Errorf("due soon: %s %s %+v", kind, key, d)
+	}
+
+	due = day.AddDate(0, 0, -30)
+	for _, c := range []struct {
+		days, level int
+		final       bool
+	}{{0, 0, false}, {1, 1, false}, {6, 1, false}, {7, 2, false}, {20, 2, false}, {21, 3, true}, {40, 3, true}} {
+		var d notifyData
+		kind, key := loanNotice("L1", due, due.AddDate(0, 0, c.days), &d)
+		if c.level == 0 {
+			// срок истекает сегодня — ещё напоминание о сроке, а не о просрочке
+			if kind != notifyDueSoon {
+				t.Errorf("%d days: %s", c.days, kind)
+			}
+			continue
+		}
+		if kind != notifyOverdue || d.Days != c.days || d.Level != c.level || d.Final != c.final {
+			t.Errorf("%d days: %s %+v, want level %d final %v", c.days, kind, d, c.level, c.final)
+		}
+		// одно напоминание на уровень: ключ зависит только от уровня
+		if want := fmt.Sprintf("overdue:L1:2026-09-18:%d", c.level); key != want {
+			t.Errorf("%d days: key %q, want %q", c.days, key, want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 5 * time.Minute, 2: 20 * time.Minute, 4: 80 * time.Minute} {
+		if got, giveUp := retryAfter(attempts); got != want || giveUp {
+			t.Errorf("attempt %d: %v %v, want %v", attempts, got, giveUp, want)
+		}
+	}
+	if _, giveUp := retryAfter(notifyMaxAttempts); !giveUp {
+		t.Error("expected to give up after notifyMaxAttempts")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	email, phone, empty := "a@example.org", "+79990000000", ""
+	a := &API{notifiers: map[string]Notifier{notifySMS: &FileNotifier{}}}
+	if ch, to := a.channel(notifyTarget{Email: &email, Phone: &phone}); ch != notifySMS || to != phone {
+		t.Errorf("email not configured: %s %s", ch, to)
+	}
+	a.notifiers[notifyEmail] = &FileNotifier{}
+	if ch, to := a.channel(notifyTarget{Email: &email, Phone: &phone}); ch != notifyEmail || to != email {
+		t.Errorf("both configured: %s %s", ch, to)
+	}
+	if ch, _ := a.channel(notifyTarget{Email: &empty}); ch != "" {
+		t.Errorf("no contacts: %s", ch)
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	n := &FileNotifier{Path: path, Channel: notifyEmail}
+	for _, to := range []string{"a@example.org", "b@example.org"} {
+		if err := n.Send(context.Background(), Message{To: to, Subject: "Тема", Body: "Текст"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	var got struct {
+		Channel string `json:"channel"`
+		Message
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Channel != notifyEmail || got.To != "b@example.org" || got.Subject != "Тема" || got.Body != "Текст" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestSMSGateway(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	g := NewSMSGateway(srv.URL, "secret")
+	if err := g.Send(context.Background(), Message{To: "+79990000000", Subject: "не отправляется", Body: "Верните книгу"}); err != nil {
+		t.Fatal(err)
+	}
+	if got["to"] != "+79990000000" || got["text"] != "Верните книгу" {
+		t.Errorf("gateway got %v", got)
+	}
+	// ответ не 2xx — ошибка, сообщение останется в очереди на повтор
+	g.Token = "wrong"
+	if err := g.Send(context.Background(), Message{To: "+79990000000", Body: "x"}); err == nil {
+		t.Error("expected error on 401")
+	}
+}
+
+// smtpStub — минимальный SMTP-сервер: принимает одно письмо без TLS и авторизации.
+func smtpStub(t *testing.T) (addr string, mail <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	out := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		io.WriteString(c, "220 stub\r\n")
+		var msg strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				io.WriteString(c, "250 stub\r\n")
+			case cmd == "DATA":
+				io.WriteString(c, "354 go ahead\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					msg.WriteString(line)
+				}
+				out <- msg.String()
+				io.WriteString(c, "250 ok\r\n")
+			case cmd == "QUIT":
+				io.WriteString(c, "221 bye\r\n")
+				return
+			default:
+				msg.WriteString(strings.TrimSpace(line) + "\r\n")
+				io.WriteString(c, "250 ok\r\n")
+			}
+		}
+	}()
+	return l.Addr().String(), out
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mail := smtpStub(t)
+	n := &SMTPNotifier{Addr: addr, From: "library@example.org"}
+	if err := n.Send(context.Background(), Message{To: "reader@example.org", Subject: "Срок возврата", Body: "строка 1\nстрока 2"}); err != nil {
+		t.Fatal(err)
+	}
+	got := <-mail
+	for _, s := range []string{"MAIL FROM:<library@example.org>", "RCPT TO:<reader@example.org>", "To: reader@example.org\r\n",
+		"Subject: =?utf-8?q?", "строка 1\r\nстрока 2"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("message lacks %q:\n%s", s, got)
+		}
+	}
+}
+
+// Перевод строки в адресе дописал бы в письмо чужие заголовки.
+func TestSMTPNotifierRejectsHeaderInjection(t *testing.T) {
+	n := &SMTPNotifier{Addr: "127.0.0.1:1", From: "library@example.org"}
+	for _, to := range []string{"a@example.org\r\nBcc: b@example.org", "a@example.org\nBcc: b@example.org"} {
+		if err := n.Send(context.Background(), Message{To: to, Subject: "x", Body: "x"}); err == nil || !strings.Contains(err.Error(), "bad email address") {
+			t.Errorf("%q: %v", to, err)
+		}
+	}
+}
+
+// Сервер принял соединение и молчит: отправка прерывается по сроку ctx.
+func TestSMTPNotifierStalledServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	n := &SMTPNotifier{Addr: l.Addr().String(), From: "library@example.org"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := n.Send(ctx, Message{To: "reader@example.org", Subject: "x", Body: "x"}); err == nil {
+		t.Fatal("expected error from stalled server")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Send took %s", d)
+	}
+
+	// без срока у ctx действует Timeout
+	n.Timeout = 200 * time.Millisecond
+	start = time.Now()
+	if err := n.Send(context.Background(), Message{To: "reader@example.org", Subject: "x", Body: "x"}); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Send took %s", d)
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Простой генератор PDF для актов и отчётов: страницы A4, один TrueType-шрифт
+// (встраивается целиком, Identity-H — нужен для кириллицы), текст и линии.
+
+const (
+	pdfPageW = 595.0
+	pdfPageH = 842.0
+)
+
+type pdfFont struct {
+	data []byte
+	f    *sfnt.Font
+	name string
+}
+
+var (
+	pdfFontMu    sync.Mutex
+	pdfFontCache = map[string]*pdfFont{}
+)
+
+func loadPDFFont(path string) (*pdfFont, error) {
+	pdfFontMu.Lock()
+	defer pdfFontMu.Unlock()
+	if f, ok := pdfFontCache[path]; ok {
+		return f, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	name, err := f.Name(nil, sfnt.NameIDPostScript)
+	if err != nil || name == "" {
+		name = "Embedded"
+	}
+	pf := &pdfFont{data: data, f: f, name: strings.ReplaceAll(name, " ", "")}
+	pdfFontCache[path] = pf
+	return pf, nil
+}
+
+type pdfDoc struct {
+	font   *pdfFont
+	buf    sfnt.Buffer
+	pages  []*bytes.Buffer
+	widths map[sfnt.GlyphIndex]int  // ширина в 1/1000 em
+	runes  map[sfnt.GlyphIndex]rune // для ToUnicode
+}
+
+func newPDF(font *pdfFont) *pdfDoc {
+	d := &pdfDoc{font: font, widths: map[sfnt.GlyphIndex]int{}, runes: map[sfnt.GlyphIndex]rune{}}
+	d.AddPage()
+	return d
+}
+
+func (d *pdfDoc) AddPage() { d.pages = append(d.pages, &bytes.Buffer{}) }
+
+func (d *pdfDoc) page() *bytes.Buffer { return d.pages[len(d.pages)-1] }
+
+func (d *pdfDoc) glyph(r rune) (sfnt.GlyphIndex, int) {
+	gi, err := d.font.f.GlyphIndex(&d.buf, r)
+	if err != nil || gi == 0 {
+		gi, _ = d.font.f.GlyphIndex(&d.buf, '?')
+		r = '?'
+	}
+	if w, ok := d.widths[gi]; ok {
+		return gi, w
+	}
+	adv, err := d.font.f.GlyphAdvance(&d.buf, gi, fixed.I(1000), font.HintingNone)
+	w := 0
+	if err == nil {
+		w = adv.Round()
+	}
+	d.widths[gi] = w
+	d.runes[gi] = r
+	return gi, w
+}
+
+// TextWidth — ширина строки в пунктах при кегле size.
+func (d *pdfDoc) TextWidth(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		_, w := d.glyph(r)
+		total += w
+	}
+	return float64(total) * size / 1000
+}
+
+// Text выводит строку; (x, y) — левый край базовой линии, y отсчитывается сверху.
+func (d *pdfDoc) Text(x, y, size float64, s string) {
+	var hex strings.Builder
+	for _, r := range s {
+		gi, _ := d.glyph(r)
+		fmt.Fprintf(&hex, "%04X", uint16(gi))
+	}
+	fmt.Fprintf(d.page(), "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, pdfPageH-y, hex.String())
+}
+
+// TextRight выравнивает строку по правому краю x.
+func (d *pdfDoc) TextRight(x, y, size float64, s string) {
+	d.Text(x-d.TextWidth(s, size), y, size, s)
+}
+
+func (d *pdfDoc) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "%.2f %.2f m %.2f %.2f l S\n", x1, pdfPageH-y1, x2, pdfPageH-y2)
+}
+
+// Wrap разбивает строку по словам так, чтобы каждая часть помещалась в width.
+func (d *pdfDoc) Wrap(s string, size, width float64) []string {
+	var lines []string
+	var cur string
+	for _, word := range strings.Fields(s) {
+		next := word
+		if cur != "" {
+			next = cur + " " + word
+		}
+		if cur != "" && d.TextWidth(next, size) > width {
+			lines = append(lines, cur)
+			next = word
+		}
+		cur = next
+	}
+	if cur != "" || len(lines) == 0 {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// Table рисует таблицу с переносом строк и автоматическим переходом на
+// новую страницу; возвращает y под таблицей.
+func (d *pdfDoc) Table(x, y, size float64, widths []float64, header []string, rows [][]string) float64 {
+	const pad = 3.0
+	lineH := size * 1.25
+	drawRow := func(cells []string, y float64) float64 {
+		wrapped := make([][]string, len(widths))
+		h := 1
+		for i := range widths {
+			if i < len(cells) {
+				wrapped[i] = d.Wrap(cells[i], size, widths[i]-2*pad)
+			}
+			h = max(h, len(wrapped[i]))
+		}
+		rowH := float64(h)*lineH + 2*pad
+		if y+rowH > pdfPageH-40 {
+			d.AddPage()
+			y = 40
+		}
+		cx := x
+		for i, w := range widths {
+			for j, l := range wrapped[i] {
+				d.Text(cx+pad, y+pad+size+float64(j)*lineH, size, l)
+			}
+			d.Line(cx, y, cx, y+rowH)
+			cx += w
+		}
+		d.Line(cx, y, cx, y+rowH)
+		d.Line(x, y, cx, y)
+		d.Line(x, y+rowH, cx, y+rowH)
+		return y + rowH
+	}
+	if header != nil {
+		y = drawRow(header, y)
+	}
+	for _, r := range rows {
+		y = drawRow(r, y)
+	}
+	return y
+}
+
+func pdfStream(dict string, data []byte) string {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+	return fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", dict, z.Len(), z.Bytes())
+}
+
+// Bytes собирает документ.
+func (d *pdfDoc) Bytes() []byte {
+	var objs []string
+	add := func(s string) int { objs = append(objs, s); return len(objs) }
+
+	catalog := add("")
+	pages := add("")
+
+	glyphs := make([]sfnt.GlyphIndex, 0, len(d.widths))
+	for gi := range d.widths {
+		glyphs = append(glyphs, gi)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	var w, cmap strings.Builder
+	for _, gi := range glyphs {
+		fmt.Fprintf(&w, "%d [%d] ", gi, d.widths[gi])
+	}
+	cmap.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for i := 0; i < len(glyphs); i += 100 {
+		chunk := glyphs[i:min(i+100, len(glyphs))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, gi := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <%s>\n", uint16(gi), utf16Hex(d.runes[gi]))
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end\n")
+
+	var b sfnt.Buffer
+	m, _ := d.font.f.Metrics(&b, fixed.I(1000), font.HintingNone)
+	bounds, _ := d.font.f.Bounds(&b, fixed.I(1000), font.HintingNone)
+	fontFile := add(pdfStream(fmt.Sprintf("/Length1 %d", len(d.font.data)), d.font.data))
+	descriptor := add(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] "+
+		"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		d.font.name, bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round(),
+		m.Ascent.Round(), -m.Descent.Round(), m.CapHeight.Round(), fontFile))
+	cid := add(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 1000 /W [%s] >>", d.font.name, descriptor, w.String()))
+	toUnicode := add(pdfStream("", []byte(cmap.String())))
+	fontObj := add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+		"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", d.font.name, cid, toUnicode))
+
+	var kids []string
+	for _, p := range d.pages {
+		content := add(pdfStream("", append([]byte("0.5 w\n"), p.Bytes()...)))
+		page := add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>", pages, pdfPageW, pdfPageH, fontObj, content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	objs[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages)
+	objs[pages-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, catalog, xref)
+	return out.Bytes()
+}
+
+func utf16Hex(r rune) string {
+	if r < 0x10000 {
+		return fmt.Sprintf("%04X", r)
+	}
+	r -= 0x10000
+	return fmt.Sprintf("%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+}
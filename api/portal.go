@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Личный кабинет читателя (/portal): отдельный вход по номеру билета и PIN,
+// свои токены (reader_sessions) и только собственные данные читателя.
+
+const (
+	minPINLen       = 4
+	pinMaxFailures  = 5
+	pinLockDuration = 15 * time.Minute
+	maxRenewals     = 2
+)
+
+type Reader struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	TicketNumber int    `json:"ticket_number"`
+}
+
+type PortalLoan struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Author     *string `json:"author,omitempty"`
+	DateIssue  string  `json:"date_issue"`
+	DateDue    string  `json:"date_due"`
+	DateReturn *string `json:"date_return,omitempty"`
+	LoanType   string  `json:"loan_type"`
+	Renewals   int     `json:"renewals"`
+	Overdue    bool    `json:"overdue"`
+}
+
+func (a *API) portalRoutes(r chi.Router) {
+	r.Post("/login", a.readerLogin)
+	r.Group(func(r chi.Router) {
+		r.Use(a.readerAuth)
+		r.Post("/logout", a.readerLogout)
+		r.Get("/me", a.readerMe)
+		r.Put("/pin", a.readerChangePIN)
+		r.Put("/notifications", a.readerNotifySettings)
+		r.Put("/privacy", a.readerPrivacy)
+		r.Get("/loans", a.readerLoans)
+		r.Get("/history", a.readerHistory)
+		r.Post("/loans/{id}/renew", a.readerRenew)
+		r.Get("/books", a.listBooks)
+		r.Get("/works", a.listWorks)
+	})
+}
+
+// currentReader — читатель, вошедший в кабинет (после readerAuth).
+func currentReader(r *http.Request) *Reader {
+	rd, _ := r.Context().Value(ctxReader).(*Reader)
+	return rd
+}
+
+func (a *API) readerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := authToken(r)
+		if token == "" {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		var rd Reader
+		err := a.db.QueryRow(r.Context(), `
+SELECT u.id, u.name, u.ticket_number FROM reader_sessions s
+JOIN users u ON u.id = s.user_id
+WHERE s.token=$1 AND s.expires_at > now() AND u.pin_hash IS NOT NULL`, token).Scan(&rd.ID, &rd.Name, &rd.TicketNumber)
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxReader, &rd)))
+	})
+}
+
+// readerLogin: {"ticket_number", "pin"}. После pinMaxFailures неудачных
+// попыток вход блокируется на pinLockDuration.
+func (a *API) readerLogin(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		TicketNumber int    `json:"ticket_number"`
+		PIN          string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	var id string
+	var hash *string
+	var locked bool
+	err := a.db.QueryRow(ctx, `
+SELECT id, pin_hash, coalesce(pin_locked_until > now(), false) FROM users WHERE ticket_number=$1`,
+		in.TicketNumber).Scan(&id, &hash, &locked)
+	if err != nil || hash == nil {
+		bad(w, fmt.Errorf("invalid credentials"), 401)
+		return
+	}
+	if locked {
+		bad(w, fmt.Errorf("слишком много попыток, попробуйте позже"), 429)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(*hash), []byte(in.PIN)) != nil {
+		if _, err := a.db.Exec(ctx, `
+UPDATE users SET pin_failures = pin_failures + 1,
+                 pin_locked_until = CASE WHEN pin_failures + 1 >= $2 THEN now() + $3::interval END
+WHERE id=$1`, id, pinMaxFailures, pinLockDuration.String()); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		bad(w, fmt.Errorf("invalid credentials"), 401)
+		return
+	}
+
+	token := uuid.NewString()
+	if _, err := a.db.Exec(ctx, `UPDATE users SET pin_failures = 0, pin_locked_until = NULL WHERE id=$1`, id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := a.db.Exec(ctx, `DELETE FROM reader_sessions WHERE expires_at < now()`); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := a.db.Exec(ctx,
+		`INSERT INTO reader_sessions(token, user_id, expires_at) VALUES($1,$2,$3)`,
+		token, id, time.Now().Add(sessionTTL)); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, map[string]string{"token": token})
+}
+
+func (a *API) readerLogout(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.db.Exec(context.Background(), `DELETE FROM reader_sessions WHERE token=$1`, authToken(r)); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) readerMe(w http.ResponseWriter, r *http.Request) {
+	rd := currentReader(r)
+	var active, overdue int
+	var lang string
+	var optOut bool
+	if err := a.db.QueryRow(context.Background(), `
+SELECT count(ab.id), count(ab.id) FILTER (WHERE ab.date_due < $2), u.notify_lang, u.notify_opt_out
+FROM users u
+LEFT JOIN accounting_books ab ON ab.user_id = u.id AND ab.date_return IS NULL
+WHERE u.id=$1
+GROUP BY u.id`, rd.ID, today()).Scan(&active, &overdue, &lang, &optOut); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"id": rd.ID, "name": rd.Name, "ticket_number": rd.TicketNumber,
+		"active_loans": active, "overdue_loans": overdue,
+		"notify_lang": lang, "notify_opt_out": optOut,
+	})
+}
+
+func hashPIN(pin string) (string, error) {
+	if len([]rune(strings.TrimSpace(pin))) < minPINLen {
+		return "", fmt.Errorf("PIN must be at least %d characters", minPINLen)
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+// readerChangePIN: {"old_pin", "new_pin"}; остальные сессии читателя закрываются.
+func (a *API) readerChangePIN(w http.ResponseWriter, r *http.Request) {
+	rd := currentReader(r)
+	var in struct {
+		OldPIN string `json:"old_pin"`
+		NewPIN string `json:"new_pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	var hash string
+	if err := a.db.QueryRow(ctx, `SELECT pin_hash FROM users WHERE id=$1`, rd.ID).Scan(&hash); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(in.OldPIN)) != nil {
+		bad(w, fmt.Errorf("неверный PIN"), 403)
+		return
+	}
+	h, err := hashPIN(in.NewPIN)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if _, err := a.db.Exec(ctx, `UPDATE users SET pin_hash=$2 WHERE id=$1`, rd.ID, h); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := a.db.Exec(ctx, `DELETE FROM reader_sessions WHERE user_id=$1 AND token<>$2`, rd.ID, authToken(r)); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// loanTitle — название выданного: книга или «журнал, т. N, № M» (нужны join'ы
+// books b, serial_issues si, serials s).
+const loanTitle = `coalesce(b.name, s.title || ', ' || coalesce('т. ' || si.volume || ', ', '') || '№ ' || si.number)`
+
+// readerNotifySettings: {"opt_out", "lang"} — отказ от уведомлений и их язык.
+func (a *API) readerNotifySettings(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		OptOut *bool   `json:"opt_out"`
+		Lang   *string `json:"lang"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.Lang != nil && *in.Lang != "ru" && *in.Lang != "en" {
+		bad(w, fmt.Errorf("lang must be ru or en"), 400)
+		return
+	}
+	if _, err := a.db.Exec(context.Background(), `
+UPDATE users SET notify_opt_out = coalesce($2, notify_opt_out), notify_lang = coalesce($3, notify_lang) WHERE id=$1`,
+		currentReader(r).ID, in.OptOut, in.Lang); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.readerMe(w, r)
+}
+
+const portalLoanSelect = `
+SELECT ab.id, ` + loanTitle + `,
+       au.name,
+       to_char(ab.date_issue,'DD/MM/YYYY'), to_char(ab.date_due,'DD/MM/YYYY'), to_char(ab.date_return,'DD/MM/YYYY'),
+       ab.loan_type, ab.renewals, ab.date_return IS NULL AND ab.date_due < $2
+FROM accounting_books ab
+LEFT JOIN books b ON b.id = ab.book_id
+LEFT JOIN book_authors au ON au.id = b.author_id
+LEFT JOIN serial_issues si ON si.id = ab.issue_id
+LEFT JOIN serials s ON s.id = si.serial_id
+WHERE ab.user_id = $1
+`
+
+// readerLoans — книги на руках у читателя; их немного (выдачу ограничивает
+// лимит), поэтому список отдаётся целиком.
+func (a *API) readerLoans(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), portalLoanSelect+" AND ab.date_return IS NULL ORDER BY ab.date_issue DESC, ab.id DESC",
+		currentReader(r).ID, today())
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []PortalLoan{}
+	for rows.Next() {
+		var l PortalLoan
+		if err := rows.Scan(&l.ID, &l.Title, &l.Author, &l.DateIssue, &l.DateDue, &l.DateReturn,
+			&l.LoanType, &l.Renewals, &l.Overdue); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, l)
+	}
+	writeJSON(w, out)
+}
+
+// readerHistory — возвращённые книги читателя; фильтры, сортировка и
+// страницы — как у /loans.
+func (a *API) readerHistory(w http.ResponseWriter, r *http.Request) {
+	where, args, err := loanFilters(r, []string{"ab.user_id = $1::uuid", "ab.date_return IS NOT NULL"},
+		[]any{currentReader(r).ID})
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.loanPage(w, r, where, args)
+}
+
+func (a *API) readerRenew(w http.ResponseWriter, r *http.Request) {
+	due, code, err := a.renewLoan(context.Background(), chi.URLParam(r, "id"), currentReader(r).ID)
+	if err != nil {
+		bad(w, err, code)
+		return
+	}
+	writeJSON(w, map[string]string{"date_due": dmy(due)})
+}
+
+// renewLoanHandler — продление выдачи сотрудником.
+func (a *API) renewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	due, code, err := a.renewLoan(context.Background(), chi.URLParam(r, "id"), "")
+	if err != nil {
+		bad(w, err, code)
+		return
+	}
+	writeJSON(w, map[string]string{"date_due": dmy(due)})
+}
+
+// renewLoan продлевает выдачу на дом на loanDays от сегодняшнего дня (с учётом
+// расписания зала), не больше maxRenewals раз и только до истечения срока.
+// userID, если задан, ограничивает продление выдачами этого читателя.
+func (a *API) renewLoan(ctx context.Context, loanID, userID string) (time.Time, int, error) {
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	var owner, loanType, roomID string
+	var due time.Time
+	var returned bool
+	var renewals int
+	err = tx.QueryRow(ctx, `
+SELECT coalesce(ab.user_id::text, ''), ab.loan_type, ab.date_due, ab.date_return IS NOT NULL, ab.renewals,
+       coalesce(b.reading_room_id, s.reading_room_id)
+FROM accounting_books ab
+LEFT JOIN books b ON b.id = ab.book_id
+LEFT JOIN serial_issues si ON si.id = ab.issue_id
+LEFT JOIN serials s ON s.id = si.serial_id
+WHERE ab.id=$1
+FOR UPDATE OF ab`, loanID).Scan(&owner, &loanType, &due, &returned, &renewals, &roomID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && userID != "" && owner != userID) {
+		return time.Time{}, 404, fmt.Errorf("loan not found")
+	}
+	if err != nil {
+		return time.Time{}, 500, err
+	}
+	switch {
+	case returned:
+		return time.Time{}, 409, fmt.Errorf("книга уже возвращена")
+	case loanType != lendTakeHome:
+		return time.Time{}, 409, fmt.Errorf("чтение в зале не продлевается")
+	case due.Before(today()):
+		return time.Time{}, 409, fmt.Errorf("срок возврата истёк %s — обратитесь в библиотеку", dmy(due))
+	case renewals >= maxRenewals:
+		return time.Time{}, 409, fmt.Errorf("выдачу можно продлить не больше %d раз", maxRenewals)
+	}
+	next, err := dueDate(ctx, tx, roomID, today())
+	if err != nil {
+		return time.Time{}, 409, err
+	}
+	if !next.After(due) {
+		return time.Time{}, 409, fmt.Errorf("срок возврата и так %s", dmy(due))
+	}
+	if _, err := tx.Exec(ctx, `UPDATE accounting_books SET date_due=$2, renewals=renewals+1 WHERE id=$1`, loanID, next); err != nil {
+		return time.Time{}, 500, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, 500, err
+	}
+	return next, 0, nil
+}
+
+// setReaderPIN (сотрудник): {"pin"} — выдать или сменить PIN читателю,
+// снять блокировку и закрыть его сессии.
+func (a *API) setReaderPIN(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	h, err := hashPIN(in.PIN)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.resetReaderAccess(w, id, &h)
+}
+
+// clearReaderPIN (сотрудник): закрыть читателю доступ в кабинет.
+func (a *API) clearReaderPIN(w http.ResponseWriter, r *http.Request) {
+	a.resetReaderAccess(w, chi.URLParam(r, "id"), nil)
+}
+
+func (a *API) resetReaderAccess(w http.ResponseWriter, id string, hash *string) {
+	ctx := context.Background()
+	cmd, err := a.db.Exec(ctx, `UPDATE users SET pin_hash=$2, pin_failures=0, pin_locked_until=NULL WHERE id=$1`, id, hash)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if _, err := a.db.Exec(ctx, `DELETE FROM reader_sessions WHERE user_id=$1`, id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Отчёты по книговыдаче: ?from=&to= (DD/MM/YYYY, по умолчанию — с начала
+// месяца по сегодня), ?format=csv — выгрузка для Excel вместо JSON.
+
+// reportDim — разрез отчёта: колонка books (и serials, если у периодики
+// есть такой признак) и справочник с названиями.
+type reportDim struct {
+	bookCol   string
+	serialCol string
+	table     string
+}
+
+var reportDims = map[string]reportDim{
+	"room":      {"reading_room_id", "reading_room_id", "reading_rooms"},
+	"group":     {"book_group_id", "", "book_groups"},
+	"author":    {"author_id", "", "book_authors"},
+	"publisher": {"published_house_id", "publisher_id", "publishing_houses"},
+	"book":      {"id", "", "books"},
+}
+
+// loanKey — выражение для id разреза у выдачи (книги или номера журнала).
+func (d reportDim) loanKey() string {
+	if d.serialCol == "" {
+		return "b." + d.bookCol
+	}
+	return fmt.Sprintf("coalesce(b.%s, s.%s)", d.bookCol, d.serialCol)
+}
+
+const reportLoanJoins = `
+FROM accounting_books ab
+LEFT JOIN books b ON b.id = ab.book_id
+LEFT JOIN serial_issues si ON si.id = ab.issue_id
+LEFT JOIN serials s ON s.id = si.serial_id
+`
+
+var reportPeriods = map[string]bool{"day": true, "week": true, "month": true, "quarter": true, "year": true}
+
+// reportPeriod: ?period= (по умолчанию month) — выражение начала периода выдачи.
+func reportPeriod(r *http.Request) (string, error) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if !reportPeriods[period] {
+		return "", fmt.Errorf("period must be day, week, month, quarter or year")
+	}
+	return fmt.Sprintf("date_trunc('%s', ab.date_issue)", period), nil
+}
+
+func reportRange(r *http.Request) (time.Time, time.Time, error) {
+	qs := r.URL.Query()
+	to := today()
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	if s := qs.Get("from"); s != "" {
+		if from, err = parseDDMMYYYY(s); err != nil {
+			return from, to, fmt.Errorf("from: %w", err)
+		}
+	}
+	if s := qs.Get("to"); s != "" {
+		if to, err = parseDDMMYYYY(s); err != nil {
+			return from, to, fmt.Errorf("to: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to is before from")
+	}
+	return from, to, nil
+}
+
+func reportDimParam(r *http.Request, def string) (string, reportDim, error) {
+	name := r.URL.Query().Get("group_by")
+	if name == "" {
+		name = def
+	}
+	d, ok := reportDims[name]
+	if !ok && name != "" {
+		return name, d, fmt.Errorf("group_by must be room, group, author, publisher or book")
+	}
+	return name, d, nil
+}
+
+// writeReport отдаёт результат запроса как JSON-массив объектов или CSV
+// (колонки — имена из SELECT). Значения должны быть простыми типами: даты,
+// uuid и numeric приводятся к тексту и float8 в самом запросе.
+func writeReport(w http.ResponseWriter, r *http.Request, name string, rows pgx.Rows) {
+	defer rows.Close()
+	var cols []string
+	for _, f := range rows.FieldDescriptions() {
+		cols = append(cols, f.Name)
+	}
+	var data [][]any
+	for rows.Next() {
+		v, err := rows.Values()
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		data = append(data, v)
+	}
+	if err := rows.Err(); err != nil {
+		bad(w, err, 500)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "csv" {
+		out := make([]map[string]any, 0, len(data))
+		for _, v := range data {
+			m := make(map[string]any, len(cols))
+			for i, c := range cols {
+				m[c] = v[i]
+			}
+			out = append(out, m)
+		}
+		writeJSON(w, out)
+		return
+	}
+
+	// BOM и «;» — чтобы русский Excel открыл файл без мастера импорта
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+	w.Write([]byte("\ufeff"))
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write(cols)
+	rec := make([]string, len(cols))
+	for _, v := range data {
+		for i, x := range v {
+			switch x := x.(type) {
+			case nil:
+				rec[i] = ""
+			case float64:
+				rec[i] = strings.Replace(strconv.FormatFloat(x, 'f', -1, 64), ".", ",", 1)
+			default:
+				rec[i] = fmt.Sprint(x)
+			}
+		}
+		cw.Write(rec)
+	}
+	cw.Flush()
+}
+
+func reportName(kind string, from, to time.Time) string {
+	return fmt.Sprintf("%s_%s_%s", kind, from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+// reportLoans: ?group_by=room|group|author|publisher|book (по умолчанию room),
+// ?period=day|week|month|quarter|year (по умолчанию month) — выдачи по периодам.
+func (a *API) reportLoans(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dimName, d, err := reportDimParam(r, "room")
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	p, err := reportPeriod(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	rows, err := a.db.Query(context.Background(), `
+SELECT to_char(`+p+`,'DD/MM/YYYY') AS period,
+       t.id::text AS id, coalesce(t.name, 'Периодические издания') AS name,
+       count(*) AS loans,
+       count(*) FILTER (WHERE ab.loan_type = 'take_home') AS take_home,
+       count(*) FILTER (WHERE ab.loan_type = 'reading_room') AS reading_room,
+       count(DISTINCT ab.user_id) AS readers,
+       round(100.0 * count(*) / sum(count(*)) OVER (PARTITION BY `+p+`), 1)::float8 AS share_pct
+`+reportLoanJoins+`
+LEFT JOIN `+d.table+` t ON t.id = `+d.loanKey()+`
+WHERE ab.date_issue BETWEEN $1 AND $2
+GROUP BY `+p+`, t.id, t.name
+ORDER BY `+p+`, loans DESC, name`, from, to)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("loans_by_"+dimName, from, to), rows)
+}
+
+// reportTopTitles: ?order=most|least, ?limit= (по умолчанию 20) — самые
+// востребованные или невостребованные книги; книги без выдач тоже учитываются.
+func (a *API) reportTopTitles(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dir := "DESC"
+	switch r.URL.Query().Get("order") {
+	case "", "most":
+	case "least":
+		dir = "ASC"
+	default:
+		bad(w, fmt.Errorf("order must be most or least"), 400)
+		return
+	}
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > 1000 {
+			bad(w, fmt.Errorf("limit must be 1..1000"), 400)
+			return
+		}
+	}
+	rows, err := a.db.Query(context.Background(), `
+SELECT rank() OVER (ORDER BY count(ab.id) `+dir+`) AS rank,
+       b.id::text AS book_id, b.name AS title, au.name AS author, b.year_publication AS year,
+       count(ab.id) AS loans, count(DISTINCT ab.user_id) AS readers, b.number_copies AS copies
+FROM books b
+JOIN book_authors au ON au.id = b.author_id
+LEFT JOIN accounting_books ab ON ab.book_id = b.id AND ab.date_issue BETWEEN $1 AND $2
+GROUP BY b.id, au.name
+ORDER BY loans `+dir+`, title
+LIMIT $3`, from, to, limit)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("titles", from, to), rows)
+}
+
+// reportReaders: ?period= — активные читатели (хотя бы одна выдача) по
+// периодам; последняя строка «итого» считает читателей за весь диапазон.
+func (a *API) reportReaders(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	p, err := reportPeriod(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	rows, err := a.db.Query(context.Background(), `
+SELECT coalesce(to_char(`+p+`,'DD/MM/YYYY'), 'итого') AS period,
+       count(DISTINCT ab.user_id) AS active_readers,
+       count(*) AS loans,
+       round(count(*)::numeric / nullif(count(DISTINCT ab.user_id), 0), 2)::float8 AS loans_per_reader,
+       (SELECT count(*) FROM users) AS registered
+FROM accounting_books ab
+WHERE ab.date_issue BETWEEN $1 AND $2
+GROUP BY GROUPING SETS ((`+p+`), ())
+ORDER BY `+p+` NULLS LAST`, from, to)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("readers", from, to), rows)
+}
+
+// reportLoanDuration: средний и медианный срок пользования по возвращённым
+// за период выдачам; ?group_by= — дополнительно по разрезу.
+func (a *API) reportLoanDuration(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dimName, d, err := reportDimParam(r, "")
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	sel, join, group := `NULL::text AS id, NULL::text AS name`, "", ""
+	if dimName != "" {
+		sel = `t.id::text AS id, coalesce(t.name, 'Периодические издания') AS name`
+		join = "LEFT JOIN " + d.table + " t ON t.id = " + d.loanKey()
+		group = "t.id, t.name, "
+	}
+	rows, err := a.db.Query(context.Background(), `
+SELECT `+sel+`, ab.loan_type,
+       count(*) AS returned,
+       round(avg(ab.date_return - ab.date_issue), 1)::float8 AS avg_days,
+       percentile_cont(0.5) WITHIN GROUP (ORDER BY ab.date_return - ab.date_issue) AS median_days,
+       max(ab.date_return - ab.date_issue) AS max_days,
+       count(*) FILTER (WHERE ab.date_return > ab.date_due) AS returned_late
+`+reportLoanJoins+join+`
+WHERE ab.date_return BETWEEN $1 AND $2
+GROUP BY `+group+`ab.loan_type
+ORDER BY name, ab.loan_type`, from, to)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	name := "loan_duration"
+	if dimName != "" {
+		name += "_by_" + dimName
+	}
+	writeReport(w, r, reportName(name, from, to), rows)
+}
+
+// reportTurnover: обращаемость фонда — выдачи за период на один экземпляр
+// (number_copies без списанных и утерянных), ?group_by= (по умолчанию room).
+// Периодика не учитывается: у номеров нет учёта экземпляров в books.
+func (a *API) reportTurnover(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dimName, d, err := reportDimParam(r, "room")
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	rows, err := a.db.Query(context.Background(), `
+WITH l AS (SELECT b.`+d.bookCol+` AS id, count(*) AS loans
+           FROM accounting_books ab JOIN books b ON b.id = ab.book_id
+           WHERE ab.date_issue BETWEEN $1 AND $2
+           GROUP BY 1),
+     c AS (SELECT b.`+d.bookCol+` AS id, count(*) AS titles, sum(b.number_copies) AS copies
+           FROM books b
+           GROUP BY 1)
+SELECT rank() OVER (ORDER BY coalesce(l.loans, 0)::numeric / nullif(c.copies, 0) DESC NULLS LAST) AS rank,
+       t.id::text AS id, t.name AS name, c.titles, c.copies, coalesce(l.loans, 0) AS loans,
+       round(coalesce(l.loans, 0)::numeric / nullif(c.copies, 0), 2)::float8 AS turnover
+FROM c
+JOIN `+d.table+` t ON t.id = c.id
+LEFT JOIN l ON l.id = c.id
+ORDER BY rank, name`, from, to)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeReport(w, r, reportName("turnover_by_"+dimName, from, to), rows)
+}
@@ -0,0 +1,671 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Срок выдачи по умолчанию; если он приходится на закрытый день зала,
+// возврат переносится на ближайший рабочий день.
+const (
+	loanDays     = 14
+	maxDueShift  = 60
+	scheduleDays = 14
+)
+
+type RoomHours struct {
+	Weekday int    `json:"weekday"` // 1 — понедельник … 7 — воскресенье
+	Opens   string `json:"opens"`   // HH:MM
+	Closes  string `json:"closes"`
+}
+
+type ClosureRow struct {
+	ID     string  `json:"id"`
+	RoomID *string `json:"room_id"`
+	Date   string  `json:"date"`
+	Reason string  `json:"reason"`
+}
+
+type ScheduleDay struct {
+	Date   string `json:"date"`
+	Open   bool   `json:"open"`
+	Opens  string `json:"opens,omitempty"`
+	Closes string `json:"closes,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type SeatBooking struct {
+	ID       string `json:"id"`
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	SeatNo   int    `json:"seat_no"`
+	Starts   string `json:"starts_at"`
+	Ends     string `json:"ends_at"`
+}
+
+type VisitRow struct {
+	ID         string  `json:"id"`
+	UserID     string  `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	CheckedIn  string  `json:"checked_in_at"`
+	CheckedOut *string `json:"checked_out_at,omitempty"`
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+func parseHHMM(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// roomSchedule — часы работы зала и закрытия в заданном интервале дат.
+type roomSchedule struct {
+	hours  map[int]RoomHours
+	closed map[string]string // YYYY-MM-DD -> причина
+}
+
+func loadSchedule(ctx context.Context, q dbQuerier, roomID string, from, to time.Time) (*roomSchedule, error) {
+	s := &roomSchedule{hours: map[int]RoomHours{}, closed: map[string]string{}}
+	rows, err := q.Query(ctx, `
+SELECT weekday, to_char(opens,'HH24:MI'), to_char(closes,'HH24:MI')
+FROM room_hours WHERE room_id=$1`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var h RoomHours
+		if err := rows.Scan(&h.Weekday, &h.Opens, &h.Closes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.hours[h.Weekday] = h
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx, `
+SELECT to_char(day,'YYYY-MM-DD'), reason FROM room_closures
+WHERE (room_id=$1 OR room_id IS NULL) AND day BETWEEN $2 AND $3`, roomID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day, reason string
+		if err := rows.Scan(&day, &reason); err != nil {
+			return nil, err
+		}
+		s.closed[day] = reason
+	}
+	return s, rows.Err()
+}
+
+// day возвращает часы работы на дату. Зал без заданных часов открыт весь день.
+func (s *roomSchedule) day(d time.Time) ScheduleDay {
+	out := ScheduleDay{Date: dmy(d)}
+	if reason, ok := s.closed[d.Format("2006-01-02")]; ok {
+		out.Reason = reason
+		return out
+	}
+	if len(s.hours) == 0 {
+		out.Open, out.Opens, out.Closes = true, "00:00", "24:00"
+		return out
+	}
+	if h, ok := s.hours[isoWeekday(d)]; ok {
+		out.Open, out.Opens, out.Closes = true, h.Opens, h.Closes
+	}
+	return out
+}
+
+// dueDate — срок возврата книги из зала roomID, выданной issued.
+func dueDate(ctx context.Context, q dbQuerier, roomID string, issued time.Time) (time.Time, error) {
+	due := issued.AddDate(0, 0, loanDays)
+	s, err := loadSchedule(ctx, q, roomID, due, due.AddDate(0, 0, maxDueShift))
+	if err != nil {
+		return time.Time{}, err
+	}
+	for i := 0; i <= maxDueShift; i++ {
+		if d := due.AddDate(0, 0, i); s.day(d).Open {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("зал закрыт все %d дней после %s", maxDueShift, dmy(due))
+}
+
+// badConstraint отдаёт 409 для ошибок из триггеров и уникальных индексов.
+func badConstraint(w http.ResponseWriter, err error) {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) {
+		switch pe.Code {
+		case "P0001":
+			bad(w, errors.New(pe.Message), 409)
+			return
+		case "23505":
+			bad(w, fmt.Errorf("такая запись уже есть"), 409)
+			return
+		}
+	}
+	bad(w, err, 400)
+}
+
+func (a *API) roomExists(ctx context.Context, id string) (bool, error) {
+	var ok bool
+	err := a.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM reading_rooms WHERE id=$1)`, id).Scan(&ok)
+	return ok, err
+}
+
+func (a *API) roomHours(w http.ResponseWriter, r *http.Request) {
+	s, err := loadSchedule(context.Background(), a.db, chi.URLParam(r, "id"), time.Time{}, time.Time{})
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	out := []RoomHours{}
+	for wd := 1; wd <= 7; wd++ {
+		if h, ok := s.hours[wd]; ok {
+			out = append(out, h)
+		}
+	}
+	writeJSON(w, out)
+}
+
+// setRoomHours заменяет расписание зала целиком; пустой список — без ограничений.
+func (a *API) setRoomHours(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in []RoomHours
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	seen := map[int]bool{}
+	for _, h := range in {
+		if h.Weekday < 1 || h.Weekday > 7 {
+			bad(w, fmt.Errorf("weekday must be 1..7"), 400)
+			return
+		}
+		if seen[h.Weekday] {
+			bad(w, fmt.Errorf("weekday %d listed twice", h.Weekday), 400)
+			return
+		}
+		seen[h.Weekday] = true
+		o, err1 := parseHHMM(h.Opens)
+		c, err2 := parseHHMM(h.Closes)
+		if err1 != nil || err2 != nil {
+			bad(w, fmt.Errorf("opens/closes must be HH:MM"), 400)
+			return
+		}
+		if c <= o {
+			bad(w, fmt.Errorf("weekday %d: closes must be after opens", h.Weekday), 400)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if ok, err := a.roomExists(ctx, id); err != nil || !ok {
+		bad(w, fmt.Errorf("room not found"), 404)
+		return
+	}
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM room_hours WHERE room_id=$1`, id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	for _, h := range in {
+		if _, err := tx.Exec(ctx, `INSERT INTO room_hours(room_id, weekday, opens, closes) VALUES($1,$2,$3::time,$4::time)`,
+			id, h.Weekday, h.Opens, h.Closes); err != nil {
+			bad(w, err, 400)
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.roomHours(w, r)
+}
+
+// dateRange разбирает ?from=&to= (DD/MM/YYYY); по умолчанию — две недели от сегодня.
+func dateRange(r *http.Request) (time.Time, time.Time, error) {
+	qs := r.URL.Query()
+	from, to := today(), time.Time{}
+	var err error
+	if s := qs.Get("from"); s != "" {
+		if from, err = parseDDMMYYYY(s); err != nil {
+			return from, to, fmt.Errorf("from: %w", err)
+		}
+	}
+	to = from.AddDate(0, 0, scheduleDays-1)
+	if s := qs.Get("to"); s != "" {
+		if to, err = parseDDMMYYYY(s); err != nil {
+			return from, to, fmt.Errorf("to: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to is before from")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return from, to, fmt.Errorf("range is longer than a year")
+	}
+	return from, to, nil
+}
+
+// wallNow — местное время «как есть» в UTC: даты и брони хранятся без зоны,
+// так же как их разбирает parseDDMMYYYY.
+func wallNow() time.Time {
+	n := time.Now()
+	return time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), n.Second(), 0, time.UTC)
+}
+
+func today() time.Time { return wallNow().Truncate(24 * time.Hour) }
+
+// roomSchedule: ?from=&to= — расписание по дням с учётом закрытий.
+func (a *API) roomSchedule(w http.ResponseWriter, r *http.Request) {
+	from, to, err := dateRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	s, err := loadSchedule(context.Background(), a.db, chi.URLParam(r, "id"), from, to)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	out := []ScheduleDay{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		out = append(out, s.day(d))
+	}
+	writeJSON(w, out)
+}
+
+// listClosures: ?room_id= (без него — все), ?from=&to=.
+func (a *API) listClosures(w http.ResponseWriter, r *http.Request) {
+	from, to, err := dateRange(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	q := `
+SELECT id, room_id, to_char(day,'DD/MM/YYYY'), reason FROM room_closures
+WHERE day BETWEEN $1 AND $2`
+	args := []any{from, to}
+	if room := r.URL.Query().Get("room_id"); room != "" {
+		args = append(args, room)
+		q += " AND (room_id = $3 OR room_id IS NULL)"
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY day, room_id NULLS FIRST", args...)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []ClosureRow{}
+	for rows.Next() {
+		var c ClosureRow
+		if err := rows.Scan(&c.ID, &c.RoomID, &c.Date, &c.Reason); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, c)
+	}
+	writeJSON(w, out)
+}
+
+// createClosure: {"room_id": null|"...", "date": "DD/MM/YYYY", "reason": "..."};
+// без room_id закрывается вся библиотека.
+func (a *API) createClosure(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		RoomID *string `json:"room_id"`
+		Date   string  `json:"date"`
+		Reason string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	d, err := parseDDMMYYYY(in.Date)
+	if err != nil {
+		bad(w, fmt.Errorf("date must be DD/MM/YYYY"), 400)
+		return
+	}
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Reason == "" {
+		bad(w, fmt.Errorf("reason required"), 400)
+		return
+	}
+	if in.RoomID != nil && *in.RoomID == "" {
+		in.RoomID = nil
+	}
+	var c ClosureRow
+	if err := a.db.QueryRow(context.Background(), `
+INSERT INTO room_closures(room_id, day, reason) VALUES($1,$2,$3)
+RETURNING id, room_id, to_char(day,'DD/MM/YYYY'), reason`, in.RoomID, d, in.Reason).
+		Scan(&c.ID, &c.RoomID, &c.Date, &c.Reason); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (a *API) deleteClosure(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(), `DELETE FROM room_closures WHERE id=$1`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+const bookingSelect = `
+SELECT sb.id, sb.room_id, u.id, u.name, sb.seat_no,
+       to_char(sb.starts_at,'DD/MM/YYYY HH24:MI'), to_char(sb.ends_at,'DD/MM/YYYY HH24:MI')
+FROM seat_bookings sb
+JOIN users u ON u.id = sb.user_id
+`
+
+func scanBooking(row interface{ Scan(...any) error }) (SeatBooking, error) {
+	var b SeatBooking
+	err := row.Scan(&b.ID, &b.RoomID, &b.UserID, &b.UserName, &b.SeatNo, &b.Starts, &b.Ends)
+	return b, err
+}
+
+// listBookings: ?date= (DD/MM/YYYY, по умолчанию сегодня) — активные брони зала на день.
+func (a *API) listBookings(w http.ResponseWriter, r *http.Request) {
+	day := today()
+	if s := r.URL.Query().Get("date"); s != "" {
+		var err error
+		if day, err = parseDDMMYYYY(s); err != nil {
+			bad(w, fmt.Errorf("date must be DD/MM/YYYY"), 400)
+			return
+		}
+	}
+	rows, err := a.db.Query(context.Background(), bookingSelect+`
+WHERE sb.room_id=$1 AND sb.cancelled_at IS NULL
+  AND sb.starts_at < $2::date + 1 AND sb.ends_at > $2::date
+ORDER BY sb.starts_at, sb.seat_no`, chi.URLParam(r, "id"), day)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []SeatBooking{}
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, b)
+	}
+	writeJSON(w, out)
+}
+
+// createBooking: {"user_id", "date": "DD/MM/YYYY", "from": "HH:MM", "to": "HH:MM", "seat_no"?}.
+// Без seat_no выбирается первое свободное место. Пересечения проверяет триггер.
+func (a *API) createBooking(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+	var in struct {
+		UserID string `json:"user_id"`
+		Date   string `json:"date"`
+		From   string `json:"from"`
+		To     string `json:"to"`
+		SeatNo int    `json:"seat_no"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.UserID == "" {
+		bad(w, fmt.Errorf("user_id required"), 400)
+		return
+	}
+	day, err := parseDDMMYYYY(in.Date)
+	if err != nil {
+		bad(w, fmt.Errorf("date must be DD/MM/YYYY"), 400)
+		return
+	}
+	from, err1 := parseHHMM(in.From)
+	to, err2 := parseHHMM(in.To)
+	if err1 != nil || err2 != nil {
+		bad(w, fmt.Errorf("from/to must be HH:MM"), 400)
+		return
+	}
+	if to <= from {
+		bad(w, fmt.Errorf("to must be after from"), 400)
+		return
+	}
+	starts, ends := day.Add(from), day.Add(to)
+	if !ends.After(wallNow()) {
+		bad(w, fmt.Errorf("slot is in the past"), 400)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// блокировка зала сериализует выбор места между параллельными бронями
+	var capacity *int
+	if err := tx.QueryRow(ctx, `SELECT capacity FROM reading_rooms WHERE id=$1 FOR UPDATE`, roomID).Scan(&capacity); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			bad(w, fmt.Errorf("room not found"), 404)
+			return
+		}
+		bad(w, err, 400)
+		return
+	}
+	s, err := loadSchedule(ctx, tx, roomID, day, day)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	sd := s.day(day)
+	if !sd.Open {
+		bad(w, fmt.Errorf("зал закрыт %s", sd.Date), 409)
+		return
+	}
+	o, _ := parseHHMM(sd.Opens)
+	c := 24 * time.Hour
+	if sd.Closes != "24:00" {
+		c, _ = parseHHMM(sd.Closes)
+	}
+	if from < o || to > c {
+		bad(w, fmt.Errorf("зал работает с %s до %s", sd.Opens, sd.Closes), 409)
+		return
+	}
+
+	if in.SeatNo == 0 && capacity != nil {
+		err := tx.QueryRow(ctx, `
+SELECT n FROM generate_series(1, $2::int) n
+WHERE NOT EXISTS (SELECT 1 FROM seat_bookings sb
+                  WHERE sb.room_id = $1 AND sb.seat_no = n AND sb.cancelled_at IS NULL
+                    AND tsrange(sb.starts_at, sb.ends_at) && tsrange($3, $4))
+ORDER BY n LIMIT 1`, roomID, *capacity, starts, ends).Scan(&in.SeatNo)
+		if errors.Is(err, pgx.ErrNoRows) {
+			bad(w, fmt.Errorf("свободных мест на это время нет"), 409)
+			return
+		}
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+	}
+
+	var id string
+	if err := tx.QueryRow(ctx, `
+INSERT INTO seat_bookings(room_id, user_id, seat_no, starts_at, ends_at) VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		roomID, in.UserID, in.SeatNo, starts, ends).Scan(&id); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	b, err := scanBooking(a.db.QueryRow(ctx, bookingSelect+" WHERE sb.id=$1", id))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, b)
+}
+
+// cancelBooking помечает бронь отменённой; история сохраняется.
+func (a *API) cancelBooking(w http.ResponseWriter, r *http.Request) {
+	cmd, err := a.db.Exec(context.Background(),
+		`UPDATE seat_bookings SET cancelled_at=now() WHERE id=$1 AND cancelled_at IS NULL`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// roomVisitors — кто сейчас в зале.
+func (a *API) roomVisitors(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.db.Query(context.Background(), `
+SELECT v.id, u.id, u.name, to_char(v.checked_in_at,'DD/MM/YYYY HH24:MI'), NULL::text
+FROM room_visits v
+JOIN users u ON u.id = v.user_id
+WHERE v.room_id=$1 AND v.checked_out_at IS NULL
+ORDER BY v.checked_in_at`, chi.URLParam(r, "id"))
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	defer rows.Close()
+	out := []VisitRow{}
+	for rows.Next() {
+		var v VisitRow
+		if err := rows.Scan(&v.ID, &v.UserID, &v.UserName, &v.CheckedIn, &v.CheckedOut); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, v)
+	}
+	writeJSON(w, out)
+}
+
+// checkIn отмечает приход читателя; при заданной вместимости зал не переполняется.
+func (a *API) checkIn(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "id")
+	var in struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if in.UserID == "" {
+		bad(w, fmt.Errorf("user_id required"), 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var capacity *int
+	if err := tx.QueryRow(ctx, `SELECT capacity FROM reading_rooms WHERE id=$1 FOR UPDATE`, roomID).Scan(&capacity); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			bad(w, fmt.Errorf("room not found"), 404)
+			return
+		}
+		bad(w, err, 400)
+		return
+	}
+	if capacity != nil {
+		var inside int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM room_visits WHERE room_id=$1 AND checked_out_at IS NULL`, roomID).Scan(&inside); err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if inside >= *capacity {
+			bad(w, fmt.Errorf("в зале нет свободных мест (%d из %d)", inside, *capacity), 409)
+			return
+		}
+	}
+	var v VisitRow
+	if err := tx.QueryRow(ctx, `
+INSERT INTO room_visits(room_id, user_id) VALUES($1,$2)
+RETURNING id, user_id, (SELECT name FROM users WHERE id=$2), to_char(checked_in_at,'DD/MM/YYYY HH24:MI')`,
+		roomID, in.UserID).Scan(&v.ID, &v.UserID, &v.UserName, &v.CheckedIn); err != nil {
+		var pe *pgconn.PgError
+		if errors.As(err, &pe) && pe.Code == "23505" {
+			bad(w, fmt.Errorf("читатель уже отмечен в зале"), 409)
+			return
+		}
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, v)
+}
+
+func (a *API) checkOut(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var v VisitRow
+	err := a.db.QueryRow(context.Background(), `
+UPDATE room_visits v SET checked_out_at=now()
+FROM users u
+WHERE u.id = v.user_id AND v.room_id=$1 AND v.user_id=$2 AND v.checked_out_at IS NULL
+RETURNING v.id, u.id, u.name, to_char(v.checked_in_at,'DD/MM/YYYY HH24:MI'), to_char(v.checked_out_at,'DD/MM/YYYY HH24:MI')`,
+		chi.URLParam(r, "id"), in.UserID).Scan(&v.ID, &v.UserID, &v.UserName, &v.CheckedIn, &v.CheckedOut)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("читатель не отмечен в этом зале"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	writeJSON(w, v)
+}
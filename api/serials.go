@@ -0,0 +1,726 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Периодика: издание (ISSN, периодичность) и его номера. При поступлении
+// номера прогнозируется следующий; пропущенные между ними номера
+// отмечаются как missing. Поступившие номера выдаются через accounting_books.
+
+// serialSteps — шаг между номерами по периодичности; irregular без прогноза даты.
+var serialSteps = map[string]func(time.Time) time.Time{
+	"daily":      func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+	"weekly":     func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	"biweekly":   func(t time.Time) time.Time { return t.AddDate(0, 0, 14) },
+	"monthly":    func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	"bimonthly":  func(t time.Time) time.Time { return t.AddDate(0, 2, 0) },
+	"quarterly":  func(t time.Time) time.Time { return t.AddDate(0, 3, 0) },
+	"semiannual": func(t time.Time) time.Time { return t.AddDate(0, 6, 0) },
+	"annual":     func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	"irregular":  nil,
+}
+
+// serialGraceDays — сколько ждать ожидаемый номер, прежде чем считать его задержанным.
+const serialGraceDays = 7
+
+// maxIssueGaps ограничивает число номеров, отмечаемых пропущенными за одно поступление.
+const maxIssueGaps = 400
+
+type SerialRow struct {
+	ID              string       `json:"id"`
+	Title           string       `json:"title"`
+	ISSN            *string      `json:"issn,omitempty"`
+	PublisherID     *string      `json:"publisher_id,omitempty"`
+	PublisherName   *string      `json:"publisher_name,omitempty"`
+	RoomID          string       `json:"room_id"`
+	RoomName        string       `json:"room_name"`
+	Frequency       string       `json:"frequency"`
+	IssuesPerVolume *int         `json:"issues_per_volume,omitempty"`
+	LendingMode     string       `json:"lending_mode"`
+	Active          bool         `json:"active"`
+	Note            *string      `json:"note,omitempty"`
+	Received        int          `json:"received"`
+	Missing         int          `json:"missing"`
+	Next            *NextIssue   `json:"next,omitempty"`
+	Last            *SerialIssue `json:"last,omitempty"`
+}
+
+type SerialIssue struct {
+	ID          string  `json:"id"`
+	SerialID    string  `json:"serial_id"`
+	SerialTitle string  `json:"serial_title"`
+	Volume      *int    `json:"volume,omitempty"`
+	Number      int     `json:"number"`
+	IssueDate   string  `json:"issue_date"`
+	Status      string  `json:"status"`
+	ReceivedAt  *string `json:"received_at,omitempty"`
+	Copies      int     `json:"copies"`
+	OnLoan      int     `json:"on_loan"`
+	Note        *string `json:"note,omitempty"`
+}
+
+// NextIssue — прогноз следующего номера. IssueDate пуст для нерегулярных изданий.
+type NextIssue struct {
+	Volume    *int    `json:"volume,omitempty"`
+	Number    int     `json:"number"`
+	IssueDate *string `json:"issue_date,omitempty"`
+	Overdue   bool    `json:"overdue"`
+}
+
+type serialUpsert struct {
+	Title           string  `json:"title"`
+	ISSN            string  `json:"issn"`
+	PublisherID     *string `json:"publisher_id"`
+	RoomID          string  `json:"room_id"`
+	Frequency       string  `json:"frequency"`
+	IssuesPerVolume *int    `json:"issues_per_volume"`
+	LendingMode     string  `json:"lending_mode"`
+	Active          *bool   `json:"active"`
+	Note            *string `json:"note"`
+}
+
+func (in *serialUpsert) validate() (*string, error) {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" || in.RoomID == "" {
+		return nil, fmt.Errorf("title and room_id required")
+	}
+	if in.Frequency == "" {
+		in.Frequency = "monthly"
+	}
+	if _, ok := serialSteps[in.Frequency]; !ok {
+		return nil, fmt.Errorf("unknown frequency %q", in.Frequency)
+	}
+	if in.LendingMode == "" {
+		in.LendingMode = lendReadingRoom
+	}
+	if !lendingModes[in.LendingMode] {
+		return nil, fmt.Errorf("unknown lending_mode %q", in.LendingMode)
+	}
+	if in.IssuesPerVolume != nil && *in.IssuesPerVolume <= 0 {
+		return nil, fmt.Errorf("issues_per_volume must be positive")
+	}
+	if in.PublisherID != nil && *in.PublisherID == "" {
+		in.PublisherID = nil
+	}
+	if in.Active == nil {
+		t := true
+		in.Active = &t
+	}
+	if strings.TrimSpace(in.ISSN) == "" {
+		return nil, nil
+	}
+	issn, err := NormalizeISSN(in.ISSN)
+	if err != nil {
+		return nil, err
+	}
+	return &issn, nil
+}
+
+const serialSelect = `
+SELECT s.id, s.title, s.issn, ph.id, ph.name, rr.id, rr.name, s.frequency, s.issues_per_volume,
+       s.lending_mode, s.active, s.note,
+       (SELECT count(*) FROM serial_issues si WHERE si.serial_id = s.id AND si.status = 'received'),
+       (SELECT count(*) FROM serial_issues si WHERE si.serial_id = s.id AND si.status = 'missing')
+FROM serials s
+JOIN reading_rooms rr ON rr.id = s.reading_room_id
+LEFT JOIN publishing_houses ph ON ph.id = s.publisher_id
+`
+
+func scanSerial(row interface{ Scan(...any) error }) (SerialRow, error) {
+	var s SerialRow
+	err := row.Scan(&s.ID, &s.Title, &s.ISSN, &s.PublisherID, &s.PublisherName, &s.RoomID, &s.RoomName,
+		&s.Frequency, &s.IssuesPerVolume, &s.LendingMode, &s.Active, &s.Note, &s.Received, &s.Missing)
+	return s, err
+}
+
+const issueSelect = `
+SELECT si.id, s.id, s.title, si.volume, si.number, to_char(si.issue_date,'DD/MM/YYYY'), si.status,
+       to_char(si.received_at,'DD/MM/YYYY'), si.copies,
+       (SELECT count(*) FROM accounting_books ab WHERE ab.issue_id = si.id AND ab.date_return IS NULL),
+       si.note
+FROM serial_issues si
+JOIN serials s ON s.id = si.serial_id
+`
+
+func scanIssue(row interface{ Scan(...any) error }) (SerialIssue, error) {
+	var i SerialIssue
+	err := row.Scan(&i.ID, &i.SerialID, &i.SerialTitle, &i.Volume, &i.Number, &i.IssueDate, &i.Status,
+		&i.ReceivedAt, &i.Copies, &i.OnLoan, &i.Note)
+	return i, err
+}
+
+func queryIssues(q dbQuerier, where string, args ...any) ([]SerialIssue, error) {
+	rows, err := q.Query(context.Background(), issueSelect+where+
+		" ORDER BY s.title, coalesce(si.volume, 0) DESC, si.number DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SerialIssue{}
+	for rows.Next() {
+		i, err := scanIssue(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+// issueKey — позиция номера в нумерации издания (том, номер).
+type issueKey struct {
+	volume *int
+	number int
+}
+
+func (k issueKey) less(o issueKey) bool {
+	v1, v2 := 0, 0
+	if k.volume != nil {
+		v1 = *k.volume
+	}
+	if o.volume != nil {
+		v2 = *o.volume
+	}
+	if v1 != v2 {
+		return v1 < v2
+	}
+	return k.number < o.number
+}
+
+func (k issueKey) equal(o issueKey) bool { return !k.less(o) && !o.less(k) }
+
+// serialState — всё, что нужно для прогноза следующего номера.
+type serialState struct {
+	frequency       string
+	issuesPerVolume *int
+	last            *issueKey
+	lastDate        time.Time
+}
+
+func loadSerialState(ctx context.Context, q dbQuerier, serialID string, lock bool) (*serialState, error) {
+	st := &serialState{}
+	sql := `SELECT frequency, issues_per_volume FROM serials WHERE id=$1`
+	if lock {
+		sql += " FOR UPDATE"
+	}
+	if err := q.QueryRow(ctx, sql, serialID).Scan(&st.frequency, &st.issuesPerVolume); err != nil {
+		return nil, err
+	}
+	var k issueKey
+	err := q.QueryRow(ctx, `
+SELECT volume, number, issue_date FROM serial_issues WHERE serial_id=$1
+ORDER BY coalesce(volume, 0) DESC, number DESC LIMIT 1`, serialID).Scan(&k.volume, &k.number, &st.lastDate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st.last = &k
+	return st, nil
+}
+
+// after возвращает номер, следующий за k, и его ожидаемую дату (nil для irregular).
+func (st *serialState) after(k issueKey, date time.Time) (issueKey, *time.Time) {
+	next := issueKey{volume: k.volume, number: k.number + 1}
+	// без тома нумерация сквозная: сброс на 1 повторил бы уже поступившие номера
+	if st.issuesPerVolume != nil && k.volume != nil && k.number >= *st.issuesPerVolume {
+		v := *k.volume + 1
+		next = issueKey{volume: &v, number: 1}
+	}
+	step := serialSteps[st.frequency]
+	if step == nil {
+		return next, nil
+	}
+	d := step(date)
+	return next, &d
+}
+
+// issueGap — номер, который должен был выйти, но не поступил.
+type issueGap struct {
+	key  issueKey
+	date time.Time
+}
+
+// gaps — номера от ожидаемого from (с датой fromDate) до поступившего to,
+// не включая его; date — дата для номеров без прогноза даты. Без
+// issues_per_volume неизвестно, сколько номеров в томе (часто том — это год),
+// поэтому пропуски ищутся только в томе поступившего номера.
+func (st *serialState) gaps(from issueKey, fromDate *time.Time, to issueKey, date time.Time) []issueGap {
+	var out []issueGap
+	k, d := from, fromDate
+	for i := 0; k.less(to) && i < maxIssueGaps; i++ {
+		if st.issuesPerVolume == nil && !sameVolume(k.volume, to.volume) {
+			break
+		}
+		g := issueGap{key: k, date: date}
+		if d != nil {
+			g.date = *d
+			k, d = st.after(k, *d)
+		} else {
+			k, _ = st.after(k, date)
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+func sameVolume(a, b *int) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+func (st *serialState) next() *NextIssue {
+	if st.last == nil {
+		return nil
+	}
+	k, d := st.after(*st.last, st.lastDate)
+	n := &NextIssue{Volume: k.volume, Number: k.number}
+	if d != nil {
+		s := dmy(*d)
+		n.IssueDate = &s
+		n.Overdue = today().After(d.AddDate(0, 0, serialGraceDays))
+	}
+	return n
+}
+
+// listSerials: ?q= (название или ISSN), ?active=true|false.
+func (a *API) listSerials(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := strings.TrimSpace(qs.Get("q")); v != "" {
+		args = append(args, "%"+v+"%")
+		where = append(where, fmt.Sprintf("(s.title ILIKE $%[1]d OR s.issn ILIKE $%[1]d)", len(args)))
+	}
+	if v := qs.Get("active"); v != "" {
+		args = append(args, v == "true")
+		where = append(where, fmt.Sprintf("s.active = $%d", len(args)))
+	}
+	q := serialSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY s.title", args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []SerialRow{}
+	for rows.Next() {
+		s, err := scanSerial(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) serialByID(w http.ResponseWriter, id string) {
+	ctx := context.Background()
+	s, err := scanSerial(a.db.QueryRow(ctx, serialSelect+" WHERE s.id=$1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	st, err := loadSerialState(ctx, a.db, id, false)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	s.Next = st.next()
+	if st.last != nil {
+		last, err := scanIssue(a.db.QueryRow(ctx, issueSelect+
+			" WHERE si.serial_id=$1 AND coalesce(si.volume, 0)=coalesce($2::int, 0) AND si.number=$3",
+			id, st.last.volume, st.last.number))
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		s.Last = &last
+	}
+	writeJSON(w, s)
+}
+
+func (a *API) getSerial(w http.ResponseWriter, r *http.Request) {
+	a.serialByID(w, chi.URLParam(r, "id"))
+}
+
+func (a *API) createSerial(w http.ResponseWriter, r *http.Request) {
+	var in serialUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	issn, err := in.validate()
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var id string
+	if err := a.db.QueryRow(context.Background(), `
+INSERT INTO serials(title, issn, publisher_id, reading_room_id, frequency, issues_per_volume, lending_mode, active, note)
+VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id`,
+		in.Title, issn, in.PublisherID, in.RoomID, in.Frequency, in.IssuesPerVolume, in.LendingMode, *in.Active, in.Note,
+	).Scan(&id); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	a.serialByID(w, id)
+}
+
+func (a *API) updateSerial(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in serialUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	issn, err := in.validate()
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	// нумерация по томам: уже заведённым номерам без тома нельзя
+	// предсказать следующий
+	if in.IssuesPerVolume != nil {
+		var noVolume bool
+		if err := a.db.QueryRow(context.Background(),
+			`SELECT EXISTS(SELECT 1 FROM serial_issues WHERE serial_id=$1 AND volume IS NULL)`, id).Scan(&noVolume); err != nil {
+			bad(w, err, 400)
+			return
+		}
+		if noVolume {
+			bad(w, fmt.Errorf("issues_per_volume requires a volume on every issue; set volumes on existing issues first"), 409)
+			return
+		}
+	}
+	cmd, err := a.db.Exec(context.Background(), `
+UPDATE serials SET title=$2, issn=$3, publisher_id=$4, reading_room_id=$5, frequency=$6,
+                   issues_per_volume=$7, lending_mode=$8, active=$9, note=$10
+WHERE id=$1`,
+		id, in.Title, issn, in.PublisherID, in.RoomID, in.Frequency, in.IssuesPerVolume, in.LendingMode, *in.Active, in.Note)
+	if err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.serialByID(w, id)
+}
+
+// deleteSerial удаляет издание вместе с номерами, если их ни разу не выдавали.
+func (a *API) deleteSerial(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var loans bool
+	if err := a.db.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM accounting_books ab JOIN serial_issues si ON si.id = ab.issue_id WHERE si.serial_id=$1)`,
+		id).Scan(&loans); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if loans {
+		bad(w, fmt.Errorf("номера издания выдавались — сделайте его неактивным"), 409)
+		return
+	}
+	cmd, err := a.db.Exec(ctx, `DELETE FROM serials WHERE id=$1`, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// listSerialIssues: ?status=received|missing
+func (a *API) listSerialIssues(w http.ResponseWriter, r *http.Request) {
+	where := " WHERE si.serial_id = $1"
+	args := []any{chi.URLParam(r, "id")}
+	if v := r.URL.Query().Get("status"); v != "" {
+		args = append(args, v)
+		where += " AND si.status = $2"
+	}
+	out, err := queryIssues(a.db, where, args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, out)
+}
+
+// checkInIssue регистрирует поступивший номер: {"volume","number","issue_date","copies","note"}.
+// Незаданные том, номер и дата берутся из прогноза. Ранее отмеченный
+// пропущенным номер становится поступившим; номера между прогнозом и
+// поступившим отмечаются пропущенными.
+func (a *API) checkInIssue(w http.ResponseWriter, r *http.Request) {
+	serialID := chi.URLParam(r, "id")
+	var in struct {
+		Volume    *int    `json:"volume"`
+		Number    int     `json:"number"`
+		IssueDate string  `json:"issue_date"`
+		Copies    *int    `json:"copies"`
+		Note      *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	copies := 1
+	if in.Copies != nil {
+		copies = *in.Copies
+	}
+	if copies < 0 || in.Number < 0 {
+		bad(w, fmt.Errorf("number and copies must not be negative"), 400)
+		return
+	}
+
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	st, err := loadSerialState(ctx, tx, serialID, true)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+
+	var predicted *issueKey
+	var predictedDate *time.Time
+	if st.last != nil {
+		k, d := st.after(*st.last, st.lastDate)
+		predicted, predictedDate = &k, d
+	}
+	key := issueKey{volume: in.Volume, number: in.Number}
+	if in.Number == 0 {
+		if predicted == nil {
+			bad(w, fmt.Errorf("number required for the first issue"), 400)
+			return
+		}
+		key = *predicted
+		if in.Volume != nil {
+			key.volume = in.Volume
+		}
+	}
+	if st.issuesPerVolume != nil && key.volume == nil {
+		bad(w, fmt.Errorf("volume required: issues are numbered within volumes"), 400)
+		return
+	}
+	var date time.Time
+	switch {
+	case strings.TrimSpace(in.IssueDate) != "":
+		if date, err = parseDDMMYYYY(in.IssueDate); err != nil {
+			bad(w, fmt.Errorf("issue_date must be DD/MM/YYYY"), 400)
+			return
+		}
+	case predictedDate != nil && key.equal(*predicted):
+		date = *predictedDate
+	default:
+		date = today()
+	}
+
+	var existingID, status string
+	err = tx.QueryRow(ctx, `
+SELECT id, status FROM serial_issues
+WHERE serial_id=$1 AND coalesce(volume, 0)=coalesce($2::int, 0) AND number=$3 FOR UPDATE`,
+		serialID, key.volume, key.number).Scan(&existingID, &status)
+	switch {
+	case err == nil && status == "received":
+		bad(w, fmt.Errorf("номер уже поступил"), 409)
+		return
+	case err == nil:
+		if _, err := tx.Exec(ctx, `
+UPDATE serial_issues SET status='received', received_at=$2, copies=$3, note=coalesce($4, note),
+                         issue_date=coalesce($5, issue_date)
+WHERE id=$1`, existingID, today(), copies, in.Note, nullDate(in.IssueDate, date)); err != nil {
+			badConstraint(w, err)
+			return
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		if err := tx.QueryRow(ctx, `
+INSERT INTO serial_issues(serial_id, volume, number, issue_date, status, received_at, copies, note)
+VALUES($1,$2,$3,$4,'received',$5,$6,$7) RETURNING id`,
+			serialID, key.volume, key.number, date, today(), copies, in.Note).Scan(&existingID); err != nil {
+			badConstraint(w, err)
+			return
+		}
+	default:
+		bad(w, err, 500)
+		return
+	}
+
+	// пропуски между прогнозом и поступившим номером
+	var missing []string
+	if predicted != nil {
+		for _, g := range st.gaps(*predicted, predictedDate, key, date) {
+			var id string
+			err := tx.QueryRow(ctx, `
+INSERT INTO serial_issues(serial_id, volume, number, issue_date, status, copies)
+VALUES($1,$2,$3,$4,'missing',0)
+ON CONFLICT DO NOTHING RETURNING id`, serialID, g.key.volume, g.key.number, g.date).Scan(&id)
+			if err == nil {
+				missing = append(missing, id)
+			} else if !errors.Is(err, pgx.ErrNoRows) {
+				bad(w, err, 500)
+				return
+			}
+		}
+	}
+
+	issue, err := scanIssue(tx.QueryRow(ctx, issueSelect+" WHERE si.id=$1", existingID))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	flagged, err := queryIssues(tx, " WHERE si.id = ANY($1::uuid[])", missing)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, map[string]any{"issue": issue, "missing": flagged})
+}
+
+// nullDate — дата для колонки, только если она пришла в запросе.
+func nullDate(raw string, d time.Time) *time.Time {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	return &d
+}
+
+// updateIssue: {"copies","note","issue_date"}.
+func (a *API) updateIssue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in struct {
+		Copies    *int    `json:"copies"`
+		IssueDate string  `json:"issue_date"`
+		Note      *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var date *time.Time
+	if strings.TrimSpace(in.IssueDate) != "" {
+		d, err := parseDDMMYYYY(in.IssueDate)
+		if err != nil {
+			bad(w, fmt.Errorf("issue_date must be DD/MM/YYYY"), 400)
+			return
+		}
+		date = &d
+	}
+	ctx := context.Background()
+	cmd, err := a.db.Exec(ctx, `
+UPDATE serial_issues SET copies=coalesce($2, copies), issue_date=coalesce($3, issue_date), note=$4 WHERE id=$1`,
+		id, in.Copies, date, in.Note)
+	if err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	issue, err := scanIssue(a.db.QueryRow(ctx, issueSelect+" WHERE si.id=$1", id))
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, issue)
+}
+
+func (a *API) deleteIssue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var loans bool
+	if err := a.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM accounting_books WHERE issue_id=$1)`, id).Scan(&loans); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if loans {
+		bad(w, fmt.Errorf("номер выдавался, удалить нельзя"), 409)
+		return
+	}
+	cmd, err := a.db.Exec(ctx, `DELETE FROM serial_issues WHERE id=$1`, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// serialClaims — что требовать у поставщиков: пропущенные номера и
+// активные издания, чей следующий номер задерживается дольше serialGraceDays.
+func (a *API) serialClaims(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	missing, err := queryIssues(a.db, " WHERE si.status = 'missing' AND s.active")
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	rows, err := a.db.Query(ctx, serialSelect+" WHERE s.active AND s.frequency <> 'irregular' ORDER BY s.title")
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	var serials []SerialRow
+	for rows.Next() {
+		s, err := scanSerial(rows)
+		if err != nil {
+			rows.Close()
+			bad(w, err, 500)
+			return
+		}
+		serials = append(serials, s)
+	}
+	rows.Close()
+	overdue := []SerialRow{}
+	for _, s := range serials {
+		st, err := loadSerialState(ctx, a.db, s.ID, false)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if n := st.next(); n != nil && n.Overdue {
+			s.Next = n
+			overdue = append(overdue, s)
+		}
+	}
+	writeJSON(w, map[string]any{"missing": missing, "overdue": overdue})
+}
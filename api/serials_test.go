@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func vol(v int) *int { return &v }
+
+func issueStr(k issueKey) string {
+	if k.volume == nil {
+		return fmt.Sprintf("#%d", k.number)
+	}
+	return fmt.Sprintf("%d/#%d", *k.volume, k.number)
+}
+
+func TestSerialAfter(t *testing.T) {
+	jan := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name string
+		st   serialState
+		k    issueKey
+		want string
+		date string
+	}{
+		{"continuous numbering", serialState{frequency: "monthly"}, issueKey{number: 41}, "#42", "15/02/2025"},
+		{"volume without issues_per_volume", serialState{frequency: "monthly"}, issueKey{volume: vol(2024), number: 12}, "2024/#13", "15/02/2025"},
+		{"within volume", serialState{frequency: "weekly", issuesPerVolume: vol(4)}, issueKey{volume: vol(3), number: 2}, "3/#3", "22/01/2025"},
+		{"volume rollover", serialState{frequency: "weekly", issuesPerVolume: vol(4)}, issueKey{volume: vol(3), number: 4}, "4/#1", "22/01/2025"},
+		{"irregular", serialState{frequency: "irregular"}, issueKey{number: 7}, "#8", ""},
+	} {
+		k, d := c.st.after(c.k, jan)
+		date := ""
+		if d != nil {
+			date = dmy(*d)
+		}
+		if issueStr(k) != c.want || date != c.date {
+			t.Errorf("%s: got %s %q, want %s %q", c.name, issueStr(k), date, c.want, c.date)
+		}
+	}
+}
+
+func TestSerialGaps(t *testing.T) {
+	jan := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	feb := jan.AddDate(0, 1, 0)
+	for _, c := range []struct {
+		name     string
+		st       serialState
+		from, to issueKey
+		want     []string
+	}{
+		{"expected issue", serialState{frequency: "monthly"}, issueKey{number: 5}, issueKey{number: 5}, nil},
+		{"continuous", serialState{frequency: "monthly"}, issueKey{number: 5}, issueKey{number: 8}, []string{"#5", "#6", "#7"}},
+		// том — год, число номеров в томе неизвестно: конец 2024 не угадываем
+		{"new volume without issues_per_volume", serialState{frequency: "monthly"},
+			issueKey{volume: vol(2024), number: 13}, issueKey{volume: vol(2025), number: 1}, nil},
+		{"same volume without issues_per_volume", serialState{frequency: "monthly"},
+			issueKey{volume: vol(2025), number: 2}, issueKey{volume: vol(2025), number: 4}, []string{"2025/#2", "2025/#3"}},
+		{"across volumes", serialState{frequency: "monthly", issuesPerVolume: vol(3)},
+			issueKey{volume: vol(1), number: 2}, issueKey{volume: vol(2), number: 2}, []string{"1/#2", "1/#3", "2/#1"}},
+		{"received earlier than expected", serialState{frequency: "monthly"}, issueKey{number: 9}, issueKey{number: 8}, nil},
+	} {
+		var got []string
+		for _, g := range c.st.gaps(c.from, &jan, c.to, feb) {
+			got = append(got, issueStr(g.key))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	// даты пропущенных номеров идут по периодичности; без прогноза — дата поступившего
+	st := serialState{frequency: "monthly"}
+	g := st.gaps(issueKey{number: 1}, &jan, issueKey{number: 3}, feb)
+	if len(g) != 2 || !g[0].date.Equal(jan) || !g[1].date.Equal(feb) {
+		t.Errorf("dates: %+v", g)
+	}
+	st = serialState{frequency: "irregular"}
+	g = st.gaps(issueKey{number: 1}, nil, issueKey{number: 3}, feb)
+	if len(g) != 2 || !g[0].date.Equal(feb) || !g[1].date.Equal(feb) {
+		t.Errorf("irregular dates: %+v", g)
+	}
+	if g := st.gaps(issueKey{number: 1}, nil, issueKey{number: 10000}, feb); len(g) != maxIssueGaps {
+		t.Errorf("got %d gaps, want cap %d", len(g), maxIssueGaps)
+	}
+}
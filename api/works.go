@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Произведения: издания и переводы одного текста сгруппированы в works,
+// каталог можно просматривать по произведениям с доступностью по всем изданиям.
+
+type WorkRow struct {
+	ID               string    `json:"id"`
+	Title            string    `json:"title"`
+	OriginalTitle    *string   `json:"original_title,omitempty"`
+	AuthorID         string    `json:"author_id"`
+	AuthorName       string    `json:"author_name"`
+	OriginalLanguage *string   `json:"original_language,omitempty"`
+	Note             *string   `json:"note,omitempty"`
+	Editions         int       `json:"editions"`
+	Copies           int       `json:"copies"`
+	Available        int       `json:"available"`
+	Languages        []string  `json:"languages"`
+	Books            []BookRow `json:"books,omitempty"`
+}
+
+type workUpsert struct {
+	Title            string  `json:"title"`
+	OriginalTitle    *string `json:"original_title"`
+	AuthorID         string  `json:"author_id"`
+	OriginalLanguage *string `json:"original_language"`
+	Note             *string `json:"note"`
+}
+
+func (in *workUpsert) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" || in.AuthorID == "" {
+		return fmt.Errorf("title and author_id required")
+	}
+	if in.OriginalLanguage != nil {
+		l, err := normLanguage(*in.OriginalLanguage)
+		if err != nil {
+			return err
+		}
+		in.OriginalLanguage = l
+	}
+	return nil
+}
+
+// ensureWork находит произведение с тем же названием и автором или заводит новое.
+func ensureWork(ctx context.Context, q dbQuerier, title, authorID string) (string, error) {
+	var id string
+	err := q.QueryRow(ctx, `
+SELECT id FROM works WHERE author_id=$2 AND lower(title)=lower($1) ORDER BY id LIMIT 1`, title, authorID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = q.QueryRow(ctx, `INSERT INTO works(title, author_id) VALUES($1,$2) RETURNING id`, title, authorID).Scan(&id)
+	}
+	return id, err
+}
+
+const workSelect = `
+SELECT w.id, w.title, w.original_title, au.id, au.name, w.original_language, w.note,
+       (SELECT count(*) FROM books b WHERE b.work_id = w.id),
+       (SELECT coalesce(sum(b.number_copies), 0) FROM books b WHERE b.work_id = w.id),
+       (SELECT count(*) FROM books b JOIN book_copies c ON c.book_id = b.id WHERE b.work_id = w.id AND ` + copyFree + `),
+       (SELECT coalesce(array_agg(DISTINCT l.code), '{}')
+        FROM books b JOIN book_languages bl ON bl.book_id = b.id JOIN languages l ON l.id = bl.language_id
+        WHERE b.work_id = w.id)
+FROM works w
+JOIN book_authors au ON au.id = w.author_id
+`
+
+func scanWork(row interface{ Scan(...any) error }) (WorkRow, error) {
+	var wr WorkRow
+	err := row.Scan(&wr.ID, &wr.Title, &wr.OriginalTitle, &wr.AuthorID, &wr.AuthorName, &wr.OriginalLanguage, &wr.Note,
+		&wr.Editions, &wr.Copies, &wr.Available, &wr.Languages)
+	return wr, err
+}
+
+// listWorks: ?q= (название или оригинальное название), ?author_id=, ?available=true.
+func (a *API) listWorks(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var where []string
+	var args []any
+	if v := strings.TrimSpace(qs.Get("q")); v != "" {
+		args = append(args, "%"+v+"%")
+		where = append(where, fmt.Sprintf("(w.title ILIKE $%[1]d OR w.original_title ILIKE $%[1]d)", len(args)))
+	}
+	if v := qs.Get("author_id"); v != "" {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("w.author_id = $%d", len(args)))
+	}
+	q := workSelect
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := a.db.Query(context.Background(), q+" ORDER BY w.title, au.name", args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	onlyAvailable := qs.Get("available") == "true"
+	out := []WorkRow{}
+	for rows.Next() {
+		wr, err := scanWork(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		if onlyAvailable && wr.Available == 0 {
+			continue
+		}
+		out = append(out, wr)
+	}
+	writeJSON(w, out)
+}
+
+// workByID отдаёт произведение со всеми изданиями.
+func (a *API) workByID(w http.ResponseWriter, id string) {
+	wr, err := scanWork(a.db.QueryRow(context.Background(), workSelect+" WHERE w.id=$1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if wr.Books, err = a.queryBooks(" WHERE b.work_id=$1", id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, wr)
+}
+
+func (a *API) getWork(w http.ResponseWriter, r *http.Request) {
+	a.workByID(w, chi.URLParam(r, "id"))
+}
+
+func (a *API) createWork(w http.ResponseWriter, r *http.Request) {
+	var in workUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := in.validate(); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	var id string
+	if err := a.db.QueryRow(context.Background(), `
+INSERT INTO works(title, original_title, author_id, original_language, note) VALUES($1,$2,$3,$4,$5) RETURNING id`,
+		in.Title, in.OriginalTitle, in.AuthorID, in.OriginalLanguage, in.Note).Scan(&id); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	a.workByID(w, id)
+}
+
+func (a *API) updateWork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var in workUpsert
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := in.validate(); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	cmd, err := a.db.Exec(context.Background(), `
+UPDATE works SET title=$2, original_title=$3, author_id=$4, original_language=$5, note=$6 WHERE id=$1`,
+		id, in.Title, in.OriginalTitle, in.AuthorID, in.OriginalLanguage, in.Note)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	a.workByID(w, id)
+}
+
+func (a *API) deleteWork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx := context.Background()
+	var used bool
+	if err := a.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM books WHERE work_id=$1)`, id).Scan(&used); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if used {
+		bad(w, fmt.Errorf("у произведения есть издания"), 409)
+		return
+	}
+	cmd, err := a.db.Exec(ctx, `DELETE FROM works WHERE id=$1`, id)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if cmd.RowsAffected() == 0 {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// mergeWorks переносит издания с произведений {"ids": [...]} на {id} и удаляет
+// их — например, чтобы присоединить перевод, заведённый как отдельное произведение.
+func (a *API) mergeWorks(w http.ResponseWriter, r *http.Request) {
+	target := chi.URLParam(r, "id")
+	var in struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	dups := mergeIDs(target, in.IDs)
+	if len(dups) == 0 {
+		bad(w, fmt.Errorf("ids of works to merge required"), 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	var locked int
+	if err := tx.QueryRow(ctx, `
+SELECT count(*) FROM (SELECT id FROM works WHERE id = $1 OR id = ANY($2::uuid[]) FOR UPDATE) t`,
+		target, dups).Scan(&locked); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if locked != len(dups)+1 {
+		bad(w, fmt.Errorf("work not found"), 404)
+		return
+	}
+	if _, err := tx.Exec(ctx, `UPDATE books SET work_id = $1 WHERE work_id = ANY($2::uuid[])`, target, dups); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM works WHERE id = ANY($1::uuid[])`, dups); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.workByID(w, target)
+}
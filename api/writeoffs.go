@@ -0,0 +1,407 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Списание экземпляров: сотрудник составляет акт, администратор его
+// утверждает или отклоняет. При утверждении экземпляры получают статус
+// written_off (история выдач сохраняется), number_copies пересчитывает триггер.
+
+var writeOffReasons = map[string]string{
+	"worn":     "Ветхость",
+	"damaged":  "Повреждение",
+	"lost":     "Утеря",
+	"outdated": "Устаревшее содержание",
+	"other":    "Прочее",
+}
+
+type WriteOffItem struct {
+	CopyID      string `json:"copy_id"`
+	InventoryNo string `json:"inventory_no"`
+	BookID      string `json:"book_id"`
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Year        int    `json:"year"`
+	Reason      string `json:"reason"`
+}
+
+type WriteOffAct struct {
+	ID           string         `json:"id"`
+	ActNo        int            `json:"act_no"`
+	Status       string         `json:"status"`
+	Note         *string        `json:"note,omitempty"`
+	CreatedBy    *string        `json:"created_by,omitempty"`
+	CreatedAt    string         `json:"created_at"`
+	DecidedBy    *string        `json:"decided_by,omitempty"`
+	DecidedAt    *string        `json:"decided_at,omitempty"`
+	DecisionNote *string        `json:"decision_note,omitempty"`
+	Items        []WriteOffItem `json:"items"`
+}
+
+const writeOffSelect = `
+SELECT w.id, w.act_no, w.status, w.note, ce.login, to_char(w.created_at,'DD/MM/YYYY HH24:MI'),
+       de.login, to_char(w.decided_at,'DD/MM/YYYY HH24:MI'), w.decision_note,
+       coalesce((SELECT json_agg(json_build_object(
+                    'copy_id', c.id, 'inventory_no', c.inventory_no, 'book_id', b.id,
+                    'title', b.name, 'author', au.name, 'year', b.year_publication, 'reason', i.reason)
+                    ORDER BY c.inventory_no)
+                 FROM write_off_items i
+                 JOIN book_copies c ON c.id = i.copy_id
+                 JOIN books b ON b.id = c.book_id
+                 JOIN book_authors au ON au.id = b.author_id
+                 WHERE i.act_id = w.id), '[]')
+FROM write_off_acts w
+LEFT JOIN employees ce ON ce.id = w.created_by
+LEFT JOIN employees de ON de.id = w.decided_by
+`
+
+func scanWriteOff(row interface{ Scan(...any) error }) (WriteOffAct, error) {
+	var a WriteOffAct
+	err := row.Scan(&a.ID, &a.ActNo, &a.Status, &a.Note, &a.CreatedBy, &a.CreatedAt,
+		&a.DecidedBy, &a.DecidedAt, &a.DecisionNote, &a.Items)
+	return a, err
+}
+
+func (a *API) writeOffByID(w http.ResponseWriter, id string) {
+	act, err := scanWriteOff(a.db.QueryRow(context.Background(), writeOffSelect+" WHERE w.id=$1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	writeJSON(w, act)
+}
+
+// listWriteOffs: ?status=
+func (a *API) listWriteOffs(w http.ResponseWriter, r *http.Request) {
+	where := ""
+	var args []any
+	if v := r.URL.Query().Get("status"); v != "" {
+		args = append(args, v)
+		where = " WHERE w.status = $1"
+	}
+	rows, err := a.db.Query(context.Background(), writeOffSelect+where+" ORDER BY w.act_no DESC", args...)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer rows.Close()
+	out := []WriteOffAct{}
+	for rows.Next() {
+		act, err := scanWriteOff(rows)
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		out = append(out, act)
+	}
+	writeJSON(w, out)
+}
+
+func (a *API) getWriteOff(w http.ResponseWriter, r *http.Request) {
+	a.writeOffByID(w, chi.URLParam(r, "id"))
+}
+
+// createWriteOff: {"items":[{"copy_id"|"inventory_no", "reason"}], "note"}.
+// Списать можно доступный или утерянный экземпляр, не находящийся на руках
+// и не включённый в другой несогласованный акт.
+func (a *API) createWriteOff(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Items []struct {
+			CopyID      string `json:"copy_id"`
+			InventoryNo string `json:"inventory_no"`
+			Reason      string `json:"reason"`
+		} `json:"items"`
+		Note *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		bad(w, err, 400)
+		return
+	}
+	if len(in.Items) == 0 {
+		bad(w, fmt.Errorf("items required"), 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	if err := tx.QueryRow(ctx, `INSERT INTO write_off_acts(note, created_by) VALUES($1,$2) RETURNING id`,
+		in.Note, currentEmployee(r).ID).Scan(&id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	seen := map[string]bool{}
+	for _, it := range in.Items {
+		if _, ok := writeOffReasons[it.Reason]; !ok {
+			bad(w, fmt.Errorf("unknown reason %q", it.Reason), 400)
+			return
+		}
+		ref := it.CopyID
+		cond := "c.id::text = $1"
+		if ref == "" {
+			ref, cond = strings.TrimSpace(it.InventoryNo), "c.inventory_no = $1"
+		}
+		if ref == "" {
+			bad(w, fmt.Errorf("copy_id or inventory_no required"), 400)
+			return
+		}
+		var copyID, inv, status string
+		var onLoan, pending bool
+		err := tx.QueryRow(ctx, `
+SELECT c.id, c.inventory_no, c.status,
+       EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL),
+       EXISTS (SELECT 1 FROM write_off_items i JOIN write_off_acts wa ON wa.id = i.act_id
+               WHERE i.copy_id = c.id AND wa.status = 'pending')
+FROM book_copies c WHERE `+cond+` FOR UPDATE OF c`, ref).Scan(&copyID, &inv, &status, &onLoan, &pending)
+		if errors.Is(err, pgx.ErrNoRows) {
+			bad(w, fmt.Errorf("экземпляр %s не найден", ref), 404)
+			return
+		}
+		if err != nil {
+			bad(w, err, 500)
+			return
+		}
+		switch {
+		case seen[copyID]:
+			bad(w, fmt.Errorf("экземпляр %s указан дважды", inv), 400)
+			return
+		case status != "available" && status != "lost":
+			bad(w, fmt.Errorf("экземпляр %s нельзя списать: статус %s", inv, status), 409)
+			return
+		case onLoan:
+			bad(w, fmt.Errorf("экземпляр %s на руках", inv), 409)
+			return
+		case pending:
+			bad(w, fmt.Errorf("экземпляр %s уже включён в другой акт", inv), 409)
+			return
+		}
+		seen[copyID] = true
+		if _, err := tx.Exec(ctx, `INSERT INTO write_off_items(act_id, copy_id, reason) VALUES($1,$2,$3)`,
+			id, copyID, it.Reason); err != nil {
+			bad(w, err, 500)
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.writeOffByID(w, id)
+}
+
+func decodeDecision(r *http.Request) (*string, error) {
+	var in struct {
+		Note *string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			return nil, err
+		}
+	}
+	return in.Note, nil
+}
+
+// lockPendingAct блокирует акт и проверяет, что решение по нему ещё не принято.
+func lockPendingAct(ctx context.Context, tx pgx.Tx, id string) (int, error) {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM write_off_acts WHERE id=$1 FOR UPDATE`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 404, fmt.Errorf("not found")
+	}
+	if err != nil {
+		return 500, err
+	}
+	if status != "pending" {
+		return 409, fmt.Errorf("акт уже %s", status)
+	}
+	return 0, nil
+}
+
+// approveWriteOff (admin): экземпляры акта списываются, незавершённые
+// заявки на их перемещение отменяются.
+func (a *API) approveWriteOff(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	note, err := decodeDecision(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	if code, err := lockPendingAct(ctx, tx, id); err != nil {
+		bad(w, err, code)
+		return
+	}
+
+	var inv *string
+	err = tx.QueryRow(ctx, `
+SELECT min(c.inventory_no) FROM write_off_items i
+JOIN book_copies c ON c.id = i.copy_id
+WHERE i.act_id = $1
+  AND (c.status NOT IN ('available', 'lost')
+       OR EXISTS (SELECT 1 FROM accounting_books ab WHERE ab.copy_id = c.id AND ab.date_return IS NULL))`,
+		id).Scan(&inv)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if inv != nil {
+		bad(w, fmt.Errorf("экземпляр %s выдан или перемещается — списание невозможно", *inv), 409)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `
+UPDATE copy_transfers SET status='cancelled', cancelled_at=now()
+WHERE status = 'requested' AND copy_id IN (SELECT copy_id FROM write_off_items WHERE act_id=$1)`, id); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE book_copies SET status='written_off'
+WHERE id IN (SELECT copy_id FROM write_off_items WHERE act_id=$1)`, id); err != nil {
+		badConstraint(w, err)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE write_off_acts SET status='approved', decided_by=$2, decided_at=now(), decision_note=$3 WHERE id=$1`,
+		id, currentEmployee(r).ID, note); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.writeOffByID(w, id)
+}
+
+// rejectWriteOff (admin): экземпляры остаются в фонде.
+func (a *API) rejectWriteOff(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	note, err := decodeDecision(r)
+	if err != nil {
+		bad(w, err, 400)
+		return
+	}
+	ctx := context.Background()
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	defer tx.Rollback(ctx)
+	if code, err := lockPendingAct(ctx, tx, id); err != nil {
+		bad(w, err, code)
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE write_off_acts SET status='rejected', decided_by=$2, decided_at=now(), decision_note=$3 WHERE id=$1`,
+		id, currentEmployee(r).ID, note); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		bad(w, err, 500)
+		return
+	}
+	a.writeOffByID(w, id)
+}
+
+// writeOffActPDF — печатная форма утверждённого акта.
+func (a *API) writeOffActPDF(w http.ResponseWriter, r *http.Request) {
+	if a.pdfFont == "" {
+		bad(w, fmt.Errorf("PDF font not configured"), 501)
+		return
+	}
+	font, err := loadPDFFont(a.pdfFont)
+	if err != nil {
+		bad(w, err, 501)
+		return
+	}
+	act, err := scanWriteOff(a.db.QueryRow(context.Background(), writeOffSelect+" WHERE w.id=$1", chi.URLParam(r, "id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bad(w, fmt.Errorf("not found"), 404)
+		return
+	}
+	if err != nil {
+		bad(w, err, 500)
+		return
+	}
+	if act.Status != "approved" {
+		bad(w, fmt.Errorf("акт не утверждён"), 409)
+		return
+	}
+
+	d := newPDF(font)
+	title := fmt.Sprintf("АКТ № %d", act.ActNo)
+	d.Text((pdfPageW-d.TextWidth(title, 14))/2, 60, 14, title)
+	sub := "о списании экземпляров из библиотечного фонда"
+	d.Text((pdfPageW-d.TextWidth(sub, 11))/2, 78, 11, sub)
+	decided := ""
+	if act.DecidedAt != nil {
+		decided = (*act.DecidedAt)[:10]
+	}
+	d.TextRight(pdfPageW-40, 100, 10, "Дата утверждения: "+decided)
+	y := 120.0
+	if act.Note != nil && *act.Note != "" {
+		for _, l := range d.Wrap("Основание: "+*act.Note, 10, pdfPageW-80) {
+			d.Text(40, y, 10, l)
+			y += 13
+		}
+		y += 4
+	}
+
+	rows := make([][]string, 0, len(act.Items))
+	for i, it := range act.Items {
+		rows = append(rows, []string{
+			fmt.Sprint(i + 1), it.InventoryNo, it.Author + ". " + it.Title, fmt.Sprint(it.Year), writeOffReasons[it.Reason],
+		})
+	}
+	y = d.Table(40, y, 9, []float64{28, 70, 247, 40, 130},
+		[]string{"№", "Инв. номер", "Автор, заглавие", "Год", "Причина списания"}, rows)
+	y += 18
+	if y > pdfPageH-110 {
+		d.AddPage()
+		y = 60
+	}
+	d.Text(40, y, 10, fmt.Sprintf("Всего списано экземпляров: %d", len(act.Items)))
+	y += 36
+	for _, s := range []struct {
+		label string
+		login *string
+	}{{"Составил", act.CreatedBy}, {"Утвердил", act.DecidedBy}} {
+		d.Text(40, y, 10, s.label+":")
+		d.Line(130, y+2, 330, y+2)
+		if s.login != nil {
+			d.Text(340, y, 10, *s.login)
+		}
+		y += 30
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="writeoff-%d.pdf"`, act.ActNo))
+	w.Write(d.Bytes())
+}
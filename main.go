@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 func mustEnv(key, def string) string {
@@ -33,7 +34,77 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	api := api2.NewAPI(pool)
+	// поиск описания по ISBN: METADATA_FILE — локальный JSON, METADATA_URL —
+	// каталог с API Open Library (например, https://openlibrary.org). Внешний
+	// каталог включается только явно: без него сервер не ходит в сеть.
+	var chain api2.ChainProvider
+	if f := os.Getenv("METADATA_FILE"); f != "" {
+		chain = append(chain, &api2.FileProvider{Path: f})
+	}
+	if u := os.Getenv("METADATA_URL"); u != "" {
+		chain = append(chain, api2.NewOpenLibraryProvider(u))
+	}
+	// без источников поиск по ISBN отвечает 501
+	var meta api2.MetadataProvider
+	if len(chain) > 0 {
+		meta = chain
+	}
+
+	var blobs api2.BlobStore
+	switch backend := mustEnv("BLOB_BACKEND", "local"); backend {
+	case "local":
+		blobs = api2.LocalStore{Dir: mustEnv("BLOB_DIR", "./data/blobs")}
+	case "s3":
+		blobs = &api2.S3Store{
+			Endpoint:  mustEnv("S3_ENDPOINT", "http://localhost:9000"),
+			Region:    mustEnv("S3_REGION", "us-east-1"),
+			Bucket:    mustEnv("S3_BUCKET", "library"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		}
+	default:
+		log.Fatalf("unknown BLOB_BACKEND %q", backend)
+	}
+
+	opts := []api2.Option{
+		api2.WithMetadata(meta),
+		api2.WithBlobStore(blobs),
+		api2.WithPDFFont(mustEnv("PDF_FONT", "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf")),
+	}
+	// уведомления читателей; NOTIFY_FILE пишет все сообщения в файл вместо отправки
+	if f := os.Getenv("NOTIFY_FILE"); f != "" {
+		opts = append(opts,
+			api2.WithNotifier("email", &api2.FileNotifier{Path: f, Channel: "email"}),
+			api2.WithNotifier("sms", &api2.FileNotifier{Path: f, Channel: "sms"}))
+	} else {
+		if a := os.Getenv("SMTP_ADDR"); a != "" {
+			opts = append(opts, api2.WithNotifier("email", &api2.SMTPNotifier{
+				Addr:     a,
+				From:     mustEnv("SMTP_FROM", "library@localhost"),
+				Username: os.Getenv("SMTP_USER"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+			}))
+		}
+		if u := os.Getenv("SMS_URL"); u != "" {
+			opts = append(opts, api2.WithNotifier("sms", api2.NewSMSGateway(u, os.Getenv("SMS_TOKEN"))))
+		}
+	}
+
+	// срок хранения истории выдач после возврата, дней (по умолчанию 3 года)
+	if v := os.Getenv("HISTORY_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("bad HISTORY_RETENTION_DAYS %q", v)
+		}
+		opts = append(opts, api2.WithHistoryRetention(days))
+	}
+
+	api := api2.NewAPI(pool, opts...)
+
+	// фоновые задания; SCHEDULER=off — реплика только обслуживает HTTP
+	if mustEnv("SCHEDULER", "on") != "off" {
+		go api.RunScheduler(ctx)
+	}
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
 
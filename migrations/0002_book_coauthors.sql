@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- дополнительные авторы (MARC 700); основной автор остаётся в books.author_id
+create table if not exists book_coauthors
+(
+    book_id   uuid references books (id) on delete cascade not null,
+    author_id uuid references book_authors (id)          not null,
+    position  integer default 0                          not null,
+    primary key (book_id, author_id)
+);
+CREATE INDEX IF NOT EXISTS idx_book_coauthors_author ON book_coauthors (author_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists book_coauthors;
+-- +goose StatementEnd
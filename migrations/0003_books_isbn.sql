@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- ISBN хранится нормализованным: 13 цифр без дефисов
+alter table books
+    add column if not exists isbn varchar(13)
+        constraint chk_isbn_format CHECK (isbn IS NULL OR isbn ~ '^\d{13}$');
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_books_isbn ON books (isbn) WHERE isbn IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists uniq_books_isbn;
+alter table books drop column if exists isbn;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists book_attachments
+(
+    id          uuid      default gen_random_uuid() primary key,
+    book_id     uuid references books (id) on delete cascade not null,
+    kind        varchar   default 'attachment'               not null,
+    filename    varchar                                      not null,
+    mime        varchar                                      not null,
+    size        integer                                      not null,
+    storage_key varchar                                      not null unique,
+    thumb_key   varchar,
+    created_at  timestamp default now()                      not null,
+    CONSTRAINT chk_attachment_kind CHECK (kind IN ('cover', 'attachment'))
+);
+CREATE INDEX IF NOT EXISTS idx_book_attachments_book ON book_attachments (book_id);
+-- у книги не больше одной обложки
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_book_cover ON book_attachments (book_id) WHERE kind = 'cover';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists book_attachments;
+-- +goose StatementEnd
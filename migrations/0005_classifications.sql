@@ -0,0 +1,96 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists classifications
+(
+    id        uuid default gen_random_uuid() primary key,
+    scheme    varchar                                 not null,
+    code      varchar,
+    name      varchar                                 not null,
+    parent_id uuid references classifications (id),
+    CONSTRAINT chk_class_scheme CHECK (scheme IN ('udc', 'bbk', 'local')),
+    CONSTRAINT chk_class_not_self CHECK (parent_id IS NULL OR parent_id <> id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_class_code ON classifications (scheme, code) WHERE code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_class_parent ON classifications (parent_id);
+
+create table if not exists book_classifications
+(
+    book_id           uuid references books (id) on delete cascade not null,
+    classification_id uuid references classifications (id)        not null,
+    primary key (book_id, classification_id)
+);
+CREATE INDEX IF NOT EXISTS idx_book_class_class ON book_classifications (classification_id);
+
+-- существующие группы становятся корневыми узлами схемы local с теми же id
+insert into classifications (id, scheme, name)
+select id, 'local', name
+from book_groups
+on conflict (id) do nothing;
+
+insert into book_classifications (book_id, classification_id)
+select id, book_group_id
+from books
+on conflict do nothing;
+
+-- book_groups остаётся для совместимости: новые группы и смена группы у книги
+-- зеркалируются в дерево
+CREATE OR REPLACE FUNCTION book_groups_to_classifications()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        DELETE FROM book_classifications WHERE classification_id = OLD.id;
+        DELETE FROM classifications c
+        WHERE c.id = OLD.id
+          AND NOT EXISTS (SELECT 1 FROM classifications ch WHERE ch.parent_id = OLD.id);
+        RETURN OLD;
+    END IF;
+    INSERT INTO classifications (id, scheme, name)
+    VALUES (NEW.id, 'local', NEW.name)
+    ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_book_groups_to_classifications
+    AFTER INSERT OR UPDATE OF name OR DELETE
+    ON book_groups
+    FOR EACH ROW
+EXECUTE FUNCTION book_groups_to_classifications();
+
+CREATE OR REPLACE FUNCTION books_group_to_classifications()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.book_group_id <> NEW.book_group_id THEN
+        DELETE FROM book_classifications
+        WHERE book_id = NEW.id
+          AND classification_id = OLD.book_group_id;
+    END IF;
+    INSERT INTO book_classifications (book_id, classification_id)
+    VALUES (NEW.id, NEW.book_group_id)
+    ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_books_group_to_classifications
+    AFTER INSERT OR UPDATE OF book_group_id
+    ON books
+    FOR EACH ROW
+EXECUTE FUNCTION books_group_to_classifications();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists trg_books_group_to_classifications on books;
+drop function if exists books_group_to_classifications();
+drop trigger if exists trg_book_groups_to_classifications on book_groups;
+drop function if exists book_groups_to_classifications();
+drop table if exists book_classifications;
+drop table if exists classifications;
+-- +goose StatementEnd
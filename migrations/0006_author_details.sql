@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- name остаётся отображаемым уникальным именем, структурные поля заполняются при сохранении
+alter table book_authors
+    add column if not exists surname     varchar,
+    add column if not exists given_names varchar,
+    add column if not exists patronymic  varchar,
+    add column if not exists birth_year  integer,
+    add column if not exists death_year  integer,
+    add column if not exists alt_names   varchar[] default '{}' not null,
+    add constraint chk_author_life CHECK (birth_year IS NULL OR death_year IS NULL OR death_year >= birth_year);
+CREATE INDEX IF NOT EXISTS idx_authors_surname ON book_authors (lower(surname));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_authors_surname;
+alter table book_authors
+    drop constraint if exists chk_author_life,
+    drop column if exists surname,
+    drop column if exists given_names,
+    drop column if exists patronymic,
+    drop column if exists birth_year,
+    drop column if exists death_year,
+    drop column if exists alt_names;
+-- +goose StatementEnd
@@ -0,0 +1,131 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table reading_rooms
+    add column if not exists capacity integer
+        constraint chk_room_capacity CHECK (capacity IS NULL OR capacity >= 0);
+
+-- часы работы по дням недели (ISO: 1 — понедельник, 7 — воскресенье);
+-- день без строки — выходной. Зал без строк вовсе считается открытым ежедневно.
+create table if not exists room_hours
+(
+    room_id uuid references reading_rooms (id) on delete cascade not null,
+    weekday smallint                                             not null CHECK (weekday BETWEEN 1 AND 7),
+    opens   time                                                 not null,
+    closes  time                                                 not null,
+    primary key (room_id, weekday),
+    CONSTRAINT chk_room_hours CHECK (closes > opens)
+);
+
+-- room_id IS NULL — закрыта вся библиотека
+create table if not exists room_closures
+(
+    id      uuid default gen_random_uuid() primary key,
+    room_id uuid references reading_rooms (id) on delete cascade,
+    day     date    not null,
+    reason  varchar not null
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_room_closure ON room_closures (coalesce(room_id, '00000000-0000-0000-0000-000000000000'), day);
+
+create table if not exists seat_bookings
+(
+    id           uuid      default gen_random_uuid() primary key,
+    room_id      uuid references reading_rooms (id) on delete cascade not null,
+    user_id      uuid references users (id) on delete cascade         not null,
+    seat_no      integer                                              not null,
+    starts_at    timestamp                                            not null,
+    ends_at      timestamp                                            not null,
+    created_at   timestamp default now()                              not null,
+    cancelled_at timestamp,
+    CONSTRAINT chk_booking_period CHECK (ends_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS idx_seat_bookings_room_time ON seat_bookings (room_id, starts_at);
+CREATE INDEX IF NOT EXISTS idx_seat_bookings_user ON seat_bookings (user_id);
+
+CREATE OR REPLACE FUNCTION seat_booking_constraints()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    cap INT;
+BEGIN
+    SELECT capacity
+    INTO cap
+    FROM reading_rooms
+    WHERE id = NEW.room_id
+        FOR UPDATE;
+
+    IF cap IS NULL OR cap = 0 THEN
+        RAISE EXCEPTION 'В зале нет мест для бронирования';
+    END IF;
+    IF NEW.seat_no < 1 OR NEW.seat_no > cap THEN
+        RAISE EXCEPTION 'Место % вне диапазона 1..%', NEW.seat_no, cap;
+    END IF;
+    IF EXISTS (SELECT 1
+               FROM seat_bookings s
+               WHERE s.room_id = NEW.room_id
+                 AND s.seat_no = NEW.seat_no
+                 AND s.id <> NEW.id
+                 AND s.cancelled_at IS NULL
+                 AND tsrange(s.starts_at, s.ends_at) && tsrange(NEW.starts_at, NEW.ends_at)) THEN
+        RAISE EXCEPTION 'Место % уже занято на это время', NEW.seat_no;
+    END IF;
+    IF EXISTS (SELECT 1
+               FROM seat_bookings s
+               WHERE s.user_id = NEW.user_id
+                 AND s.id <> NEW.id
+                 AND s.cancelled_at IS NULL
+                 AND tsrange(s.starts_at, s.ends_at) && tsrange(NEW.starts_at, NEW.ends_at)) THEN
+        RAISE EXCEPTION 'У читателя уже есть бронь на это время';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_seat_booking_constraints
+    BEFORE INSERT OR UPDATE
+    ON seat_bookings
+    FOR EACH ROW
+    WHEN (NEW.cancelled_at IS NULL)
+EXECUTE FUNCTION seat_booking_constraints();
+
+-- журнал посещений: кто сейчас в зале
+create table if not exists room_visits
+(
+    id             uuid      default gen_random_uuid() primary key,
+    room_id        uuid references reading_rooms (id) on delete cascade not null,
+    user_id        uuid references users (id) on delete cascade         not null,
+    checked_in_at  timestamp default now()                              not null,
+    checked_out_at timestamp,
+    CONSTRAINT chk_visit_period CHECK (checked_out_at IS NULL OR checked_out_at >= checked_in_at)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_user_open_visit ON room_visits (user_id) WHERE checked_out_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_room_visits_room ON room_visits (room_id, checked_in_at);
+
+-- срок возврата; для старых выдач — 14 дней от выдачи
+alter table accounting_books
+    add column if not exists date_due date;
+update accounting_books
+set date_due = date_issue + 14
+where date_due is null;
+alter table accounting_books
+    alter column date_due set not null,
+    add constraint chk_due_not_before_issue CHECK (date_due >= date_issue);
+CREATE INDEX IF NOT EXISTS idx_loans_due ON accounting_books (date_due) WHERE date_return IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists idx_loans_due;
+alter table accounting_books
+    drop constraint if exists chk_due_not_before_issue,
+    drop column if exists date_due;
+drop table if exists room_visits;
+drop trigger if exists trg_seat_booking_constraints on seat_bookings;
+drop function if exists seat_booking_constraints();
+drop table if exists seat_bookings;
+drop table if exists room_closures;
+drop table if exists room_hours;
+alter table reading_rooms
+    drop column if exists capacity;
+-- +goose StatementEnd
@@ -0,0 +1,126 @@
+-- +goose Up
+-- +goose StatementBegin
+-- take_home — выдаётся на дом, reading_room — только в зале, not_for_loan — не выдаётся
+alter table books
+    add column if not exists lending_mode varchar default 'take_home' not null
+        constraint chk_books_lending_mode CHECK (lending_mode IN ('take_home', 'reading_room', 'not_for_loan'));
+
+alter table accounting_books
+    add column if not exists loan_type varchar default 'take_home' not null
+        constraint chk_loan_type CHECK (loan_type IN ('take_home', 'reading_room')),
+    -- чтение в зале — возврат в день выдачи
+    add constraint chk_reading_room_due CHECK (loan_type <> 'reading_room' OR date_due = date_issue);
+CREATE INDEX IF NOT EXISTS idx_loans_type_issue ON accounting_books (loan_type, date_issue);
+
+CREATE OR REPLACE FUNCTION book_conditions_constraints()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    user_cnt   INT;
+    book_cnt   INT;
+    max_copies INT;
+    mode       VARCHAR;
+BEGIN
+    SELECT number_copies, lending_mode
+    INTO max_copies, mode
+    FROM books
+    WHERE id = NEW.book_id
+        FOR UPDATE;
+
+    IF mode = 'not_for_loan' THEN
+        RAISE EXCEPTION 'Книга не выдаётся';
+    END IF;
+    IF mode = 'reading_room' AND NEW.loan_type <> 'reading_room' THEN
+        RAISE EXCEPTION 'Книга выдаётся только для чтения в зале';
+    END IF;
+
+    SELECT COUNT(*)
+    INTO user_cnt
+    FROM accounting_books
+    WHERE user_id = NEW.user_id
+      AND date_return IS NULL
+      AND id <> NEW.id;
+
+    SELECT COUNT(*)
+    INTO book_cnt
+    FROM accounting_books
+    WHERE book_id = NEW.book_id
+      AND date_return IS NULL
+      AND id <> NEW.id;
+
+    IF user_cnt >= 5 THEN
+        RAISE EXCEPTION 'Пользователь уже держит 5 или более книг';
+    END IF;
+    IF book_cnt >= max_copies THEN
+        RAISE EXCEPTION 'Свободных экземпляров книги больше нет';
+    END IF;
+    IF EXISTS (SELECT 1
+               FROM accounting_books ab
+               WHERE ab.user_id = NEW.user_id
+                 AND ab.date_return IS NULL
+                 AND ab.book_id = NEW.book_id
+                 AND ab.id <> NEW.id) THEN
+        RAISE EXCEPTION 'Нельзя выдать второй экземпляр той же книги одному пользователю одновременно';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION book_conditions_constraints()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    user_cnt   INT;
+    book_cnt   INT;
+    max_copies INT;
+BEGIN
+    SELECT number_copies
+    INTO max_copies
+    FROM books
+    WHERE id = NEW.book_id
+        FOR UPDATE;
+
+    SELECT COUNT(*)
+    INTO user_cnt
+    FROM accounting_books
+    WHERE user_id = NEW.user_id
+      AND date_return IS NULL;
+
+    SELECT COUNT(*)
+    INTO book_cnt
+    FROM accounting_books
+    WHERE book_id = NEW.book_id
+      AND date_return IS NULL;
+
+    IF user_cnt >= 5 THEN
+        RAISE EXCEPTION 'Пользователь уже держит 5 или более книг';
+    END IF;
+    IF book_cnt >= max_copies THEN
+        RAISE EXCEPTION 'Свободных экземпляров книги больше нет';
+    END IF;
+    IF EXISTS (SELECT 1
+               FROM accounting_books ab
+                        JOIN books b ON b.id = ab.book_id
+               WHERE ab.user_id = NEW.user_id
+                 AND ab.date_return IS NULL
+                 AND b.id = NEW.book_id) THEN
+        RAISE EXCEPTION 'Нельзя выдать второй экземпляр той же книги одному пользователю одновременно';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+drop index if exists idx_loans_type_issue;
+alter table accounting_books
+    drop constraint if exists chk_reading_room_due,
+    drop column if exists loan_type;
+alter table books
+    drop column if exists lending_mode;
+-- +goose StatementEnd
@@ -0,0 +1,122 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists shelves
+(
+    id      uuid default gen_random_uuid() primary key,
+    room_id uuid references reading_rooms (id) on delete cascade not null,
+    code    varchar                                              not null, -- стеллаж-полка, например «А-3-2»
+    name    varchar,
+    constraint uniq_shelf_code UNIQUE (room_id, code)
+);
+
+CREATE SEQUENCE IF NOT EXISTS book_copy_inventory_seq;
+
+-- экземпляры: books.reading_room_id — зал, за которым числится книга,
+-- book_copies.room_id/shelf_id — где экземпляр находится сейчас
+create table if not exists book_copies
+(
+    id           uuid      default gen_random_uuid() primary key,
+    book_id      uuid references books (id) on delete cascade         not null,
+    inventory_no varchar   default lpad(nextval('book_copy_inventory_seq')::text, 8, '0') not null,
+    room_id      uuid references reading_rooms (id)                   not null,
+    shelf_id     uuid references shelves (id) on delete set null,
+    status       varchar   default 'available'                        not null,
+    created_at   timestamp default now()                              not null,
+    constraint uniq_copy_inventory_no UNIQUE (inventory_no),
+    constraint chk_copy_status CHECK (status IN ('available', 'in_transit', 'lost', 'written_off'))
+);
+CREATE INDEX IF NOT EXISTS idx_copies_book ON book_copies (book_id);
+CREATE INDEX IF NOT EXISTS idx_copies_room ON book_copies (room_id);
+
+-- полка должна принадлежать залу экземпляра; при смене зала без новой полки
+-- старая полка сбрасывается
+CREATE OR REPLACE FUNCTION book_copy_shelf_check()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.room_id <> OLD.room_id AND NEW.shelf_id IS NOT DISTINCT FROM OLD.shelf_id THEN
+        NEW.shelf_id := NULL;
+    END IF;
+    IF NEW.shelf_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM shelves WHERE id = NEW.shelf_id AND room_id = NEW.room_id) THEN
+        RAISE EXCEPTION 'Полка находится в другом зале';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_book_copy_shelf_check
+    BEFORE INSERT OR UPDATE OF room_id, shelf_id
+    ON book_copies
+    FOR EACH ROW
+EXECUTE FUNCTION book_copy_shelf_check();
+
+insert into book_copies (book_id, room_id)
+select b.id, b.reading_room_id
+from books b
+         cross join lateral generate_series(1, b.number_copies)
+where not exists (select 1 from book_copies c where c.book_id = b.id);
+
+-- при создании книги и увеличении number_copies недостающие экземпляры
+-- заводятся в зале книги; уменьшение экземпляры не удаляет
+CREATE OR REPLACE FUNCTION book_copies_sync()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    have INT;
+BEGIN
+    SELECT count(*)
+    INTO have
+    FROM book_copies
+    WHERE book_id = NEW.id
+      AND status NOT IN ('lost', 'written_off');
+    IF NEW.number_copies > have THEN
+        INSERT INTO book_copies (book_id, room_id)
+        SELECT NEW.id, NEW.reading_room_id
+        FROM generate_series(1, NEW.number_copies - have);
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER trg_book_copies_sync
+    AFTER INSERT OR UPDATE OF number_copies
+    ON books
+    FOR EACH ROW
+EXECUTE FUNCTION book_copies_sync();
+
+create table if not exists copy_transfers
+(
+    id           uuid      default gen_random_uuid() primary key,
+    copy_id      uuid references book_copies (id) on delete cascade not null,
+    from_room_id uuid references reading_rooms (id)                 not null,
+    to_room_id   uuid references reading_rooms (id)                 not null,
+    to_shelf_id  uuid references shelves (id) on delete set null,
+    status       varchar   default 'requested'                      not null,
+    note         varchar,
+    requested_at timestamp default now()                            not null,
+    shipped_at   timestamp,
+    received_at  timestamp,
+    cancelled_at timestamp,
+    constraint chk_transfer_status CHECK (status IN ('requested', 'in_transit', 'received', 'cancelled')),
+    constraint chk_transfer_rooms CHECK (from_room_id <> to_room_id)
+);
+-- у экземпляра не больше одного незавершённого перемещения
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_copy_open_transfer ON copy_transfers (copy_id) WHERE status IN ('requested', 'in_transit');
+CREATE INDEX IF NOT EXISTS idx_transfers_status ON copy_transfers (status, requested_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists copy_transfers;
+drop trigger if exists trg_book_copies_sync on books;
+drop function if exists book_copies_sync();
+drop trigger if exists trg_book_copy_shelf_check on book_copies;
+drop function if exists book_copy_shelf_check();
+drop table if exists book_copies;
+drop sequence if exists book_copy_inventory_seq;
+drop table if exists shelves;
+-- +goose StatementEnd
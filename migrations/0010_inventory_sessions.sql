@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+-- выдача конкретного экземпляра; у старых выдач экземпляр подбирается по порядку
+alter table accounting_books
+    add column if not exists copy_id uuid references book_copies (id) on delete set null;
+
+with l as (select id, book_id, row_number() over (partition by book_id order by date_issue, id) rn
+           from accounting_books
+           where date_return is null
+             and copy_id is null),
+     c as (select id, book_id, row_number() over (partition by book_id order by inventory_no) rn
+           from book_copies
+           where status = 'available')
+update accounting_books ab
+set copy_id = c.id
+from l
+         join c on c.book_id = l.book_id and c.rn = l.rn
+where ab.id = l.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_copy_active_loan ON accounting_books (copy_id) WHERE date_return IS NULL;
+
+create table if not exists inventory_sessions
+(
+    id        uuid      default gen_random_uuid() primary key,
+    room_id   uuid references reading_rooms (id) on delete cascade not null,
+    status    varchar   default 'open'                            not null,
+    note      varchar,
+    opened_at timestamp default now()                             not null,
+    closed_at timestamp,
+    report    jsonb, -- итог на момент закрытия
+    constraint chk_inventory_status CHECK (status IN ('open', 'closed'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_room_open_inventory ON inventory_sessions (room_id) WHERE status = 'open';
+
+-- отсканированные номера; copy_id пуст, если номер не найден в фонде
+create table if not exists inventory_scans
+(
+    session_id   uuid references inventory_sessions (id) on delete cascade not null,
+    inventory_no varchar                                                   not null,
+    copy_id      uuid references book_copies (id) on delete set null,
+    shelf_id     uuid references shelves (id) on delete set null,
+    scanned_at   timestamp default now()                                   not null,
+    primary key (session_id, inventory_no)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists inventory_scans;
+drop table if exists inventory_sessions;
+drop index if exists uniq_copy_active_loan;
+alter table accounting_books
+    drop column if exists copy_id;
+-- +goose StatementEnd
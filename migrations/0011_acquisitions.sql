@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+-- поставщик может быть издательством из справочника publishing_houses
+create table if not exists suppliers
+(
+    id           uuid default gen_random_uuid() primary key,
+    name         varchar not null unique,
+    publisher_id uuid references publishing_houses (id) on delete set null,
+    contact      varchar,
+    phone        varchar,
+    email        varchar
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_supplier_publisher ON suppliers (publisher_id) WHERE publisher_id IS NOT NULL;
+
+-- источники финансирования комплектования
+create table if not exists acquisition_funds
+(
+    id     uuid default gen_random_uuid() primary key,
+    name   varchar not null unique,
+    year   integer,
+    budget numeric(12, 2) CHECK (budget IS NULL OR budget >= 0)
+);
+
+create table if not exists purchase_orders
+(
+    id          uuid      default gen_random_uuid() primary key,
+    supplier_id uuid references suppliers (id)     not null,
+    number      varchar                            not null unique,
+    order_date  date      default now()            not null,
+    status      varchar   default 'draft'          not null,
+    note        varchar,
+    created_at  timestamp default now()            not null,
+    constraint chk_order_status CHECK (status IN ('draft', 'ordered', 'partially_received', 'received', 'cancelled'))
+);
+CREATE INDEX IF NOT EXISTS idx_orders_supplier ON purchase_orders (supplier_id);
+
+create table if not exists purchase_order_lines
+(
+    id         uuid    default gen_random_uuid() primary key,
+    order_id   uuid references purchase_orders (id) on delete cascade not null,
+    title      varchar                                                not null,
+    isbn       varchar(13),
+    book_id    uuid references books (id) on delete set null,
+    fund_id    uuid references acquisition_funds (id)                 not null,
+    quantity   integer                                                not null CHECK (quantity > 0),
+    unit_price numeric(12, 2)                                         not null CHECK (unit_price >= 0),
+    received   integer default 0                                      not null,
+    constraint chk_line_received CHECK (received BETWEEN 0 AND quantity)
+);
+CREATE INDEX IF NOT EXISTS idx_order_lines_order ON purchase_order_lines (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_lines_fund ON purchase_order_lines (fund_id);
+
+-- поступления по строкам заказа (частичная приёмка — несколько строк)
+create table if not exists acquisition_receipts
+(
+    id          uuid      default gen_random_uuid() primary key,
+    line_id     uuid references purchase_order_lines (id) on delete cascade not null,
+    book_id     uuid references books (id) on delete set null,
+    room_id     uuid references reading_rooms (id)                          not null,
+    quantity    integer                                                     not null CHECK (quantity > 0),
+    received_at timestamp default now()                                     not null
+);
+CREATE INDEX IF NOT EXISTS idx_receipts_line ON acquisition_receipts (line_id);
+
+alter table book_copies
+    add column if not exists receipt_id uuid references acquisition_receipts (id) on delete set null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table book_copies
+    drop column if exists receipt_id;
+drop table if exists acquisition_receipts;
+drop table if exists purchase_order_lines;
+drop table if exists purchase_orders;
+drop table if exists acquisition_funds;
+drop table if exists suppliers;
+-- +goose StatementEnd
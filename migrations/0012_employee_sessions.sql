@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table employees
+    add column if not exists role varchar default 'staff' not null
+        constraint chk_employee_role CHECK (role IN ('staff', 'admin'));
+update employees
+set role = 'admin'
+where login = 'admin';
+
+-- токены входа сотрудников
+create table if not exists employee_sessions
+(
+    token       varchar primary key,
+    employee_id uuid references employees (id) on delete cascade not null,
+    created_at  timestamp default now()                          not null,
+    expires_at  timestamp                                        not null
+);
+CREATE INDEX IF NOT EXISTS idx_employee_sessions_expires ON employee_sessions (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists employee_sessions;
+alter table employees
+    drop column if exists role;
+-- +goose StatementEnd
@@ -0,0 +1,77 @@
+-- +goose Up
+-- +goose StatementBegin
+-- все экземпляры книги могут быть списаны
+alter table books
+    drop constraint if exists books_number_copies_check,
+    add constraint books_number_copies_check CHECK (number_copies >= 0);
+
+-- number_copies — число экземпляров, не утерянных и не списанных
+CREATE OR REPLACE FUNCTION book_copies_count()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    UPDATE books
+    SET number_copies = (SELECT count(*)
+                         FROM book_copies
+                         WHERE book_id = NEW.book_id
+                           AND status NOT IN ('lost', 'written_off'))
+    WHERE id = NEW.book_id;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER trg_book_copies_count
+    AFTER UPDATE OF status
+    ON book_copies
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status)
+EXECUTE FUNCTION book_copies_count();
+
+update books b
+set number_copies = (select count(*)
+                     from book_copies c
+                     where c.book_id = b.id
+                       and c.status not in ('lost', 'written_off'))
+where exists (select 1 from book_copies c where c.book_id = b.id and c.status in ('lost', 'written_off'));
+
+CREATE SEQUENCE IF NOT EXISTS write_off_act_no_seq;
+
+-- акты списания: pending → approved | rejected
+create table if not exists write_off_acts
+(
+    id            uuid      default gen_random_uuid() primary key,
+    act_no        integer   default nextval('write_off_act_no_seq') not null unique,
+    status        varchar   default 'pending'                       not null,
+    note          varchar,
+    created_by    uuid references employees (id) on delete set null,
+    created_at    timestamp default now()                           not null,
+    decided_by    uuid references employees (id) on delete set null,
+    decided_at    timestamp,
+    decision_note varchar,
+    constraint chk_write_off_status CHECK (status IN ('pending', 'approved', 'rejected'))
+);
+
+create table if not exists write_off_items
+(
+    act_id  uuid references write_off_acts (id) on delete cascade not null,
+    copy_id uuid references book_copies (id)                      not null,
+    reason  varchar                                               not null,
+    primary key (act_id, copy_id),
+    constraint chk_write_off_reason CHECK (reason IN ('worn', 'damaged', 'lost', 'outdated', 'other'))
+);
+CREATE INDEX IF NOT EXISTS idx_write_off_items_copy ON write_off_items (copy_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists write_off_items;
+drop table if exists write_off_acts;
+drop sequence if exists write_off_act_no_seq;
+drop trigger if exists trg_book_copies_count on book_copies;
+drop function if exists book_copies_count();
+alter table books
+    drop constraint if exists books_number_copies_check,
+    add constraint books_number_copies_check CHECK (number_copies >= 1) NOT VALID;
+-- +goose StatementEnd
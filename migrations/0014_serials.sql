@@ -0,0 +1,193 @@
+-- +goose Up
+-- +goose StatementBegin
+-- периодические издания (журналы, газеты)
+create table if not exists serials
+(
+    id                uuid    default gen_random_uuid() primary key,
+    title             varchar                            not null,
+    issn              varchar unique,
+    publisher_id      uuid references publishing_houses (id),
+    reading_room_id   uuid references reading_rooms (id) not null,
+    frequency         varchar default 'monthly'          not null,
+    -- номеров в томе (годе); после последнего нумерация начинается с 1 в следующем томе
+    issues_per_volume integer,
+    lending_mode      varchar default 'reading_room'     not null,
+    active            boolean default true               not null,
+    note              varchar,
+    constraint chk_serial_frequency CHECK (frequency IN ('daily', 'weekly', 'biweekly', 'monthly', 'bimonthly',
+                                                         'quarterly', 'semiannual', 'annual', 'irregular')),
+    constraint chk_serial_issues_per_volume CHECK (issues_per_volume IS NULL OR issues_per_volume > 0),
+    constraint chk_serial_lending_mode CHECK (lending_mode IN ('take_home', 'reading_room', 'not_for_loan'))
+);
+CREATE INDEX IF NOT EXISTS idx_serials_title ON serials (lower(title));
+
+-- номера: received — поступил, missing — ожидался, но не пришёл
+create table if not exists serial_issues
+(
+    id          uuid    default gen_random_uuid() primary key,
+    serial_id   uuid references serials (id) on delete cascade not null,
+    volume      integer,
+    number      integer                                       not null,
+    issue_date  date                                          not null,
+    status      varchar default 'received'                    not null,
+    received_at date,
+    copies      integer default 1                             not null,
+    note        varchar,
+    constraint chk_issue_status CHECK (status IN ('received', 'missing')),
+    constraint chk_issue_received CHECK ((status = 'received') = (received_at IS NOT NULL)),
+    constraint chk_issue_number CHECK (number > 0),
+    constraint chk_issue_copies CHECK (copies >= 0)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_serial_issue
+    ON serial_issues (serial_id, coalesce(volume, 0), number);
+CREATE INDEX IF NOT EXISTS idx_serial_issues_date ON serial_issues (serial_id, issue_date);
+
+-- выдача номера журнала идёт через accounting_books вместо книги
+alter table accounting_books
+    alter column book_id drop not null,
+    add column if not exists issue_id uuid references serial_issues (id),
+    add constraint chk_loan_item CHECK ((book_id IS NULL) <> (issue_id IS NULL));
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_user_active_issue
+    ON accounting_books (user_id, issue_id) WHERE date_return IS NULL AND issue_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION book_conditions_constraints()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    user_cnt   INT;
+    book_cnt   INT;
+    max_copies INT;
+    mode       VARCHAR;
+    st         VARCHAR;
+BEGIN
+    SELECT COUNT(*)
+    INTO user_cnt
+    FROM accounting_books
+    WHERE user_id = NEW.user_id
+      AND date_return IS NULL
+      AND id <> NEW.id;
+    IF user_cnt >= 5 THEN
+        RAISE EXCEPTION 'Пользователь уже держит 5 или более книг';
+    END IF;
+
+    IF NEW.issue_id IS NOT NULL THEN
+        SELECT si.copies, s.lending_mode, si.status
+        INTO max_copies, mode, st
+        FROM serial_issues si
+                 JOIN serials s ON s.id = si.serial_id
+        WHERE si.id = NEW.issue_id
+            FOR UPDATE OF si;
+        IF st <> 'received' THEN
+            RAISE EXCEPTION 'Номер не поступил в библиотеку';
+        END IF;
+        SELECT COUNT(*)
+        INTO book_cnt
+        FROM accounting_books
+        WHERE issue_id = NEW.issue_id
+          AND date_return IS NULL
+          AND id <> NEW.id;
+    ELSE
+        SELECT number_copies, lending_mode
+        INTO max_copies, mode
+        FROM books
+        WHERE id = NEW.book_id
+            FOR UPDATE;
+        SELECT COUNT(*)
+        INTO book_cnt
+        FROM accounting_books
+        WHERE book_id = NEW.book_id
+          AND date_return IS NULL
+          AND id <> NEW.id;
+        IF EXISTS (SELECT 1
+                   FROM accounting_books ab
+                   WHERE ab.user_id = NEW.user_id
+                     AND ab.date_return IS NULL
+                     AND ab.book_id = NEW.book_id
+                     AND ab.id <> NEW.id) THEN
+            RAISE EXCEPTION 'Нельзя выдать второй экземпляр той же книги одному пользователю одновременно';
+        END IF;
+    END IF;
+
+    IF mode = 'not_for_loan' THEN
+        RAISE EXCEPTION 'Издание не выдаётся';
+    END IF;
+    IF mode = 'reading_room' AND NEW.loan_type <> 'reading_room' THEN
+        RAISE EXCEPTION 'Издание выдаётся только для чтения в зале';
+    END IF;
+    IF book_cnt >= max_copies THEN
+        RAISE EXCEPTION 'Свободных экземпляров больше нет';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION book_conditions_constraints()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+DECLARE
+    user_cnt   INT;
+    book_cnt   INT;
+    max_copies INT;
+    mode       VARCHAR;
+BEGIN
+    SELECT number_copies, lending_mode
+    INTO max_copies, mode
+    FROM books
+    WHERE id = NEW.book_id
+        FOR UPDATE;
+
+    IF mode = 'not_for_loan' THEN
+        RAISE EXCEPTION 'Книга не выдаётся';
+    END IF;
+    IF mode = 'reading_room' AND NEW.loan_type <> 'reading_room' THEN
+        RAISE EXCEPTION 'Книга выдаётся только для чтения в зале';
+    END IF;
+
+    SELECT COUNT(*)
+    INTO user_cnt
+    FROM accounting_books
+    WHERE user_id = NEW.user_id
+      AND date_return IS NULL
+      AND id <> NEW.id;
+
+    SELECT COUNT(*)
+    INTO book_cnt
+    FROM accounting_books
+    WHERE book_id = NEW.book_id
+      AND date_return IS NULL
+      AND id <> NEW.id;
+
+    IF user_cnt >= 5 THEN
+        RAISE EXCEPTION 'Пользователь уже держит 5 или более книг';
+    END IF;
+    IF book_cnt >= max_copies THEN
+        RAISE EXCEPTION 'Свободных экземпляров книги больше нет';
+    END IF;
+    IF EXISTS (SELECT 1
+               FROM accounting_books ab
+               WHERE ab.user_id = NEW.user_id
+                 AND ab.date_return IS NULL
+                 AND ab.book_id = NEW.book_id
+                 AND ab.id <> NEW.id) THEN
+        RAISE EXCEPTION 'Нельзя выдать второй экземпляр той же книги одному пользователю одновременно';
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+delete from accounting_books where issue_id is not null;
+drop index if exists uniq_user_active_issue;
+alter table accounting_books
+    drop constraint if exists chk_loan_item,
+    drop column if exists issue_id,
+    alter column book_id set not null;
+drop table if exists serial_issues;
+drop table if exists serials;
+-- +goose StatementEnd
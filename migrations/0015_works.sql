@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+-- произведение объединяет издания и переводы одного текста
+create table if not exists works
+(
+    id                uuid default gen_random_uuid() primary key,
+    title             varchar                              not null,
+    original_title    varchar,
+    author_id         uuid references book_authors (id)    not null,
+    original_language varchar,
+    note              varchar
+);
+CREATE INDEX IF NOT EXISTS idx_works_author_title ON works (author_id, lower(title));
+
+-- издательские серии
+create table if not exists series
+(
+    id           uuid default gen_random_uuid() primary key,
+    name         varchar not null unique,
+    publisher_id uuid references publishing_houses (id)
+);
+
+alter table books
+    add column if not exists work_id       uuid references works (id),
+    add column if not exists series_id     uuid references series (id),
+    add column if not exists series_number integer
+        constraint chk_books_series_number CHECK (series_number > 0),
+    add column if not exists language      varchar,
+    -- «2-е изд., испр.» и т. п.
+    add column if not exists edition       varchar;
+CREATE INDEX IF NOT EXISTS idx_books_work ON books (work_id);
+CREATE INDEX IF NOT EXISTS idx_books_series ON books (series_id, series_number);
+
+-- издания одного года у разных издательств — разные книги
+alter table books
+    drop constraint if exists unique_book;
+CREATE UNIQUE INDEX IF NOT EXISTS unique_book
+    ON books (name, author_id, year_publication, published_house_id, coalesce(edition, ''));
+
+insert into works (title, author_id)
+select distinct b.name, b.author_id
+from books b;
+update books b
+set work_id = w.id
+from works w
+where w.title = b.name
+  and w.author_id = b.author_id
+  and b.work_id is null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists unique_book;
+alter table books
+    add constraint unique_book UNIQUE (name, author_id, year_publication);
+drop index if exists idx_books_series;
+drop index if exists idx_books_work;
+alter table books
+    drop column if exists edition,
+    drop column if exists language,
+    drop column if exists series_number,
+    drop column if exists series_id,
+    drop column if exists work_id;
+drop table if exists series;
+drop table if exists works;
+-- +goose StatementEnd
@@ -0,0 +1,180 @@
+-- +goose Up
+-- +goose StatementBegin
+-- языки по ISO 639
+create table if not exists languages
+(
+    id          uuid default gen_random_uuid() primary key,
+    name        varchar not null unique,
+    code        varchar not null unique,
+    native_name varchar
+);
+
+insert into languages (code, name, native_name)
+values ('ru', 'Русский', 'русский'),
+       ('en', 'Английский', 'English'),
+       ('de', 'Немецкий', 'Deutsch'),
+       ('fr', 'Французский', 'français'),
+       ('es', 'Испанский', 'español'),
+       ('it', 'Итальянский', 'italiano'),
+       ('uk', 'Украинский', 'українська'),
+       ('be', 'Белорусский', 'беларуская'),
+       ('pl', 'Польский', 'polski'),
+       ('cs', 'Чешский', 'čeština'),
+       ('tt', 'Татарский', 'татар теле'),
+       ('la', 'Латинский', 'Latina'),
+       ('el', 'Греческий', 'ελληνικά'),
+       ('zh', 'Китайский', '中文'),
+       ('ja', 'Японский', '日本語'),
+       ('ar', 'Арабский', 'العربية')
+on conflict do nothing;
+
+-- языки книги; position 0 — основной
+create table if not exists book_languages
+(
+    book_id     uuid references books (id) on delete cascade not null,
+    language_id uuid references languages (id)               not null,
+    position    integer default 0                            not null,
+    primary key (book_id, language_id)
+);
+CREATE INDEX IF NOT EXISTS idx_book_languages_language ON book_languages (language_id);
+
+insert into languages (code, name)
+select distinct b.language, b.language
+from books b
+where b.language is not null
+on conflict do nothing;
+insert into book_languages (book_id, language_id)
+select b.id, l.id
+from books b
+         join languages l on l.code = b.language;
+alter table books
+    drop column if exists language;
+
+-- транслитерация по ГОСТ 7.79-2000 (система Б): кириллица → латиница,
+-- латиница → кириллица; NULL, если в строке нет ни той, ни другой
+CREATE OR REPLACE FUNCTION translit(s text)
+    RETURNS text
+    LANGUAGE plpgsql
+    IMMUTABLE
+AS
+$$
+DECLARE
+    lat jsonb := '{"а":"a","б":"b","в":"v","г":"g","д":"d","е":"e","ё":"yo","ж":"zh","з":"z","и":"i",
+                   "й":"j","к":"k","л":"l","м":"m","н":"n","о":"o","п":"p","р":"r","с":"s","т":"t",
+                   "у":"u","ф":"f","х":"x","ц":"cz","ч":"ch","ш":"sh","щ":"shh","ъ":"``","ы":"y`","ь":"`",
+                   "э":"e`","ю":"yu","я":"ya","і":"i`","ї":"yi","є":"ye","ґ":"g`","ў":"u`"}';
+    cyr jsonb := '{"shh":"щ","yo":"ё","zh":"ж","cz":"ц","ch":"ч","sh":"ш","``":"ъ","y`":"ы","e`":"э",
+                   "yu":"ю","ya":"я","i`":"і","yi":"ї","ye":"є","g`":"ґ","u`":"ў","`":"ь",
+                   "a":"а","b":"б","v":"в","g":"г","d":"д","e":"е","z":"з","i":"и","j":"й","k":"к",
+                   "l":"л","m":"м","n":"н","o":"о","p":"п","r":"р","s":"с","t":"т","u":"у","f":"ф",
+                   "x":"х","c":"ц","h":"х","q":"к","w":"в","y":"ы"}';
+    res text    := '';
+    i   int     := 1;
+    k   int;
+    ch  text;
+    m   text;
+    nxt text;
+BEGIN
+    IF s IS NULL THEN
+        RETURN NULL;
+    END IF;
+    IF s ~ '[А-Яа-яЁёІіЇїЄєҐґЎў]' THEN
+        WHILE i <= length(s)
+            LOOP
+                ch := substr(s, i, 1);
+                m := lat ->> lower(ch);
+                IF m IS NULL THEN
+                    res := res || ch;
+                ELSE
+                    -- ц перед i, e, y, j пишется c
+                    IF lower(ch) = 'ц' THEN
+                        nxt := lat ->> lower(substr(s, i + 1, 1));
+                        IF left(nxt, 1) IN ('i', 'e', 'y', 'j') THEN
+                            m := 'c';
+                        END IF;
+                    END IF;
+                    IF ch <> lower(ch) THEN
+                        m := upper(left(m, 1)) || substr(m, 2);
+                    END IF;
+                    res := res || m;
+                END IF;
+                i := i + 1;
+            END LOOP;
+        RETURN res;
+    END IF;
+    IF s !~ '[A-Za-z]' THEN
+        RETURN NULL;
+    END IF;
+    WHILE i <= length(s)
+        LOOP
+            k := 3;
+            m := NULL;
+            WHILE k > 0 AND m IS NULL
+                LOOP
+                    m := cyr ->> lower(substr(s, i, k));
+                    k := k - 1;
+                END LOOP;
+            ch := substr(s, i, 1);
+            IF m IS NULL THEN
+                res := res || ch;
+                i := i + 1;
+            ELSE
+                IF ch <> lower(ch) THEN
+                    m := upper(m);
+                END IF;
+                res := res || m;
+                i := i + k + 1;
+            END IF;
+        END LOOP;
+    RETURN res;
+END;
+$$;
+
+alter table books
+    add column if not exists name_translit varchar;
+
+-- транслитерация названия заполняется автоматически, если её не задали явно
+CREATE OR REPLACE FUNCTION books_name_translit()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' AND NEW.name_translit IS NULL
+        OR TG_OP = 'UPDATE' AND NEW.name IS DISTINCT FROM OLD.name
+               AND NEW.name_translit IS NOT DISTINCT FROM OLD.name_translit THEN
+        NEW.name_translit := translit(NEW.name);
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_books_name_translit
+    BEFORE INSERT OR UPDATE OF name, name_translit
+    ON books
+    FOR EACH ROW
+EXECUTE FUNCTION books_name_translit();
+
+update books
+set name_translit = translit(name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists trg_books_name_translit on books;
+drop function if exists books_name_translit();
+alter table books
+    drop column if exists name_translit;
+drop function if exists translit(text);
+alter table books
+    add column if not exists language varchar;
+update books b
+set language = (select l.code
+                from book_languages bl
+                         join languages l on l.id = bl.language_id
+                where bl.book_id = b.id
+                order by bl.position, l.code
+                limit 1);
+drop table if exists book_languages;
+drop table if exists languages;
+-- +goose StatementEnd
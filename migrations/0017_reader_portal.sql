@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- вход читателя в личный кабинет: номер билета + PIN (или пароль)
+alter table users
+    add column if not exists pin_hash         varchar,
+    add column if not exists pin_failures     integer default 0 not null,
+    add column if not exists pin_locked_until timestamp;
+
+create table if not exists reader_sessions
+(
+    token      varchar primary key,
+    user_id    uuid references users (id) on delete cascade not null,
+    created_at timestamp default now()                      not null,
+    expires_at timestamp                                    not null
+);
+CREATE INDEX IF NOT EXISTS idx_reader_sessions_expires ON reader_sessions (expires_at);
+
+alter table accounting_books
+    add column if not exists renewals integer default 0 not null
+        constraint chk_loan_renewals CHECK (renewals >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table accounting_books
+    drop column if exists renewals;
+drop table if exists reader_sessions;
+alter table users
+    drop column if exists pin_locked_until,
+    drop column if exists pin_failures,
+    drop column if exists pin_hash;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+-- контакты и настройки уведомлений читателя
+alter table users
+    add column if not exists email          varchar,
+    add column if not exists card_expires   date,
+    add column if not exists notify_lang    varchar default 'ru' not null
+        constraint chk_users_notify_lang CHECK (notify_lang IN ('ru', 'en')),
+    add column if not exists notify_opt_out boolean default false not null;
+
+-- исходящие сообщения; dedup_key не даёт поставить одно и то же уведомление дважды
+create table if not exists notification_outbox
+(
+    id              uuid      default gen_random_uuid() primary key,
+    user_id         uuid references users (id) on delete cascade not null,
+    loan_id         uuid references accounting_books (id) on delete cascade,
+    kind            varchar                                      not null,
+    channel         varchar                                      not null CHECK (channel IN ('email', 'sms')),
+    recipient       varchar                                      not null,
+    subject         varchar                                      not null,
+    body            text                                         not null,
+    dedup_key       varchar                                      not null unique,
+    status          varchar   default 'pending'                  not null
+        CHECK (status IN ('pending', 'sent', 'failed', 'cancelled')),
+    attempts        integer   default 0                          not null,
+    next_attempt_at timestamp default now()                      not null,
+    last_error      varchar,
+    created_at      timestamp default now()                      not null,
+    sent_at         timestamp
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON notification_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_outbox_user ON notification_outbox (user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists notification_outbox;
+alter table users
+    drop column if exists notify_opt_out,
+    drop column if exists notify_lang,
+    drop column if exists card_expires,
+    drop column if exists email;
+-- +goose StatementEnd
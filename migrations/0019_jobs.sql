@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+-- фоновые задания; lease_owner/lease_until — какая реплика сейчас выполняет задание
+create table if not exists jobs
+(
+    name        varchar primary key,
+    schedule    varchar               not null,
+    paused      boolean default false not null,
+    next_run_at timestamp,
+    lease_owner varchar,
+    lease_until timestamp
+);
+
+insert into jobs (name, schedule)
+values ('overdue', '0 2 * * *'),
+       ('notifications', '*/15 * * * *'),
+       ('expire_bookings', '*/5 * * * *'),
+       ('purge_sessions', '30 3 * * *')
+on conflict do nothing;
+
+create table if not exists job_runs
+(
+    id           uuid      default gen_random_uuid() primary key,
+    job_name     varchar references jobs (name) on delete cascade not null,
+    node         varchar                                          not null,
+    manual       boolean   default false                          not null,
+    triggered_by uuid references employees (id),
+    started_at   timestamp default now()                          not null,
+    finished_at  timestamp,
+    status       varchar   default 'running'                      not null
+        CHECK (status IN ('running', 'ok', 'failed')),
+    result       jsonb,
+    error        varchar
+);
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs (job_name, started_at);
+
+-- дней просрочки: пересчитывается ночным заданием, у возвращённых — окончательное
+alter table accounting_books
+    add column if not exists overdue_days integer default 0 not null;
+-- проверки выдачи здесь не нужны: книгу могли перевести в зал уже после выдачи
+alter table accounting_books
+    disable trigger trg_book_conditions_constraints;
+update accounting_books
+set overdue_days = greatest(coalesce(date_return, current_date) - date_due, 0);
+alter table accounting_books
+    enable trigger trg_book_conditions_constraints;
+
+-- бронь снята автоматически: читатель не пришёл
+alter table seat_bookings
+    add column if not exists no_show boolean default false not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table seat_bookings
+    drop column if exists no_show;
+alter table accounting_books
+    drop column if exists overdue_days;
+drop table if exists job_runs;
+drop table if exists jobs;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- дата записи читателя в библиотеку (для статистики); для существующих —
+-- первая выдача или посещение
+alter table users
+    add column if not exists registered_at date default current_date not null;
+update users u
+set registered_at = least(current_date,
+                          (select min(ab.date_issue) from accounting_books ab where ab.user_id = u.id),
+                          (select min(v.checked_in_at)::date from room_visits v where v.user_id = u.id));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table users
+    drop column if exists registered_at;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- сколько дней хранить историю выдач читателя после возврата;
+-- NULL — срок по умолчанию библиотеки, 0 — не хранить
+alter table users
+    add column if not exists history_retention_days integer
+        constraint chk_users_history_retention CHECK (history_retention_days >= 0);
+
+CREATE INDEX IF NOT EXISTS idx_loans_user_issue ON accounting_books (user_id, date_issue, id);
+
+insert into jobs (name, schedule)
+values ('anonymise_history', '0 4 * * *')
+on conflict do nothing;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+delete
+from jobs
+where name = 'anonymise_history';
+drop index if exists idx_loans_user_issue;
+alter table users
+    drop column if exists history_retention_days;
+-- +goose StatementEnd
@@ -0,0 +1,80 @@
+-- +goose Up
+-- +goose StatementBegin
+-- дата поступления экземпляра; NULL — экземпляр был в фонде до перехода на
+-- поэкземплярный учёт (0009), настоящая дата неизвестна
+alter table book_copies
+    add column if not exists acquired_on date,
+    -- дата выбытия: утеря или списание
+    add column if not exists retired_on  date;
+
+-- экземпляры, заведённые миграцией 0009 для уже существующих книг, получили
+-- created_at этой миграции; goose пишет свою версию в той же транзакции
+DO
+$$
+    DECLARE
+        migrated timestamp;
+    BEGIN
+        IF to_regclass('goose_db_version') IS NOT NULL THEN
+            SELECT tstamp
+            INTO migrated
+            FROM goose_db_version
+            WHERE version_id = 9
+              AND is_applied
+            ORDER BY id DESC
+            LIMIT 1;
+        END IF;
+        UPDATE book_copies
+        SET acquired_on = created_at::date
+        WHERE migrated IS NULL
+           OR created_at <> migrated;
+    END
+$$;
+
+alter table book_copies
+    alter column acquired_on set default current_date;
+
+update book_copies c
+set retired_on = (select min(wa.decided_at)::date
+                  from write_off_items wi
+                           join write_off_acts wa on wa.id = wi.act_id
+                  where wi.copy_id = c.id
+                    and wa.status = 'approved')
+where c.status = 'written_off';
+-- утерю отмечают по итогам инвентаризации зала
+update book_copies c
+set retired_on = coalesce((select max(s.closed_at)::date
+                           from inventory_sessions s
+                           where s.room_id = c.room_id), current_date)
+where c.status = 'lost'
+   or (c.status = 'written_off' and c.retired_on is null);
+
+CREATE OR REPLACE FUNCTION book_copy_retired()
+    RETURNS trigger
+    LANGUAGE plpgsql
+AS
+$$
+BEGIN
+    IF NEW.status IN ('lost', 'written_off') AND OLD.status NOT IN ('lost', 'written_off') THEN
+        NEW.retired_on := current_date;
+    ELSIF NEW.status NOT IN ('lost', 'written_off') THEN
+        NEW.retired_on := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER trg_book_copy_retired
+    BEFORE UPDATE OF status
+    ON book_copies
+    FOR EACH ROW
+EXECUTE FUNCTION book_copy_retired();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists trg_book_copy_retired on book_copies;
+drop function if exists book_copy_retired();
+alter table book_copies
+    drop column if exists retired_on,
+    drop column if exists acquired_on;
+-- +goose StatementEnd
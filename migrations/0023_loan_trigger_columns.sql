@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- проверки выдачи (режим выдачи, свободные экземпляры, статус номера) нужны
+-- только при выдаче и при смене читателя или издания; пересчёт просрочки и
+-- продление не должны падать, если книгу после выдачи перевели в зал
+drop trigger if exists trg_book_conditions_constraints on accounting_books;
+CREATE TRIGGER trg_book_conditions_constraints
+    BEFORE INSERT OR UPDATE OF user_id, book_id, issue_id, loan_type
+    ON accounting_books
+    FOR EACH ROW
+    WHEN (NEW.date_return IS NULL)
+EXECUTE FUNCTION book_conditions_constraints();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger if exists trg_book_conditions_constraints on accounting_books;
+CREATE TRIGGER trg_book_conditions_constraints
+    BEFORE INSERT OR UPDATE
+    ON accounting_books
+    FOR EACH ROW
+    WHEN (NEW.date_return IS NULL)
+EXECUTE FUNCTION book_conditions_constraints();
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- при обезличивании выдачи сохраняется то, что нужно для 6-НК: возрастная
+-- группа читателя на конец года выдачи и считается ли день выдачи посещением
+-- (один раз на читателя и день, если в этот день не было отметки в зале)
+alter table accounting_books
+    add column if not exists reader_age_group smallint
+        constraint chk_loans_reader_age_group CHECK (reader_age_group BETWEEN 1 AND 3),
+    add column if not exists counts_visit     boolean default false not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table accounting_books
+    drop column if exists counts_visit,
+    drop column if exists reader_age_group;
+-- +goose StatementEnd